@@ -0,0 +1,177 @@
+package acl
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ap4y/cloud/internal/pathutil"
+	"github.com/ap4y/cloud/module"
+)
+
+// Role defines maximum access level of a user.
+type Role string
+
+const (
+	// RoleAdmin grants full access to all modules, rules are ignored.
+	RoleAdmin Role = "admin"
+	// RoleEditor grants read and write access to paths matched by rules.
+	RoleEditor Role = "editor"
+	// RoleViewer grants read only access to paths matched by rules.
+	RoleViewer Role = "viewer"
+)
+
+// Access defines type of the requested operation.
+type Access int
+
+const (
+	// Read defines listing and download operations.
+	Read Access = iota
+	// Write defines operations that modify module content.
+	Write
+)
+
+// Rule grants access to a subtree of a module source.
+type Rule struct {
+	Module   module.Type `json:"module"`
+	Path     string      `json:"path"`
+	ReadOnly bool        `json:"read_only"`
+}
+
+// includes returns true if cleaned path p is within rule's subtree.
+func (r Rule) includes(m module.Type, p string) bool {
+	if r.Module != m {
+		return false
+	}
+
+	root := cleanPath(r.Path)
+	return root == "/" || p == root || strings.HasPrefix(p, root+"/")
+}
+
+// User defines role and access rules of a user. User without rules
+// has access to all modules allowed by the role.
+type User struct {
+	Role  Role   `json:"role"`
+	Rules []Rule `json:"rules"`
+}
+
+// IsValid returns true if user has a known role and all rules define a
+// module.
+func (u *User) IsValid() bool {
+	if u.Role != RoleAdmin && u.Role != RoleEditor && u.Role != RoleViewer {
+		return false
+	}
+
+	for _, rule := range u.Rules {
+		if rule.Module == "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Allows returns true if user has access a to the path p of the
+// module m, empty path refers to the whole module.
+func (u *User) Allows(m module.Type, p string, a Access) bool {
+	if u.Role == RoleAdmin {
+		return true
+	}
+
+	if a == Write && u.Role != RoleEditor {
+		return false
+	}
+
+	if len(u.Rules) == 0 {
+		return true
+	}
+
+	p = cleanPath(p)
+	for _, rule := range u.Rules {
+		if rule.includes(m, p) && (a == Read || !rule.ReadOnly) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AllowsModule returns true if user has access a to any path of the
+// module m.
+func (u *User) AllowsModule(m module.Type, a Access) bool {
+	if u.Role == RoleAdmin {
+		return true
+	}
+
+	if a == Write && u.Role != RoleEditor {
+		return false
+	}
+
+	if len(u.Rules) == 0 {
+		return true
+	}
+
+	for _, rule := range u.Rules {
+		if rule.Module == m && (a == Read || !rule.ReadOnly) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AllowsWithin returns true if user has access a to the path p of
+// the module m or to any path inside of it. Such paths have to be
+// listed to navigate to allowed subtrees.
+func (u *User) AllowsWithin(m module.Type, p string, a Access) bool {
+	if u.Allows(m, p, a) {
+		return true
+	}
+
+	if !u.AllowsModule(m, a) {
+		return false
+	}
+
+	p = cleanPath(p)
+	for _, rule := range u.Rules {
+		root := cleanPath(rule.Path)
+		if rule.Module == m && (a == Read || !rule.ReadOnly) &&
+			(p == "/" || strings.HasPrefix(root, p+"/")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Provider returns access rules of users.
+type Provider interface {
+	// User returns access rules of a user, false is returned for
+	// users without permissions.
+	User(username string) (*User, bool)
+}
+
+// Permissions maps usernames to their access rules.
+type Permissions map[string]*User
+
+// User implements Provider.
+func (p Permissions) User(username string) (*User, bool) {
+	user, ok := p[username]
+	return user, ok && user != nil
+}
+
+// Validate returns error for users with invalid roles or rules.
+func (p Permissions) Validate() error {
+	for username, user := range p {
+		if user == nil || !user.IsValid() {
+			return fmt.Errorf("invalid permissions for user %s", username)
+		}
+	}
+
+	return nil
+}
+
+// cleanPath normalizes p the same way as sources do, so checked paths
+// always match accessed ones.
+func cleanPath(p string) string {
+	return pathutil.Clean(p)
+}
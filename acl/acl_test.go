@@ -0,0 +1,79 @@
+package acl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ap4y/cloud/module"
+)
+
+func TestUser(t *testing.T) {
+	editor := &User{Role: RoleEditor, Rules: []Rule{
+		{Module: module.Files, Path: "/docs"},
+		{Module: module.Files, Path: "/photos", ReadOnly: true},
+		{Module: module.Gallery, Path: "2023"},
+	}}
+
+	t.Run("IsValid", func(t *testing.T) {
+		assert.False(t, (&User{}).IsValid())
+		assert.False(t, (&User{Role: "owner"}).IsValid())
+		assert.False(t, (&User{Role: RoleViewer, Rules: []Rule{{Path: "/docs"}}}).IsValid())
+		assert.True(t, (&User{Role: RoleViewer}).IsValid())
+		assert.True(t, editor.IsValid())
+	})
+
+	t.Run("Allows", func(t *testing.T) {
+		assert.True(t, editor.Allows(module.Files, "/docs", Write))
+		assert.True(t, editor.Allows(module.Files, "docs/foo/bar", Write))
+		assert.False(t, editor.Allows(module.Files, "/docsfoo", Read))
+		assert.True(t, editor.Allows(module.Files, "/docs/../foo", Read))
+		assert.False(t, editor.Allows(module.Files, "/foo/../docs", Read))
+		assert.False(t, editor.Allows(module.Files, "", Read))
+
+		assert.True(t, editor.Allows(module.Files, "/photos/foo.jpg", Read))
+		assert.False(t, editor.Allows(module.Files, "/photos/foo.jpg", Write))
+
+		assert.True(t, editor.Allows(module.Gallery, "2023/japan/tokyo.jpg", Read))
+		assert.False(t, editor.Allows(module.Gallery, "2022", Read))
+	})
+
+	t.Run("Allows/roles", func(t *testing.T) {
+		admin := &User{Role: RoleAdmin, Rules: editor.Rules}
+		assert.True(t, admin.Allows(module.Gallery, "2022", Write))
+
+		viewer := &User{Role: RoleViewer, Rules: editor.Rules}
+		assert.True(t, viewer.Allows(module.Files, "/docs", Read))
+		assert.False(t, viewer.Allows(module.Files, "/docs", Write))
+
+		unrestricted := &User{Role: RoleEditor}
+		assert.True(t, unrestricted.Allows(module.Gallery, "", Write))
+	})
+
+	t.Run("AllowsModule", func(t *testing.T) {
+		assert.True(t, editor.AllowsModule(module.Files, Write))
+		assert.True(t, editor.AllowsModule(module.Gallery, Read))
+
+		viewer := &User{Role: RoleViewer, Rules: []Rule{{Module: module.Gallery}}}
+		assert.True(t, viewer.AllowsModule(module.Gallery, Read))
+		assert.False(t, viewer.AllowsModule(module.Gallery, Write))
+		assert.False(t, viewer.AllowsModule(module.Files, Read))
+	})
+
+	t.Run("AllowsWithin", func(t *testing.T) {
+		viewer := &User{Role: RoleViewer, Rules: []Rule{{Module: module.Files, Path: "/foo/bar"}}}
+		assert.True(t, viewer.AllowsWithin(module.Files, "/", Read))
+		assert.True(t, viewer.AllowsWithin(module.Files, "/foo", Read))
+		assert.True(t, viewer.AllowsWithin(module.Files, "/foo/bar/baz", Read))
+		assert.False(t, viewer.AllowsWithin(module.Files, "/foobar", Read))
+		assert.False(t, viewer.AllowsWithin(module.Files, "/foo/baz", Read))
+		assert.False(t, viewer.AllowsWithin(module.Files, "/foo", Write))
+		assert.False(t, viewer.AllowsWithin(module.Gallery, "/", Read))
+	})
+}
+
+func TestPermissions(t *testing.T) {
+	assert.NoError(t, Permissions{"foo": {Role: RoleAdmin}}.Validate())
+	assert.Error(t, Permissions{"foo": {Role: "owner"}}.Validate())
+	assert.Error(t, Permissions{"foo": nil}.Validate())
+}
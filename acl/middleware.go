@@ -0,0 +1,97 @@
+package acl
+
+import (
+	"context"
+	"net/http"
+	"path"
+
+	"github.com/go-chi/chi"
+
+	"github.com/ap4y/cloud/contextkey"
+	"github.com/ap4y/cloud/module"
+)
+
+// Authorizer returns middleware that places permissions of the
+// authenticated user into the request context. Users without
+// permissions are forbidden.
+func Authorizer(permissions Provider) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			username, _ := req.Context().Value(contextkey.UsernameCtxKey).(string)
+			user, ok := permissions.User(username)
+			if !ok {
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), contextkey.UserCtxKey, user)))
+		})
+	}
+}
+
+// AdminHandler responds with Forbidden for users that are not
+// admins.
+func AdminHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		user, ok := req.Context().Value(contextkey.UserCtxKey).(*User)
+		if !ok || user.Role != RoleAdmin {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
+
+// Allowed returns true if user from the request context has access a
+// to the path p of the module m. Requests without user are allowed.
+func Allowed(req *http.Request, m module.Type, p string, a Access) bool {
+	user, ok := req.Context().Value(contextkey.UserCtxKey).(*User)
+	return !ok || user.Allows(m, p, a)
+}
+
+// Visible returns true if user from the request context has access a
+// to the path p of the module m or to any path inside of it. Requests
+// without user are allowed.
+func Visible(req *http.Request, m module.Type, p string, a Access) bool {
+	user, ok := req.Context().Value(contextkey.UserCtxKey).(*User)
+	return !ok || user.AllowsWithin(m, p, a)
+}
+
+// ModuleHandler returns middleware that responds with Forbidden if
+// user from the request context has no access a to the module m.
+func ModuleHandler(m module.Type, a Access) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			user, ok := req.Context().Value(contextkey.UserCtxKey).(*User)
+			if ok && !user.AllowsModule(m, a) {
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+// VerifyHandler verifies user from the context against path composed
+// from name and optional item parameters. Empty name parameter
+// refers to the whole module.
+func VerifyHandler(m module.Type, a Access, nameParam, itemParam string, next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		p := ""
+		if nameParam != "" {
+			p = chi.URLParam(req, nameParam)
+		}
+		if itemParam != "" {
+			p = path.Join(p, chi.URLParam(req, itemParam))
+		}
+
+		if !Allowed(req, m, p, a) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,156 @@
+package acl
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ap4y/cloud/contextkey"
+	"github.com/ap4y/cloud/module"
+)
+
+func TestAuthorizer(t *testing.T) {
+	user := &User{Role: RoleViewer}
+	handler := Authorizer(Permissions{"foo": user})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, user, r.Context().Value(contextkey.UserCtxKey))
+		io.WriteString(w, "Hello World!") // nolint: errcheck
+	}))
+
+	tcs := []struct {
+		username string
+		status   int
+	}{
+		{"foo", http.StatusOK},
+		{"bar", http.StatusForbidden},
+		{"", http.StatusForbidden},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.username, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://example.com/foo", nil)
+			w := httptest.NewRecorder()
+
+			ctx := context.WithValue(req.Context(), contextkey.UsernameCtxKey, tc.username)
+			handler.ServeHTTP(w, req.WithContext(ctx))
+			assert.Equal(t, tc.status, w.Result().StatusCode)
+		})
+	}
+}
+
+func TestModuleHandler(t *testing.T) {
+	user := &User{Role: RoleViewer, Rules: []Rule{{Module: module.Gallery, Path: "album1"}}}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "Hello World!") // nolint: errcheck
+	}
+
+	tcs := []struct {
+		name   string
+		user   *User
+		module module.Type
+		access Access
+		status int
+	}{
+		{"without user", nil, module.Files, Write, http.StatusOK},
+		{"allowed", user, module.Gallery, Read, http.StatusOK},
+		{"read only", user, module.Gallery, Write, http.StatusForbidden},
+		{"other module", user, module.Files, Read, http.StatusForbidden},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://example.com/foo", nil)
+			w := httptest.NewRecorder()
+
+			if tc.user != nil {
+				req = req.WithContext(context.WithValue(req.Context(), contextkey.UserCtxKey, tc.user))
+			}
+			ModuleHandler(tc.module, tc.access)(http.HandlerFunc(handler)).ServeHTTP(w, req)
+			assert.Equal(t, tc.status, w.Result().StatusCode)
+		})
+	}
+}
+
+func TestVerifyHandler(t *testing.T) {
+	user := &User{Role: RoleEditor, Rules: []Rule{
+		{Module: module.Gallery, Path: "album1"},
+		{Module: module.Gallery, Path: "album2/test.jpg", ReadOnly: true},
+	}}
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "Hello World!") // nolint: errcheck
+	}
+
+	mux := chi.NewRouter()
+	mux.Get("/", VerifyHandler(module.Gallery, Read, "", "", handler))
+	mux.Get("/{path}", VerifyHandler(module.Gallery, Read, "path", "", handler))
+	mux.Get("/{path}/file/{file}", VerifyHandler(module.Gallery, Read, "path", "file", handler))
+	mux.Post("/{path}/file/{file}", VerifyHandler(module.Gallery, Write, "path", "file", handler))
+
+	tcs := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{"GET", "/", http.StatusForbidden},
+		{"GET", "/album1", http.StatusOK},
+		{"GET", "/album2", http.StatusForbidden},
+		{"GET", "/album1/file/test.jpg", http.StatusOK},
+		{"GET", "/album2/file/test.jpg", http.StatusOK},
+		{"GET", "/album2/file/test2.jpg", http.StatusForbidden},
+		{"POST", "/album1/file/test.jpg", http.StatusOK},
+		{"POST", "/album2/file/test.jpg", http.StatusForbidden},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.method+tc.path, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "http://example.com"+tc.path, nil)
+			w := httptest.NewRecorder()
+
+			ctx := context.WithValue(req.Context(), contextkey.UserCtxKey, user)
+			mux.ServeHTTP(w, req.WithContext(ctx))
+			assert.Equal(t, tc.status, w.Result().StatusCode)
+		})
+	}
+
+	t.Run("without user", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "http://example.com/", nil)
+		w := httptest.NewRecorder()
+
+		mux.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	})
+}
+
+func TestAdminHandler(t *testing.T) {
+	handler := AdminHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "Hello World!") // nolint: errcheck
+	}))
+
+	tcs := []struct {
+		name   string
+		user   *User
+		status int
+	}{
+		{"without user", nil, http.StatusForbidden},
+		{"admin", &User{Role: RoleAdmin}, http.StatusOK},
+		{"editor", &User{Role: RoleEditor}, http.StatusForbidden},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://example.com/foo", nil)
+			w := httptest.NewRecorder()
+
+			if tc.user != nil {
+				req = req.WithContext(context.WithValue(req.Context(), contextkey.UserCtxKey, tc.user))
+			}
+			handler.ServeHTTP(w, req)
+			assert.Equal(t, tc.status, w.Result().StatusCode)
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"github.com/ap4y/cloud/contextkey"
+	"github.com/ap4y/cloud/internal/httputil"
+	"github.com/ap4y/cloud/throttle"
+)
+
+// ErrAppPasswordNotFound returned for unknown app password ids.
+var ErrAppPasswordNotFound = errors.New("app password not found")
+
+// AppPassword describes a generated password of a user for HTTP
+// Basic clients, e.g. WebDAV.
+type AppPassword struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AppPasswordStorage manages app passwords of users. App passwords
+// are the only way to use HTTP Basic authentication for users with
+// enabled second factor, they are removed when password of a user
+// changes.
+type AppPasswordStorage interface {
+	// AppPasswords returns app passwords of a user sorted by creation
+	// time.
+	AppPasswords(username string) ([]AppPassword, error)
+	// CreateAppPassword generates a new app password of a user, the
+	// password is returned only once.
+	CreateAppPassword(username, name string) (*AppPassword, string, error)
+	// RemoveAppPassword revokes app password of a user.
+	RemoveAppPassword(username, id string) error
+	// CheckAppPassword returns error if password doesn't match to any
+	// app password of a user.
+	CheckAppPassword(username, password string) error
+}
+
+type appPasswordHandler struct {
+	storage     AppPasswordStorage
+	credentials CredentialsStorage
+	twoFactor   TwoFactorStorage
+	throttle    *throttle.Throttle
+}
+
+func (ah *appPasswordHandler) list(w http.ResponseWriter, req *http.Request) {
+	username, _ := req.Context().Value(contextkey.UsernameCtxKey).(string)
+	passwords, err := ah.storage.AppPasswords(username)
+	if err != nil {
+		httputil.Error(w, fmt.Sprintf("Failed to list app passwords: %s", err), userErrorStatus(err))
+		return
+	}
+
+	httputil.Respond(w, passwords)
+}
+
+func (ah *appPasswordHandler) create(w http.ResponseWriter, req *http.Request) {
+	body := map[string]string{}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		httputil.Error(w, fmt.Sprintf("Failed to decode json: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	username, _ := req.Context().Value(contextkey.UsernameCtxKey).(string)
+	keys := signInThrottleKeys(ah.throttle.ClientIP(req), username)
+	wait, done := ah.throttle.Attempt(keys...)
+	if wait > 0 {
+		throttle.Reject(w, wait)
+		return
+	}
+
+	err := ah.verify(username, body["current_password"], body["code"])
+	done(err == nil)
+	if err != nil {
+		httputil.Error(w, fmt.Sprintf("Failed to create app password: %s", err), userErrorStatus(err))
+		return
+	}
+
+	appPassword, password, err := ah.storage.CreateAppPassword(username, body["name"])
+	if err != nil {
+		httputil.Error(w, fmt.Sprintf("Failed to create app password: %s", err), userErrorStatus(err))
+		return
+	}
+
+	httputil.Respond(w, struct {
+		*AppPassword
+		Password string `json:"password"`
+	}{appPassword, password})
+}
+
+func (ah *appPasswordHandler) remove(w http.ResponseWriter, req *http.Request) {
+	username, _ := req.Context().Value(contextkey.UsernameCtxKey).(string)
+	if err := ah.storage.RemoveAppPassword(username, chi.URLParam(req, "id")); err != nil {
+		httputil.Error(w, fmt.Sprintf("Failed to remove app password: %s", err), userErrorStatus(err))
+		return
+	}
+
+	httputil.Respond(w, map[string]string{})
+}
+
+// verify checks current password of a user, code of the second
+// factor is required only if it's enabled.
+func (ah *appPasswordHandler) verify(username, password, code string) error {
+	if err := ah.credentials.CheckPassword(username, password); err != nil {
+		return err
+	}
+
+	if ah.twoFactor == nil || !ah.twoFactor.TwoFactorEnabled(username) {
+		return nil
+	}
+
+	return ah.twoFactor.VerifyTwoFactor(username, code)
+}
+
+// newAppPassword returns a random app password and it's hash.
+func newAppPassword() (string, string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", fmt.Errorf("failed to generate app password: %s", err)
+	}
+
+	password := hex.EncodeToString(buf)
+	return password, hashAppPassword(password), nil
+}
+
+// hashAppPassword returns hash of an app password, app passwords are
+// random so a fast hash is sufficient.
+func hashAppPassword(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ap4y/cloud/acl"
+)
+
+func TestAppPasswords(t *testing.T) {
+	dir, err := ioutil.TempDir("", "users")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cfg := TokenConfig{SigningMethod: jwt.SigningMethodHS256, SignKey: []byte("secret")}
+	storage, err := NewDiskUserStorage(filepath.Join(dir, "users.json"), cfg)
+	require.NoError(t, err)
+	require.NoError(t, storage.Create(User{Username: "foo", Permissions: &acl.User{Role: acl.RoleViewer}}, "password"))
+
+	tokens, err := storage.Authenticate("foo", "password")
+	require.NoError(t, err)
+
+	handler := AuthHandler(storage, nil)
+	do := func(method, path, body string) *http.Response {
+		req := httptest.NewRequest(method, "http://cloud.api"+path, strings.NewReader(body))
+		req.AddCookie(&http.Cookie{Name: tokenCookieKey, Value: tokens.Token})
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	basic := BasicAuthenticator(storage, "cloud", nil)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	basicAuth := func(password string) int {
+		req := httptest.NewRequest("GET", "http://cloud.api/", nil)
+		req.SetBasicAuth("foo", password)
+
+		w := httptest.NewRecorder()
+		basic.ServeHTTP(w, req)
+		return w.Result().StatusCode
+	}
+
+	var created struct {
+		AppPassword
+		Password string `json:"password"`
+	}
+
+	t.Run("Create", func(t *testing.T) {
+		res := do("POST", "/app_passwords", `{"name":"webdav"}`)
+		require.Equal(t, http.StatusBadRequest, res.StatusCode)
+		res = do("POST", "/app_passwords", `{"name":"webdav","current_password":"invalid"}`)
+		require.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+		res = do("POST", "/app_passwords", `{"name":"webdav","current_password":"password"}`)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&created))
+		assert.Equal(t, "webdav", created.Name)
+		assert.NotEmpty(t, created.ID)
+		assert.NotEmpty(t, created.Password)
+
+		res = do("GET", "/app_passwords", "")
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		passwords := []AppPassword{}
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&passwords))
+		require.Len(t, passwords, 1)
+		assert.Equal(t, created.ID, passwords[0].ID)
+	})
+
+	t.Run("BasicAuthenticator", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, basicAuth("password"))
+		assert.Equal(t, http.StatusOK, basicAuth(created.Password))
+		assert.Equal(t, http.StatusUnauthorized, basicAuth("invalid"))
+
+		assert.Error(t, storage.CheckPassword("foo", created.Password))
+		_, err := storage.Authenticate("foo", created.Password)
+		assert.Error(t, err)
+	})
+
+	t.Run("BasicAuthenticator/two factor", func(t *testing.T) {
+		enrollment, err := storage.EnrollTwoFactor("foo")
+		require.NoError(t, err)
+		code, err := totpCode(enrollment.Secret, time.Now().Unix()/totpPeriod)
+		require.NoError(t, err)
+		_, err = storage.ConfirmTwoFactor("foo", code)
+		require.NoError(t, err)
+
+		assert.Equal(t, ErrTwoFactorRequired, checkBasicPassword(storage, "foo", "password"))
+		assert.NoError(t, checkBasicPassword(storage, "foo", created.Password))
+
+		res := do("POST", "/app_passwords", `{"current_password":"password"}`)
+		require.Equal(t, http.StatusUnprocessableEntity, res.StatusCode)
+
+		code, err = totpCode(enrollment.Secret, time.Now().Unix()/totpPeriod+1)
+		require.NoError(t, err)
+		res = do("POST", "/app_passwords", `{"current_password":"password","code":"`+code+`"}`)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		passwords, err := storage.AppPasswords("foo")
+		require.NoError(t, err)
+		require.Len(t, passwords, 2)
+		require.NoError(t, storage.RemoveAppPassword("foo", passwords[1].ID))
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, do("DELETE", "/app_passwords/foo", "").StatusCode)
+		assert.Equal(t, http.StatusOK, do("DELETE", "/app_passwords/"+created.ID, "").StatusCode)
+
+		assert.Error(t, storage.CheckAppPassword("foo", created.Password))
+		passwords, err := storage.AppPasswords("foo")
+		require.NoError(t, err)
+		assert.Len(t, passwords, 0)
+	})
+
+	t.Run("SetPassword", func(t *testing.T) {
+		_, password, err := storage.CreateAppPassword("foo", "")
+		require.NoError(t, err)
+
+		require.NoError(t, storage.SetPassword("foo", "password"))
+		assert.Error(t, storage.CheckAppPassword("foo", password))
+		passwords, err := storage.AppPasswords("foo")
+		require.NoError(t, err)
+		assert.Len(t, passwords, 0)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		_, password, err := storage.CreateAppPassword("foo", "")
+		require.NoError(t, err)
+		require.NoError(t, storage.CheckAppPassword("foo", password))
+
+		require.NoError(t, storage.Update(User{Username: "foo", Disabled: true, Permissions: &acl.User{Role: acl.RoleViewer}}))
+		assert.Error(t, storage.CheckAppPassword("foo", password))
+	})
+}
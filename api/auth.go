@@ -2,94 +2,125 @@ package api
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sync"
+	"time"
 
-	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/go-chi/chi"
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/ap4y/cloud/contextkey"
 	"github.com/ap4y/cloud/internal/httputil"
+	"github.com/ap4y/cloud/throttle"
 )
 
 // UserAuthKey defines usename key in jwt token.
 const UserAuthKey = "user"
 
-const tokenCookieKey = "token"
+const (
+	tokenCookieKey        = "token"
+	refreshTokenCookieKey = "refresh_token"
+	// refreshCookiePath limits refresh token cookie to the refresh
+	// endpoint.
+	refreshCookiePath = "/api/user/refresh"
+)
 
 // CredentialsStorage stores and validates user credentials.
 type CredentialsStorage interface {
-	// Authenticate returns jwt token if provided password matches to a
+	// Authenticate returns jwt tokens if provided password matches to a
 	// stored hash for a given user, error returned otherwise.
-	Authenticate(username, password string) (tokenString string, err error)
-	// Validate validates provided jwt token against stored credentials.
+	Authenticate(username, password string) (*Tokens, error)
+	// CheckPassword returns error if password doesn't match to a
+	// stored hash of a user.
+	CheckPassword(username, password string) error
+	// Validate validates provided jwt access token against stored credentials.
 	Validate(tokenString string) (username string, err error)
+	// Refresh exchanges valid refresh token for a new pair of tokens.
+	// Refresh token is revoked by the exchange, so it can be used only
+	// once even by concurrent requests.
+	Refresh(refreshToken string) (*Tokens, error)
+	// Revoke invalidates provided access or refresh token and all
+	// tokens of it's session.
+	Revoke(tokenString string) error
 }
 
 type memoryCredentialsStorage struct {
-	hashes        map[string]string
-	signingMethod jwt.SigningMethod
-	signKey       interface{}
+	hashes map[string]string
+	tokens *tokenIssuer
 }
 
 // NewMemoryCredentialsStorage returns a new CredentialsStorage that stores user credentials in memory.
-func NewMemoryCredentialsStorage(hashes map[string]string, signingMethod jwt.SigningMethod, signKey interface{}) CredentialsStorage {
-	return &memoryCredentialsStorage{hashes, signingMethod, signKey}
+func NewMemoryCredentialsStorage(hashes map[string]string, cfg TokenConfig) (CredentialsStorage, error) {
+	tokens, err := newTokenIssuer(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("revocations: %s", err)
+	}
+
+	return &memoryCredentialsStorage{hashes, tokens}, nil
 }
 
-func (cs *memoryCredentialsStorage) Authenticate(username, password string) (string, error) {
+func (cs *memoryCredentialsStorage) Authenticate(username, password string) (*Tokens, error) {
+	if err := cs.CheckPassword(username, password); err != nil {
+		return nil, err
+	}
+
+	return cs.tokens.issue(username, 0, "")
+}
+
+func (cs *memoryCredentialsStorage) CheckPassword(username, password string) error {
 	hashedPassword := cs.hashes[username]
 	if hashedPassword == "" {
-		return "", fmt.Errorf("invalid username or password")
+		return fmt.Errorf("invalid username or password")
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password)); err != nil {
-		return "", fmt.Errorf("invalid username or password")
-	}
-
-	token := jwt.NewWithClaims(cs.signingMethod, jwt.MapClaims{UserAuthKey: username})
-	tokenString, err := token.SignedString(cs.signKey)
-	if err != nil {
-		return "", fmt.Errorf("failed to sign token: %s", err)
+		return fmt.Errorf("invalid username or password")
 	}
 
-	return tokenString, nil
+	return nil
 }
 
 func (cs *memoryCredentialsStorage) Validate(tokenString string) (string, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if token.Method != cs.signingMethod {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-
-		return cs.signKey, nil
-	})
-
-	if err != nil || !token.Valid {
-		return "", fmt.Errorf("invalid token")
+	claims, err := cs.tokens.parse(tokenString, accessTokenType)
+	if err != nil {
+		return "", err
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
+	if hashedPassword := cs.hashes[claims.User]; hashedPassword == "" {
 		return "", fmt.Errorf("invalid token claims")
 	}
 
-	username, ok := claims[UserAuthKey].(string)
-	if !ok {
-		return "", fmt.Errorf("invalid token claims")
+	return claims.User, nil
+}
+
+func (cs *memoryCredentialsStorage) Refresh(refreshToken string) (*Tokens, error) {
+	claims, err := cs.tokens.parse(refreshToken, refreshTokenType)
+	if err != nil {
+		return nil, err
 	}
 
-	if hashedPassword := cs.hashes[username]; hashedPassword == "" {
-		return "", fmt.Errorf("invalid token claims")
+	if hashedPassword := cs.hashes[claims.User]; hashedPassword == "" {
+		return nil, fmt.Errorf("invalid token claims")
+	}
+
+	if err := cs.tokens.revoke(refreshToken); err != nil {
+		return nil, err
 	}
 
-	return username, nil
+	return cs.tokens.issue(claims.User, 0, claims.Session)
+}
+
+func (cs *memoryCredentialsStorage) Revoke(tokenString string) error {
+	return cs.tokens.revokeSession(tokenString)
 }
 
 // AuthHandler returns a new handler for authentication endpoints.
-func AuthHandler(credentials CredentialsStorage) http.Handler {
+// Failed sign in attempts are throttled per client IP and username by
+// optional th.
+func AuthHandler(credentials CredentialsStorage, th *throttle.Throttle) http.Handler {
 	mux := chi.NewRouter()
 	mux.Post("/sign_in", func(w http.ResponseWriter, req *http.Request) {
 		body := map[string]string{}
@@ -99,25 +130,122 @@ func AuthHandler(credentials CredentialsStorage) http.Handler {
 			return
 		}
 
-		token, err := credentials.Authenticate(body["username"], body["password"])
+		keys := signInThrottleKeys(th.ClientIP(req), body["username"])
+		wait, done := th.Attempt(keys...)
+		if wait > 0 {
+			throttle.Reject(w, wait)
+			return
+		}
+
+		if !signIn(w, credentials, body["username"], body["password"]) {
+			done(false)
+			return
+		}
+
+		done(true)
+		th.Reset(keys[1])
+	})
+
+	mux.Post("/refresh", func(w http.ResponseWriter, req *http.Request) {
+		refreshToken, err := req.Cookie(refreshTokenCookieKey)
 		if err != nil {
-			httputil.Error(w, fmt.Sprintf("Failed to authenticate user: %s", err), http.StatusBadRequest)
+			httputil.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
 			return
 		}
 
-		http.SetCookie(w, &http.Cookie{
-			Name:     tokenCookieKey,
-			Value:    token,
-			Path:     "/",
-			SameSite: http.SameSiteStrictMode,
-			HttpOnly: true,
-		})
-		httputil.Respond(w, map[string]string{"token": token})
+		tokens, err := credentials.Refresh(refreshToken.Value)
+		if err != nil {
+			httputil.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		setTokenCookies(w, tokens)
+		httputil.Respond(w, tokens)
+	})
+
+	mux.Post("/sign_out", func(w http.ResponseWriter, req *http.Request) {
+		if cookie, err := req.Cookie(tokenCookieKey); err == nil {
+			credentials.Revoke(cookie.Value) // nolint: errcheck
+		}
+
+		clearCookie(w, tokenCookieKey, "/")
+		clearCookie(w, refreshTokenCookieKey, refreshCookiePath)
+		httputil.Respond(w, map[string]string{})
 	})
 
+	if storage, ok := credentials.(UserStorage); ok {
+		mux.With(Authenticator(credentials)).Post("/password", changePassword(storage))
+	}
+
+	if storage, ok := credentials.(AppPasswordStorage); ok {
+		twoFactor, _ := credentials.(TwoFactorStorage)
+		aph := &appPasswordHandler{storage, credentials, twoFactor, th}
+		mux.Route("/app_passwords", func(r chi.Router) {
+			r.Use(Authenticator(credentials))
+			r.Get("/", aph.list)
+			r.Post("/", aph.create)
+			r.Delete("/{id}", aph.remove)
+		})
+	}
+
+	if storage, ok := credentials.(TwoFactorStorage); ok {
+		tfh := &twoFactorHandler{storage, th}
+		mux.Post("/sign_in/two_factor", tfh.verifyChallenge)
+		mux.Route("/two_factor", func(r chi.Router) {
+			r.Use(Authenticator(credentials))
+			r.Get("/", tfh.status)
+			r.Post("/", tfh.enroll)
+			r.Post("/confirm", tfh.confirm)
+			r.Post("/disable", tfh.disable)
+		})
+	}
+
 	return mux
 }
 
+func setTokenCookies(w http.ResponseWriter, tokens *Tokens) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     tokenCookieKey,
+		Value:    tokens.Token,
+		Path:     "/",
+		Expires:  tokens.ExpiresAt,
+		SameSite: http.SameSiteStrictMode,
+		HttpOnly: true,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     refreshTokenCookieKey,
+		Value:    tokens.RefreshToken,
+		Path:     refreshCookiePath,
+		Expires:  tokens.RefreshExpiresAt,
+		SameSite: http.SameSiteStrictMode,
+		HttpOnly: true,
+	})
+}
+
+func clearCookie(w http.ResponseWriter, name, path string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    "",
+		Path:     path,
+		Expires:  time.Unix(0, 0),
+		MaxAge:   -1,
+		SameSite: http.SameSiteStrictMode,
+		HttpOnly: true,
+	})
+}
+
+// signInThrottleKeys returns throttle keys of the sign in attempts
+// from a client ip for a username.
+func signInThrottleKeys(ip, username string) []string {
+	return []string{clientThrottleKey(ip), "user:" + username}
+}
+
+// clientThrottleKey returns throttle key of the sign in attempts from
+// a client ip.
+func clientThrottleKey(ip string) string {
+	return "sign_in:" + ip
+}
+
 // Authenticator returns authentication middleware.
 func Authenticator(credentials CredentialsStorage) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -139,3 +267,94 @@ func Authenticator(credentials CredentialsStorage) func(next http.Handler) http.
 		})
 	}
 }
+
+// BasicAuthenticator returns HTTP Basic authentication middleware.
+// Successful authentications are cached for a basicAuthCacheTTL to
+// avoid hashing password on every request.
+// Failed attempts are throttled per client IP and username by optional
+// th.
+func BasicAuthenticator(credentials CredentialsStorage, realm string, th *throttle.Throttle) func(next http.Handler) http.Handler {
+	cache := newBasicAuthCache()
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			username, password, ok := req.BasicAuth()
+			if !ok || !cache.Contains(username, password) {
+				keys := signInThrottleKeys(th.ClientIP(req), username)
+				wait, done := th.Attempt(keys...)
+				if wait > 0 {
+					throttle.Reject(w, wait)
+					return
+				}
+
+				// Requests without credentials are not failed attempts.
+				if !ok || checkBasicPassword(credentials, username, password) != nil {
+					done(!ok)
+
+					w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", realm))
+					httputil.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+					return
+				}
+
+				done(true)
+				th.Reset(keys[1])
+				cache.Add(username, password)
+			}
+
+			ctx := context.WithValue(req.Context(), contextkey.UsernameCtxKey, username)
+			next.ServeHTTP(w, req.WithContext(ctx))
+		})
+	}
+}
+
+// checkBasicPassword returns error if password or app password of a
+// user is not valid, users with enabled second factor can use only
+// app passwords.
+func checkBasicPassword(credentials CredentialsStorage, username, password string) error {
+	if storage, ok := credentials.(AppPasswordStorage); ok && storage.CheckAppPassword(username, password) == nil {
+		return nil
+	}
+
+	if storage, ok := credentials.(TwoFactorStorage); ok && storage.TwoFactorEnabled(username) {
+		return ErrTwoFactorRequired
+	}
+
+	return credentials.CheckPassword(username, password)
+}
+
+const basicAuthCacheTTL = time.Minute
+
+type basicAuthCache struct {
+	sync.Mutex
+	entries map[[sha256.Size]byte]time.Time
+}
+
+func newBasicAuthCache() *basicAuthCache {
+	return &basicAuthCache{entries: map[[sha256.Size]byte]time.Time{}}
+}
+
+func (c *basicAuthCache) key(username, password string) [sha256.Size]byte {
+	return sha256.Sum256([]byte(username + ":" + password))
+}
+
+func (c *basicAuthCache) Add(username, password string) {
+	c.Lock()
+	defer c.Unlock()
+
+	now := time.Now()
+	for key, expiresAt := range c.entries {
+		if expiresAt.Before(now) {
+			delete(c.entries, key)
+		}
+	}
+
+	c.entries[c.key(username, password)] = now.Add(basicAuthCacheTTL)
+}
+
+func (c *basicAuthCache) Contains(username, password string) bool {
+	c.Lock()
+	defer c.Unlock()
+
+	expiresAt, ok := c.entries[c.key(username, password)]
+	return ok && expiresAt.After(time.Now())
+}
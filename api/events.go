@@ -0,0 +1,121 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ap4y/cloud/acl"
+	"github.com/ap4y/cloud/contextkey"
+	"github.com/ap4y/cloud/events"
+	"github.com/ap4y/cloud/internal/httputil"
+	"github.com/ap4y/cloud/module"
+	"github.com/ap4y/cloud/share"
+)
+
+// eventsKeepAlive defines interval of comment messages that keep idle
+// event streams open behind proxies.
+const eventsKeepAlive = 30 * time.Second
+
+type eventsHandler struct {
+	broker *events.Broker
+	homes  *events.Homes
+}
+
+// streamEvents streams filesystem events using Server-Sent Events,
+// events are filtered by a share or a user from the request context.
+// Events of home folders are mapped into home of the user or the
+// share owner.
+func (h *eventsHandler) streamEvents(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		httputil.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	sh, _ := req.Context().Value(contextkey.ShareCtxKey).(*share.Share)
+	user, _ := req.Context().Value(contextkey.UserCtxKey).(*acl.User)
+	username, _ := req.Context().Value(contextkey.UsernameCtxKey).(string)
+	if sh != nil {
+		username = sh.Owner
+	}
+
+	ch, cancel := h.broker.Subscribe()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case event := <-ch:
+			event, ok := h.homes.Event(username, event)
+			if !ok {
+				continue
+			}
+
+			if sh != nil && !shareIncludesEvent(sh, event) {
+				continue
+			}
+
+			if user != nil && !userAllowsEvent(user, event) {
+				continue
+			}
+
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+		}
+
+		flusher.Flush()
+	}
+}
+
+// userAllowsEvent returns true if user has read access to event path
+// or it's previous path.
+func userAllowsEvent(user *acl.User, event events.Event) bool {
+	if user.Allows(event.Module, event.Path, acl.Read) {
+		return true
+	}
+
+	return event.OldPath != "" && user.Allows(event.Module, event.OldPath, acl.Read)
+}
+
+// shareIncludesEvent returns true if event path or it's previous path
+// is accessible with a share.
+func shareIncludesEvent(s *share.Share, event events.Event) bool {
+	if s.Type != event.Module {
+		return false
+	}
+
+	includes := func(eventPath string) bool {
+		if eventPath == "" {
+			return false
+		}
+
+		if s.Type == module.Gallery {
+			album, file := path.Split(strings.TrimPrefix(eventPath, "/"))
+			return s.Includes(strings.TrimSuffix(album, "/"), file)
+		}
+
+		return s.IncludesPath(eventPath)
+	}
+
+	return includes(event.Path) || includes(event.OldPath)
+}
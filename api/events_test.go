@@ -0,0 +1,108 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ap4y/cloud/contextkey"
+	"github.com/ap4y/cloud/events"
+	"github.com/ap4y/cloud/module"
+	"github.com/ap4y/cloud/share"
+)
+
+func TestStreamEvents(t *testing.T) {
+	broker := events.NewBroker()
+	eh := &eventsHandler{broker, nil}
+	s := &share.Share{Slug: "foo", Type: module.Files, Name: "/test1", Items: []string{"/test1/inner"}}
+
+	stream := func(t *testing.T, s *share.Share) (*bufio.Reader, func()) {
+		t.Helper()
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if s != nil {
+				req = req.WithContext(context.WithValue(req.Context(), contextkey.ShareCtxKey, s))
+			}
+			eh.streamEvents(w, req)
+		}))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		req, err := http.NewRequest("GET", ts.URL, nil)
+		require.NoError(t, err)
+
+		res, err := ts.Client().Do(req.WithContext(ctx))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+		return bufio.NewReader(res.Body), func() {
+			cancel()
+			res.Body.Close()
+			ts.Close()
+		}
+	}
+
+	readEvent := func(t *testing.T, r *bufio.Reader) string {
+		t.Helper()
+
+		lines := []string{}
+		for {
+			line, err := r.ReadString('\n')
+			require.NoError(t, err)
+			if line == "\n" {
+				return strings.Join(lines, "")
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	t.Run("without share", func(t *testing.T) {
+		r, closeStream := stream(t, nil)
+		defer closeStream()
+
+		broker.Publish(events.Event{Type: events.EventCreated, Module: module.Files, Path: "/foo"})
+		event := readEvent(t, r)
+		assert.True(t, strings.HasPrefix(event, "event: created\ndata: {"))
+		assert.Contains(t, event, `"path":"/foo"`)
+	})
+
+	t.Run("with share", func(t *testing.T) {
+		r, closeStream := stream(t, s)
+		defer closeStream()
+
+		broker.Publish(events.Event{Type: events.EventCreated, Module: module.Files, Path: "/foo"})
+		broker.Publish(events.Event{Type: events.EventCreated, Module: module.Files, Path: "/test1/inner/foo"})
+		event := readEvent(t, r)
+		assert.Contains(t, event, `"path":"/test1/inner/foo"`)
+	})
+}
+
+func TestShareIncludesEvent(t *testing.T) {
+	filesShare := &share.Share{Type: module.Files, Name: "/test1", Items: []string{"/test1/inner"}}
+	galleryShare := &share.Share{Type: module.Gallery, Name: "album1", Items: []string{"test.jpg"}}
+
+	tcs := []struct {
+		share    *share.Share
+		event    events.Event
+		included bool
+	}{
+		{filesShare, events.Event{Module: module.Files, Path: "/test1/inner"}, true},
+		{filesShare, events.Event{Module: module.Files, Path: "/test1/inner/foo"}, true},
+		{filesShare, events.Event{Module: module.Files, Path: "/test1/inner2"}, false},
+		{filesShare, events.Event{Module: module.Files, Path: "/foo", OldPath: "/test1/inner/foo"}, true},
+		{filesShare, events.Event{Module: module.Gallery, Path: "/test1/inner"}, false},
+		{galleryShare, events.Event{Module: module.Gallery, Path: "/album1/test.jpg"}, true},
+		{galleryShare, events.Event{Module: module.Gallery, Path: "/album1/test2.jpg"}, false},
+		{galleryShare, events.Event{Module: module.Gallery, Path: "/album2/test.jpg"}, false},
+	}
+
+	for _, tc := range tcs {
+		assert.Equal(t, tc.included, shareIncludesEvent(tc.share, tc.event), "%v", tc.event)
+	}
+}
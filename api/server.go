@@ -2,56 +2,108 @@ package api
 
 import (
 	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 
+	"github.com/ap4y/cloud/acl"
+	"github.com/ap4y/cloud/contextkey"
+	"github.com/ap4y/cloud/events"
 	"github.com/ap4y/cloud/internal/httputil"
 	"github.com/ap4y/cloud/module"
 	"github.com/ap4y/cloud/share"
+	"github.com/ap4y/cloud/throttle"
 )
 
-// NewServer returns a new root handler for the app.
-func NewServer(modules map[module.Type]http.Handler, cs CredentialsStorage, ss share.Store) (http.Handler, error) {
+// WebDAVPrefix defines path WebDAV handler is mounted on.
+const WebDAVPrefix = "/dav"
+
+func init() {
+	for _, method := range []string{"PROPFIND", "MKCOL", "COPY", "MOVE", "LOCK", "UNLOCK"} {
+		chi.RegisterMethod(method)
+	}
+}
+
+// NewServer returns a new root handler for the app. Authenticated
+// users are restricted by optional permissions. Password protected
+// shares are unlocked using sl. Sign in attempts, share unlocks and
+// lookups of unknown shares are throttled by optional th. Optional dav handler is mounted on
+// WebDAVPrefix. Filesystem events from optional eb are streamed on
+// /api/events, events of a module with home folders are mapped into
+// homes of users by optional homes.
+func NewServer(modules map[module.Type]http.Handler, cs CredentialsStorage, permissions acl.Provider, ss share.Store, sl *share.Locker, th *throttle.Throttle, dav http.Handler, eb *events.Broker, homes *events.Homes) (http.Handler, error) {
 	mux := chi.NewRouter()
 	mux.Use(middleware.Logger)
 
-	sh := &shareHandler{ss}
+	if dav != nil {
+		dav = davAuthorizer(dav)
+		if cs != nil {
+			if permissions != nil {
+				dav = acl.Authorizer(permissions)(dav)
+			}
+			dav = BasicAuthenticator(cs, "cloud", th)(dav)
+		}
+
+		mux.Mount(WebDAVPrefix, dav)
+	}
+
+	sh := &shareHandler{ss, sl, th}
+	eh := &eventsHandler{eb, homes}
 	mux.Route("/api", func(apiMux chi.Router) {
 		if cs != nil {
-			apiMux.Mount("/user", AuthHandler(cs))
+			apiMux.Mount("/user", AuthHandler(cs, th))
 		}
 
 		apiMux.Group(func(r chi.Router) {
 			if cs != nil {
 				r.Use(Authenticator(cs))
+				if permissions != nil {
+					r.Use(acl.Authorizer(permissions))
+				}
 			}
 
-			moduleIds := make([]module.Type, len(modules))
-			idx := 0
-			for module := range modules {
-				moduleIds[idx] = module
-				idx++
-			}
+			r.Get("/modules", func(w http.ResponseWriter, req *http.Request) {
+				user, _ := req.Context().Value(contextkey.UserCtxKey).(*acl.User)
+				moduleIds := make([]module.Type, 0, len(modules))
+				for module := range modules {
+					if user == nil || user.AllowsModule(module, acl.Read) {
+						moduleIds = append(moduleIds, module)
+					}
+				}
 
-			r.Get("/modules", func(w http.ResponseWriter, res *http.Request) {
 				httputil.Respond(w, map[string][]module.Type{"modules": moduleIds})
 			})
 
+			if storage, ok := cs.(UserStorage); ok {
+				r.Mount("/users", acl.AdminHandler(UsersHandler(storage)))
+			}
+
 			r.Get("/shares", sh.listShares)
 			r.Post("/shares", sh.createShare)
 			r.Delete("/shares/{slug}", sh.removeShare)
 
+			if eb != nil {
+				r.Get("/events", eh.streamEvents)
+			}
+
 			for module, handler := range modules {
-				r.Mount("/"+string(module), handler)
+				r.Mount("/"+string(module), acl.ModuleHandler(module, acl.Read)(handler))
 			}
 		})
 
 		apiMux.Route("/share/{slug}", func(r chi.Router) {
-			r.Get("/", sh.getShare)
+			r.Post("/unlock", sh.unlockShare)
 
 			r.Group(func(r chi.Router) {
-				r.Use(share.Authenticator(ss))
+				r.Use(share.Authenticator(ss, sl, th))
+
+				r.Get("/", sh.getShare)
+
+				if eb != nil {
+					r.Get("/events", eh.streamEvents)
+				}
 
 				for module, handler := range modules {
 					r.Mount("/"+string(module), handler)
@@ -62,3 +114,31 @@ func NewServer(modules map[module.Type]http.Handler, cs CredentialsStorage, ss s
 
 	return mux, nil
 }
+
+// davAuthorizer verifies user from the context against paths of the
+// WebDAV request. Modifications and copy destinations require write
+// access.
+func davAuthorizer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		access := acl.Write
+		switch req.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, "PROPFIND", "COPY":
+			access = acl.Read
+		}
+
+		if !acl.Allowed(req, module.Files, strings.TrimPrefix(req.URL.Path, WebDAVPrefix), access) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		if dst := req.Header.Get("Destination"); dst != "" {
+			u, err := url.Parse(dst)
+			if err != nil || !acl.Allowed(req, module.Files, strings.TrimPrefix(u.Path, WebDAVPrefix), acl.Write) {
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
@@ -6,15 +6,27 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/go-chi/chi"
 
+	"github.com/ap4y/cloud/acl"
+	"github.com/ap4y/cloud/contextkey"
 	"github.com/ap4y/cloud/internal/httputil"
+	"github.com/ap4y/cloud/module"
 	"github.com/ap4y/cloud/share"
+	"github.com/ap4y/cloud/throttle"
 )
 
+type apiShare struct {
+	share.Share
+	Protected bool `json:"protected"`
+}
+
 type shareHandler struct {
-	store share.Store
+	store    share.Store
+	locker   *share.Locker
+	throttle *throttle.Throttle
 }
 
 func (sh shareHandler) listShares(w http.ResponseWriter, req *http.Request) {
@@ -24,7 +36,14 @@ func (sh shareHandler) listShares(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	httputil.Respond(w, shares)
+	result := make([]apiShare, 0, len(shares))
+	for idx := range shares {
+		if ownsShare(req, &shares[idx]) && shareAllowed(req, &shares[idx], acl.Read) {
+			result = append(result, toAPIShare(&shares[idx]))
+		}
+	}
+
+	httputil.Respond(w, result)
 }
 
 func (sh shareHandler) getShare(w http.ResponseWriter, req *http.Request) {
@@ -40,16 +59,83 @@ func (sh shareHandler) getShare(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	httputil.Respond(w, share)
+	httputil.Respond(w, toAPIShare(share))
+}
+
+func (sh shareHandler) unlockShare(w http.ResponseWriter, req *http.Request) {
+	slug := chi.URLParam(req, "slug")
+	if slug == "" {
+		httputil.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	ip := sh.throttle.ClientIP(req)
+	keys := []string{share.LookupThrottleKey(ip), "unlock:" + slug}
+	wait, done := sh.throttle.Attempt(keys...)
+	if wait > 0 {
+		throttle.Reject(w, wait)
+		return
+	}
+
+	s, err := sh.store.Get(slug)
+	if err != nil {
+		done(false)
+		httputil.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	if !s.IsProtected() {
+		done(true)
+		httputil.Respond(w, toAPIShare(s))
+		return
+	}
+
+	body := map[string]string{}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		done(true)
+		httputil.Error(w, fmt.Sprintf("Failed to decode json: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if sh.locker == nil {
+		done(true)
+		httputil.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	token, expiresAt, err := sh.locker.Unlock(s, body["password"])
+	if err != nil {
+		done(false)
+		httputil.Error(w, fmt.Sprintf("Failed to unlock share: %s", err), http.StatusUnauthorized)
+		return
+	}
+
+	done(true)
+	sh.throttle.Reset(keys[1])
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     share.UnlockCookieKey,
+		Value:    token,
+		Path:     strings.TrimSuffix(req.URL.Path, "/unlock"),
+		Expires:  expiresAt,
+		SameSite: http.SameSiteStrictMode,
+		HttpOnly: true,
+	})
+	httputil.Respond(w, toAPIShare(s))
 }
 
 func (sh shareHandler) createShare(w http.ResponseWriter, req *http.Request) {
-	var share *share.Share
-	if err := json.NewDecoder(req.Body).Decode(&share); err != nil {
+	var body struct {
+		share.Share
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
 		httputil.Error(w, fmt.Sprintf("Failed to decode json: %s", err), http.StatusBadRequest)
 		return
 	}
 
+	share := &body.Share
+	share.Owner, _ = req.Context().Value(contextkey.UsernameCtxKey).(string)
 	slug := make([]byte, 10)
 	if _, err := rand.Read(slug); err != nil {
 		httputil.Error(w, fmt.Sprintf("Failed to generate slug: %s", err), http.StatusBadRequest)
@@ -62,12 +148,22 @@ func (sh shareHandler) createShare(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if !shareAllowed(req, share, acl.Write) {
+		httputil.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	if err := share.SetPassword(body.Password); err != nil {
+		httputil.Error(w, fmt.Sprintf("Failed to set password: %s", err), http.StatusBadRequest)
+		return
+	}
+
 	if err := sh.store.Save(share); err != nil {
 		httputil.Error(w, fmt.Sprintf("Failed to save: %s", err), http.StatusBadRequest)
 		return
 	}
 
-	httputil.Respond(w, share)
+	httputil.Respond(w, toAPIShare(share))
 }
 
 func (sh shareHandler) removeShare(w http.ResponseWriter, req *http.Request) {
@@ -77,6 +173,17 @@ func (sh shareHandler) removeShare(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	s, err := sh.store.Get(slug)
+	if err != nil || !ownsShare(req, s) {
+		httputil.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	if !shareAllowed(req, s, acl.Write) {
+		httputil.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
 	if err := sh.store.Remove(slug); err != nil {
 		httputil.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 		return
@@ -84,3 +191,37 @@ func (sh shareHandler) removeShare(w http.ResponseWriter, req *http.Request) {
 
 	httputil.Respond(w, map[string]string{})
 }
+
+// ownsShare returns true if share has no owner or it's owned by the
+// user from the request context. Admins own all shares.
+func ownsShare(req *http.Request, s *share.Share) bool {
+	username, _ := req.Context().Value(contextkey.UsernameCtxKey).(string)
+	if s.Owner == "" || s.Owner == username {
+		return true
+	}
+
+	user, ok := req.Context().Value(contextkey.UserCtxKey).(*acl.User)
+	return ok && user.Role == acl.RoleAdmin
+}
+
+// shareAllowed returns true if user from the request context has
+// access a to all shared items.
+func shareAllowed(req *http.Request, s *share.Share, a acl.Access) bool {
+	if s.Type != module.Files {
+		return acl.Allowed(req, s.Type, s.Name, a)
+	}
+
+	for _, item := range s.Items {
+		if !acl.Allowed(req, s.Type, item, a) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func toAPIShare(s *share.Share) apiShare {
+	res := apiShare{Share: *s, Protected: s.IsProtected()}
+	res.PasswordHash = ""
+	return res
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
@@ -14,9 +15,12 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/ap4y/cloud/acl"
+	"github.com/ap4y/cloud/contextkey"
 	"github.com/ap4y/cloud/module"
 	"github.com/ap4y/cloud/niltime"
 	"github.com/ap4y/cloud/share"
+	"github.com/ap4y/cloud/throttle"
 )
 
 func TestShareHandler(t *testing.T) {
@@ -27,9 +31,10 @@ func TestShareHandler(t *testing.T) {
 	store, err := share.NewDiskStore(dir)
 	require.NoError(t, err)
 
-	sh := &shareHandler{store}
+	sh := &shareHandler{store, share.NewLocker([]byte("secret"), time.Minute), nil}
 	handler := chi.NewRouter()
 	handler.Get("/{slug}", sh.getShare)
+	handler.Post("/{slug}/unlock", sh.unlockShare)
 	handler.Delete("/{slug}", sh.removeShare)
 	handler.Post("/", sh.createShare)
 	handler.Get("/", sh.listShares)
@@ -107,4 +112,133 @@ func TestShareHandler(t *testing.T) {
 		res := w.Result()
 		require.Equal(t, http.StatusUnprocessableEntity, res.StatusCode)
 	})
+
+	t.Run("Create - protected", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		body := "{\"type\":\"gallery\",\"name\":\"test\",\"items\":[\"foo\"],\"password\":\"changeme\"}"
+		req := httptest.NewRequest("POST", "http://cloud.api/", strings.NewReader(body))
+		handler.ServeHTTP(w, req)
+
+		res := w.Result()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		resShare := map[string]interface{}{}
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&resShare))
+		assert.Equal(t, true, resShare["protected"])
+		assert.NotContains(t, resShare, "password")
+		assert.NotContains(t, resShare, "password_hash")
+
+		stored, err := store.Get(resShare["slug"].(string))
+		require.NoError(t, err)
+		assert.True(t, stored.IsProtected())
+	})
+
+	t.Run("Unlock", func(t *testing.T) {
+		s := &share.Share{Slug: "bar", Type: module.Gallery, Name: "test", Items: []string{"foo"}}
+		require.NoError(t, s.SetPassword("changeme"))
+		require.NoError(t, store.Save(s))
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "http://cloud.api/bar/unlock", strings.NewReader("{\"password\":\"foo\"}"))
+		handler.ServeHTTP(w, req)
+		require.Equal(t, http.StatusUnauthorized, w.Result().StatusCode)
+
+		w = httptest.NewRecorder()
+		req = httptest.NewRequest("POST", "http://cloud.api/bar/unlock", strings.NewReader("{\"password\":\"changeme\"}"))
+		handler.ServeHTTP(w, req)
+
+		res := w.Result()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		cookies := res.Cookies()
+		require.Len(t, cookies, 1)
+		assert.Equal(t, share.UnlockCookieKey, cookies[0].Name)
+		assert.Equal(t, "/bar", cookies[0].Path)
+		require.NoError(t, sh.locker.Verify(s, cookies[0].Value))
+
+		w = httptest.NewRecorder()
+		req = httptest.NewRequest("POST", "http://cloud.api/baz/unlock", strings.NewReader("{\"password\":\"changeme\"}"))
+		handler.ServeHTTP(w, req)
+		require.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+
+		t.Run("throttled", func(t *testing.T) {
+			sh := &shareHandler{store, sh.locker, throttle.New(throttle.Config{Attempts: 2, Backoff: time.Minute})}
+			handler := chi.NewRouter()
+			handler.Post("/{slug}/unlock", sh.unlockShare)
+
+			unlock := func(remoteAddr, slug, password string) *http.Response {
+				w := httptest.NewRecorder()
+				req := httptest.NewRequest("POST", "http://cloud.api/"+slug+"/unlock", strings.NewReader("{\"password\":\""+password+"\"}"))
+				req.RemoteAddr = remoteAddr
+				handler.ServeHTTP(w, req)
+				return w.Result()
+			}
+
+			require.Equal(t, http.StatusUnauthorized, unlock("1.2.3.4:1234", "bar", "foo").StatusCode)
+			require.Equal(t, http.StatusUnauthorized, unlock("1.2.3.4:1234", "bar", "foo").StatusCode)
+
+			res := unlock("5.6.7.8:1234", "bar", "changeme")
+			require.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+			assertRetryAfter(t, res, time.Minute)
+
+			require.Equal(t, http.StatusNotFound, unlock("5.6.7.8:1234", "baz", "foo").StatusCode)
+			require.Equal(t, http.StatusNotFound, unlock("5.6.7.8:1234", "baz", "foo").StatusCode)
+			require.Equal(t, http.StatusTooManyRequests, unlock("5.6.7.8:1234", "qux", "foo").StatusCode)
+		})
+	})
+
+	t.Run("Permissions", func(t *testing.T) {
+		user := &acl.User{Role: acl.RoleEditor, Rules: []acl.Rule{
+			{Module: module.Gallery, Path: "test"},
+			{Module: module.Gallery, Path: "other", ReadOnly: true},
+		}}
+		do := func(method, path, body string) *http.Response {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(method, "http://cloud.api"+path, strings.NewReader(body))
+			ctx := context.WithValue(req.Context(), contextkey.UserCtxKey, user)
+			handler.ServeHTTP(w, req.WithContext(ctx))
+			return w.Result()
+		}
+
+		require.NoError(t, store.Save(&share.Share{Slug: "qux", Type: module.Gallery, Name: "other", Items: []string{"foo"}}))
+		require.NoError(t, store.Save(&share.Share{Slug: "quux", Type: module.Gallery, Name: "private", Items: []string{"foo"}}))
+
+		res := do("GET", "/", "")
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		shares := make([]*share.Share, 0)
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&shares))
+		for _, s := range shares {
+			assert.NotEqual(t, "private", s.Name)
+		}
+
+		assert.Equal(t, http.StatusOK, do("POST", "/", "{\"type\":\"gallery\",\"name\":\"test\",\"items\":[\"foo\"]}").StatusCode)
+		assert.Equal(t, http.StatusForbidden, do("POST", "/", "{\"type\":\"gallery\",\"name\":\"other\",\"items\":[\"foo\"]}").StatusCode)
+		assert.Equal(t, http.StatusForbidden, do("DELETE", "/qux", "").StatusCode)
+		assert.Equal(t, http.StatusForbidden, do("DELETE", "/quux", "").StatusCode)
+	})
+
+	t.Run("Owner", func(t *testing.T) {
+		do := func(method, path, body, username string) *http.Response {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(method, "http://cloud.api"+path, strings.NewReader(body))
+			ctx := context.WithValue(req.Context(), contextkey.UsernameCtxKey, username)
+			handler.ServeHTTP(w, req.WithContext(ctx))
+			return w.Result()
+		}
+
+		res := do("POST", "/", "{\"type\":\"files\",\"name\":\"/\",\"items\":[\"/foo\"],\"owner\":\"bob\"}", "alice")
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		created := &share.Share{}
+		require.NoError(t, json.NewDecoder(res.Body).Decode(created))
+		assert.Equal(t, "alice", created.Owner)
+
+		res = do("GET", "/", "", "bob")
+		shares := make([]*share.Share, 0)
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&shares))
+		for _, s := range shares {
+			assert.NotEqual(t, created.Slug, s.Slug)
+		}
+
+		assert.Equal(t, http.StatusNotFound, do("DELETE", "/"+created.Slug, "", "bob").StatusCode)
+		assert.Equal(t, http.StatusOK, do("DELETE", "/"+created.Slug, "", "alice").StatusCode)
+	})
 }
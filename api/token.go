@@ -0,0 +1,304 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+const (
+	// DefaultTokenLifetime defines lifetime of the access tokens when it's not configured.
+	DefaultTokenLifetime = time.Hour
+	// DefaultRefreshLifetime defines lifetime of the refresh tokens when it's not configured.
+	DefaultRefreshLifetime = 30 * 24 * time.Hour
+	// TwoFactorChallengeLifetime defines lifetime of the tokens used
+	// for the second sign in step.
+	TwoFactorChallengeLifetime = 5 * time.Minute
+)
+
+const (
+	accessTokenType    = "access"
+	refreshTokenType   = "refresh"
+	twoFactorTokenType = "two_factor"
+)
+
+// Tokens holds a pair of issued access and refresh tokens.
+type Tokens struct {
+	Token            string    `json:"token"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// TokenConfig defines signing and lifetime parameters for issued tokens.
+type TokenConfig struct {
+	SigningMethod   jwt.SigningMethod
+	SignKey         interface{}
+	Lifetime        time.Duration
+	RefreshLifetime time.Duration
+	// RevocationsPath defines file that stores revoked tokens,
+	// revocations are kept only in memory if it's empty.
+	RevocationsPath string
+}
+
+type tokenClaims struct {
+	User string `json:"user"`
+	Type string `json:"type"`
+	// Generation stores token generation of the user at the time of
+	// issue, tokens of previous generations are not valid.
+	Generation int64 `json:"gen,omitempty"`
+	// Session identifies all tokens issued by a sign in and
+	// subsequent refreshes.
+	Session string `json:"sid,omitempty"`
+	jwt.StandardClaims
+}
+
+// tokenIssuer signs, parses and revokes jwt tokens.
+type tokenIssuer struct {
+	cfg     TokenConfig
+	revoked *revocationList
+}
+
+func newTokenIssuer(cfg TokenConfig) (*tokenIssuer, error) {
+	if cfg.Lifetime == 0 {
+		cfg.Lifetime = DefaultTokenLifetime
+	}
+
+	if cfg.RefreshLifetime == 0 {
+		cfg.RefreshLifetime = DefaultRefreshLifetime
+	}
+
+	revoked, err := newRevocationList(cfg.RevocationsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tokenIssuer{cfg, revoked}, nil
+}
+
+// issue returns a new pair of tokens for a session, empty session
+// starts a new one.
+func (ti *tokenIssuer) issue(username string, generation int64, session string) (*Tokens, error) {
+	now := time.Now()
+	if session == "" {
+		var err error
+		if session, err = newTokenID(); err != nil {
+			return nil, fmt.Errorf("failed to generate session id: %s", err)
+		}
+	}
+
+	token, expiresAt, err := ti.sign(username, accessTokenType, generation, session, now, ti.cfg.Lifetime)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, refreshExpiresAt, err := ti.sign(username, refreshTokenType, generation, session, now, ti.cfg.RefreshLifetime)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tokens{token, expiresAt, refreshToken, refreshExpiresAt}, nil
+}
+
+func (ti *tokenIssuer) sign(username, tokenType string, generation int64, session string, now time.Time, lifetime time.Duration) (string, time.Time, error) {
+	jti, err := newTokenID()
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to generate token id: %s", err)
+	}
+
+	expiresAt := now.Add(lifetime)
+	claims := tokenClaims{
+		User:       username,
+		Type:       tokenType,
+		Generation: generation,
+		Session:    session,
+		StandardClaims: jwt.StandardClaims{
+			Id:        jti,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: expiresAt.Unix(),
+		},
+	}
+
+	tokenString, err := jwt.NewWithClaims(ti.cfg.SigningMethod, claims).SignedString(ti.cfg.SignKey)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to sign token: %s", err)
+	}
+
+	return tokenString, time.Unix(expiresAt.Unix(), 0), nil
+}
+
+// parse validates signature, expiry and revocation status of the
+// token. Empty tokenType accepts tokens of any type.
+func (ti *tokenIssuer) parse(tokenString, tokenType string) (*tokenClaims, error) {
+	claims := &tokenClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != ti.cfg.SigningMethod {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+
+		return ti.cfg.SignKey, nil
+	})
+
+	if err != nil || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	if claims.User == "" || claims.Id == "" || claims.ExpiresAt == 0 {
+		return nil, errors.New("invalid token claims")
+	}
+
+	if tokenType != "" && claims.Type != tokenType {
+		return nil, errors.New("invalid token type")
+	}
+
+	if ti.revoked.Contains(claims.Id) || (claims.Session != "" && ti.revoked.Contains(claims.Session)) {
+		return nil, errors.New("token revoked")
+	}
+
+	return claims, nil
+}
+
+func (ti *tokenIssuer) revoke(tokenString string) error {
+	claims, err := ti.parse(tokenString, "")
+	if err != nil {
+		return err
+	}
+
+	return ti.revoked.Add(claims.Id, time.Unix(claims.ExpiresAt, 0))
+}
+
+// revokeSession invalidates provided token and all tokens of it's
+// session. Session tokens can be refreshed until the refresh lifetime
+// from now.
+func (ti *tokenIssuer) revokeSession(tokenString string) error {
+	claims, err := ti.parse(tokenString, "")
+	if err != nil {
+		return err
+	}
+
+	if claims.Session == "" {
+		return ti.revoked.Add(claims.Id, time.Unix(claims.ExpiresAt, 0))
+	}
+
+	return ti.revoked.Add(claims.Session, time.Now().Add(ti.cfg.RefreshLifetime))
+}
+
+func newTokenID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(id), nil
+}
+
+// errAlreadyRevoked returned when revoking already revoked id.
+var errAlreadyRevoked = errors.New("token revoked")
+
+// revocationList stores ids of the revoked tokens and sessions until
+// their expiry. Non-empty path defines file that stores revocations
+// between restarts.
+type revocationList struct {
+	sync.Mutex
+	path string
+	ids  map[string]time.Time
+}
+
+func newRevocationList(path string) (*revocationList, error) {
+	rl := &revocationList{path: path, ids: map[string]time.Time{}}
+	if path == "" {
+		return rl, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return rl, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("file: %s", err)
+	}
+
+	if err := json.Unmarshal(data, &rl.ids); err != nil {
+		return nil, fmt.Errorf("json: %s", err)
+	}
+
+	return rl, nil
+}
+
+// Add revokes id until provided expiry time, expired entries are
+// pruned. errAlreadyRevoked is returned if id was already revoked.
+func (rl *revocationList) Add(id string, expiresAt time.Time) error {
+	rl.Lock()
+	defer rl.Unlock()
+
+	now := time.Now()
+	for jti, exp := range rl.ids {
+		if exp.Before(now) {
+			delete(rl.ids, jti)
+		}
+	}
+
+	if _, ok := rl.ids[id]; ok {
+		return errAlreadyRevoked
+	}
+
+	rl.ids[id] = expiresAt
+	if err := rl.save(); err != nil {
+		delete(rl.ids, id)
+		return err
+	}
+
+	return nil
+}
+
+// save atomically writes revocations into a file, caller has to hold
+// the lock.
+func (rl *revocationList) save() error {
+	if rl.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(rl.ids)
+	if err != nil {
+		return fmt.Errorf("json: %s", err)
+	}
+
+	dir, name := filepath.Split(rl.path)
+	file, err := ioutil.TempFile(dir, "."+name+".")
+	if err != nil {
+		return fmt.Errorf("file: %s", err)
+	}
+	defer os.Remove(file.Name()) // nolint: errcheck
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf("file: %s", err)
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("file: %s", err)
+	}
+
+	if err := os.Rename(file.Name(), rl.path); err != nil {
+		return fmt.Errorf("rename: %s", err)
+	}
+
+	return nil
+}
+
+// Contains returns true if token id was revoked.
+func (rl *revocationList) Contains(id string) bool {
+	rl.Lock()
+	defer rl.Unlock()
+
+	_, ok := rl.ids[id]
+	return ok
+}
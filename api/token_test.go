@@ -0,0 +1,104 @@
+package api
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenIssuer(t *testing.T) {
+	issuer, err := newTokenIssuer(TokenConfig{
+		SigningMethod:   jwt.SigningMethodHS256,
+		SignKey:         []byte("secret"),
+		Lifetime:        time.Minute,
+		RefreshLifetime: time.Hour,
+	})
+	require.NoError(t, err)
+
+	tokens, err := issuer.issue("test", 0, "")
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), tokens.ExpiresAt, time.Second)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), tokens.RefreshExpiresAt, time.Second)
+
+	t.Run("parse", func(t *testing.T) {
+		claims, err := issuer.parse(tokens.Token, accessTokenType)
+		require.NoError(t, err)
+		assert.Equal(t, "test", claims.User)
+		assert.NotEmpty(t, claims.Id)
+		assert.NotZero(t, claims.IssuedAt)
+
+		_, err = issuer.parse(tokens.Token, refreshTokenType)
+		require.Error(t, err)
+
+		claims, err = issuer.parse(tokens.RefreshToken, "")
+		require.NoError(t, err)
+		assert.Equal(t, refreshTokenType, claims.Type)
+	})
+
+	t.Run("parse/other signing key", func(t *testing.T) {
+		other, err := newTokenIssuer(TokenConfig{SigningMethod: jwt.SigningMethodHS256, SignKey: []byte("foo")})
+		require.NoError(t, err)
+		_, err = other.parse(tokens.Token, accessTokenType)
+		require.Error(t, err)
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		require.NoError(t, issuer.revoke(tokens.Token))
+		_, err := issuer.parse(tokens.Token, accessTokenType)
+		require.Error(t, err)
+		require.Error(t, issuer.revoke(tokens.Token))
+
+		_, err = issuer.parse(tokens.RefreshToken, refreshTokenType)
+		require.NoError(t, err)
+	})
+
+	t.Run("revokeSession", func(t *testing.T) {
+		tokens, err := issuer.issue("test", 0, "")
+		require.NoError(t, err)
+
+		claims, err := issuer.parse(tokens.RefreshToken, refreshTokenType)
+		require.NoError(t, err)
+		refreshed, err := issuer.issue("test", 0, claims.Session)
+		require.NoError(t, err)
+
+		require.NoError(t, issuer.revokeSession(tokens.Token))
+		_, err = issuer.parse(tokens.RefreshToken, refreshTokenType)
+		require.Error(t, err)
+		_, err = issuer.parse(refreshed.RefreshToken, refreshTokenType)
+		require.Error(t, err)
+	})
+}
+
+func TestRevocationList(t *testing.T) {
+	rl, err := newRevocationList("")
+	require.NoError(t, err)
+	require.NoError(t, rl.Add("foo", time.Now().Add(-time.Minute)))
+	assert.True(t, rl.Contains("foo"))
+
+	require.NoError(t, rl.Add("bar", time.Now().Add(time.Minute)))
+	assert.False(t, rl.Contains("foo"))
+	assert.True(t, rl.Contains("bar"))
+	assert.Equal(t, errAlreadyRevoked, rl.Add("bar", time.Now().Add(time.Minute)))
+
+	t.Run("persisted", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "revocations")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "revocations.json")
+		rl, err := newRevocationList(path)
+		require.NoError(t, err)
+		require.NoError(t, rl.Add("foo", time.Now().Add(time.Minute)))
+
+		rl, err = newRevocationList(path)
+		require.NoError(t, err)
+		assert.True(t, rl.Contains("foo"))
+		assert.False(t, rl.Contains("bar"))
+	})
+}
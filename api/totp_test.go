@@ -0,0 +1,83 @@
+package api
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTOTP(t *testing.T) {
+	// Base32 encoded "12345678901234567890" from the RFC 6238 test vectors.
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+	t.Run("Code", func(t *testing.T) {
+		tcs := []struct {
+			time int64
+			code string
+		}{
+			{59, "287082"},
+			{1111111109, "081804"},
+			{1234567890, "005924"},
+			{2000000000, "279037"},
+		}
+
+		for _, tc := range tcs {
+			code, err := totpCode(secret, tc.time/totpPeriod)
+			require.NoError(t, err)
+			assert.Equal(t, tc.code, code)
+		}
+
+		_, err := totpCode("invalid!", 1)
+		assert.Error(t, err)
+	})
+
+	t.Run("Match", func(t *testing.T) {
+		now := time.Unix(1111111109, 0)
+		counter := now.Unix() / totpPeriod
+
+		matched, ok := matchTOTP(secret, "081804", now, 0)
+		require.True(t, ok)
+		assert.Equal(t, counter, matched)
+
+		_, ok = matchTOTP(secret, "081804", now.Add(totpPeriod*time.Second), 0)
+		assert.True(t, ok)
+		_, ok = matchTOTP(secret, "081804", now.Add(2*totpPeriod*time.Second), 0)
+		assert.False(t, ok)
+
+		_, ok = matchTOTP(secret, "081804", now, counter)
+		assert.False(t, ok)
+		_, ok = matchTOTP(secret, "000000", now, 0)
+		assert.False(t, ok)
+		_, ok = matchTOTP(secret, "81804", now, 0)
+		assert.False(t, ok)
+	})
+
+	t.Run("Secret", func(t *testing.T) {
+		secret, err := newTOTPSecret()
+		require.NoError(t, err)
+		assert.Len(t, secret, 32)
+
+		uri, err := url.Parse(totpURI("foo", secret))
+		require.NoError(t, err)
+		assert.Equal(t, "otpauth", uri.Scheme)
+		assert.Equal(t, "totp", uri.Host)
+		assert.Equal(t, "/Cloud:foo", uri.Path)
+		assert.Equal(t, secret, uri.Query().Get("secret"))
+		assert.Equal(t, "Cloud", uri.Query().Get("issuer"))
+	})
+
+	t.Run("Recovery codes", func(t *testing.T) {
+		codes, hashes, err := newRecoveryCodes()
+		require.NoError(t, err)
+		require.Len(t, codes, recoveryCodesCount)
+		require.Len(t, hashes, recoveryCodesCount)
+
+		assert.Len(t, codes[0], 11)
+		assert.NotEqual(t, codes[0], codes[1])
+		assert.Equal(t, hashes[0], hashRecoveryCode(codes[0]))
+		assert.Equal(t, hashRecoveryCode("abcde-12345"), hashRecoveryCode(" ABCDE12345 "))
+	})
+}
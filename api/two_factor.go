@@ -0,0 +1,171 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/ap4y/cloud/contextkey"
+	"github.com/ap4y/cloud/internal/httputil"
+	"github.com/ap4y/cloud/throttle"
+)
+
+var (
+	// ErrTwoFactorRequired returned by Authenticate for users with
+	// enabled second factor.
+	ErrTwoFactorRequired = errors.New("two-factor code required")
+	// ErrTwoFactorEnabled returned when enrolling user with enabled
+	// second factor.
+	ErrTwoFactorEnabled = errors.New("two-factor authentication is already enabled")
+	// ErrTwoFactorDisabled returned for operations that require
+	// enabled second factor.
+	ErrTwoFactorDisabled = errors.New("two-factor authentication is not enabled")
+	// ErrInvalidCode returned for invalid or already used one-time and
+	// recovery codes.
+	ErrInvalidCode = errors.New("invalid two-factor code")
+)
+
+// TwoFactorEnrollment holds pending TOTP secret of a user.
+type TwoFactorEnrollment struct {
+	Secret string `json:"secret"`
+	// URI is an otpauth:// URI of the secret for QR codes.
+	URI string `json:"uri"`
+}
+
+// TwoFactorStorage manages TOTP second factor of users. Users with
+// enabled second factor are signed in using a short lived challenge
+// that is exchanged for tokens with a one-time or recovery code.
+type TwoFactorStorage interface {
+	// TwoFactorEnabled returns true if user has confirmed second factor.
+	TwoFactorEnabled(username string) bool
+	// EnrollTwoFactor generates a new pending secret of a user.
+	EnrollTwoFactor(username string) (*TwoFactorEnrollment, error)
+	// ConfirmTwoFactor enables pending secret if code is valid and
+	// returns new recovery codes.
+	ConfirmTwoFactor(username, code string) ([]string, error)
+	// VerifyTwoFactor returns error if code is not a valid one-time or
+	// an unused recovery code of a user. Codes can't be reused.
+	VerifyTwoFactor(username, code string) error
+	// DisableTwoFactor removes second factor of a user.
+	DisableTwoFactor(username string) error
+	// Challenge returns challenge token if password matches to a
+	// stored hash of a user with enabled second factor,
+	// ErrTwoFactorDisabled is returned for remaining users.
+	Challenge(username, password string) (string, error)
+	// VerifyChallenge returns jwt tokens if code is valid for a user
+	// of the challenge. Challenge is revoked after the first attempt.
+	VerifyChallenge(challenge, code string) (*Tokens, error)
+}
+
+// signIn responds with tokens for valid credentials, users with
+// enabled second factor receive a challenge instead. Returns false if
+// credentials are not valid.
+func signIn(w http.ResponseWriter, credentials CredentialsStorage, username, password string) bool {
+	if storage, ok := credentials.(TwoFactorStorage); ok {
+		challenge, err := storage.Challenge(username, password)
+		switch err {
+		case nil:
+			httputil.Respond(w, map[string]interface{}{"two_factor": true, "challenge": challenge})
+			return true
+		case ErrTwoFactorDisabled:
+		default:
+			httputil.Error(w, fmt.Sprintf("Failed to authenticate user: %s", err), http.StatusBadRequest)
+			return false
+		}
+	}
+
+	tokens, err := credentials.Authenticate(username, password)
+	if err != nil {
+		httputil.Error(w, fmt.Sprintf("Failed to authenticate user: %s", err), http.StatusBadRequest)
+		return false
+	}
+
+	setTokenCookies(w, tokens)
+	httputil.Respond(w, tokens)
+	return true
+}
+
+type twoFactorHandler struct {
+	storage  TwoFactorStorage
+	throttle *throttle.Throttle
+}
+
+func (th *twoFactorHandler) verifyChallenge(w http.ResponseWriter, req *http.Request) {
+	body := map[string]string{}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		httputil.Error(w, fmt.Sprintf("Failed to decode json: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	key := clientThrottleKey(th.throttle.ClientIP(req))
+	wait, done := th.throttle.Attempt(key)
+	if wait > 0 {
+		throttle.Reject(w, wait)
+		return
+	}
+
+	tokens, err := th.storage.VerifyChallenge(body["challenge"], body["code"])
+	done(err == nil)
+	if err != nil {
+		httputil.Error(w, fmt.Sprintf("Failed to authenticate user: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	setTokenCookies(w, tokens)
+	httputil.Respond(w, tokens)
+}
+
+func (th *twoFactorHandler) status(w http.ResponseWriter, req *http.Request) {
+	username, _ := req.Context().Value(contextkey.UsernameCtxKey).(string)
+	httputil.Respond(w, map[string]bool{"enabled": th.storage.TwoFactorEnabled(username)})
+}
+
+func (th *twoFactorHandler) enroll(w http.ResponseWriter, req *http.Request) {
+	username, _ := req.Context().Value(contextkey.UsernameCtxKey).(string)
+	enrollment, err := th.storage.EnrollTwoFactor(username)
+	if err != nil {
+		httputil.Error(w, fmt.Sprintf("Failed to enroll: %s", err), userErrorStatus(err))
+		return
+	}
+
+	httputil.Respond(w, enrollment)
+}
+
+func (th *twoFactorHandler) confirm(w http.ResponseWriter, req *http.Request) {
+	body := map[string]string{}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		httputil.Error(w, fmt.Sprintf("Failed to decode json: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	username, _ := req.Context().Value(contextkey.UsernameCtxKey).(string)
+	codes, err := th.storage.ConfirmTwoFactor(username, body["code"])
+	if err != nil {
+		httputil.Error(w, fmt.Sprintf("Failed to confirm: %s", err), userErrorStatus(err))
+		return
+	}
+
+	httputil.Respond(w, map[string][]string{"recovery_codes": codes})
+}
+
+func (th *twoFactorHandler) disable(w http.ResponseWriter, req *http.Request) {
+	body := map[string]string{}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		httputil.Error(w, fmt.Sprintf("Failed to decode json: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	username, _ := req.Context().Value(contextkey.UsernameCtxKey).(string)
+	if err := th.storage.VerifyTwoFactor(username, body["code"]); err != nil {
+		httputil.Error(w, fmt.Sprintf("Failed to disable: %s", err), userErrorStatus(err))
+		return
+	}
+
+	if err := th.storage.DisableTwoFactor(username); err != nil {
+		httputil.Error(w, fmt.Sprintf("Failed to disable: %s", err), userErrorStatus(err))
+		return
+	}
+
+	httputil.Respond(w, map[string]string{})
+}
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ap4y/cloud/acl"
+)
+
+func TestTwoFactor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "users")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cfg := TokenConfig{SigningMethod: jwt.SigningMethodHS256, SignKey: []byte("secret")}
+	storage, err := NewDiskUserStorage(filepath.Join(dir, "users.json"), cfg)
+	require.NoError(t, err)
+	require.NoError(t, storage.Create(User{Username: "foo", Permissions: &acl.User{Role: acl.RoleViewer}}, "password"))
+
+	tokens, err := storage.Authenticate("foo", "password")
+	require.NoError(t, err)
+
+	counter := time.Now().Unix() / totpPeriod
+	code := func(secret string, skew int64) string {
+		code, err := totpCode(secret, counter+skew)
+		require.NoError(t, err)
+		return code
+	}
+
+	handler := AuthHandler(storage, nil)
+	do := func(path, token, body string) *http.Response {
+		req := httptest.NewRequest("POST", "http://cloud.api"+path, strings.NewReader(body))
+		if token != "" {
+			req.AddCookie(&http.Cookie{Name: tokenCookieKey, Value: token})
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	var secret string
+	var recoveryCodes []string
+
+	t.Run("Enroll", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, do("/two_factor", "", "").StatusCode)
+
+		res := do("/two_factor", tokens.Token, "")
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		enrollment := &TwoFactorEnrollment{}
+		require.NoError(t, json.NewDecoder(res.Body).Decode(enrollment))
+		assert.Contains(t, enrollment.URI, "otpauth://totp/Cloud:foo?")
+		secret = enrollment.Secret
+
+		assert.False(t, storage.TwoFactorEnabled("foo"))
+		_, err := storage.Authenticate("foo", "password")
+		assert.NoError(t, err)
+	})
+
+	t.Run("Confirm", func(t *testing.T) {
+		res := do("/two_factor/confirm", tokens.Token, `{"code":"000000"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, res.StatusCode)
+
+		res = do("/two_factor/confirm", tokens.Token, `{"code":"`+code(secret, 0)+`"}`)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		body := map[string][]string{}
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+		recoveryCodes = body["recovery_codes"]
+		require.Len(t, recoveryCodes, recoveryCodesCount)
+
+		assert.True(t, storage.TwoFactorEnabled("foo"))
+		assert.Equal(t, http.StatusConflict, do("/two_factor", tokens.Token, "").StatusCode)
+
+		users, err := storage.Users()
+		require.NoError(t, err)
+		assert.True(t, users[0].TwoFactor)
+	})
+
+	t.Run("Sign in", func(t *testing.T) {
+		_, err := storage.Authenticate("foo", "password")
+		assert.Equal(t, ErrTwoFactorRequired, err)
+
+		res := do("/sign_in", "", `{"username":"foo","password":"invalid"}`)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+		challenge := func() string {
+			res := do("/sign_in", "", `{"username":"foo","password":"password"}`)
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			assert.Empty(t, res.Cookies())
+
+			body := map[string]interface{}{}
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+			assert.Equal(t, true, body["two_factor"])
+
+			_, err := storage.Validate(body["challenge"].(string))
+			assert.Error(t, err)
+
+			return body["challenge"].(string)
+		}
+
+		tcs := []struct {
+			name      string
+			challenge string
+			code      string
+			status    int
+		}{
+			{"invalid challenge", tokens.Token, code(secret, 1), http.StatusBadRequest},
+			{"invalid code", challenge(), "000000", http.StatusBadRequest},
+			{"reused code", challenge(), code(secret, 0), http.StatusBadRequest},
+			{"valid code", challenge(), code(secret, 1), http.StatusOK},
+			{"recovery code", challenge(), recoveryCodes[0], http.StatusOK},
+			{"used recovery code", challenge(), recoveryCodes[0], http.StatusBadRequest},
+		}
+
+		for _, tc := range tcs {
+			t.Run(tc.name, func(t *testing.T) {
+				res := do("/sign_in/two_factor", "", `{"challenge":"`+tc.challenge+`","code":"`+tc.code+`"}`)
+				require.Equal(t, tc.status, res.StatusCode)
+				if res.StatusCode != http.StatusOK {
+					return
+				}
+
+				assert.Len(t, res.Cookies(), 2)
+				tokens := &Tokens{}
+				require.NoError(t, json.NewDecoder(res.Body).Decode(tokens))
+				_, err := storage.Validate(tokens.Token)
+				assert.NoError(t, err)
+			})
+		}
+
+		t.Run("single attempt", func(t *testing.T) {
+			c := challenge()
+			res := do("/sign_in/two_factor", "", `{"challenge":"`+c+`","code":"000000"}`)
+			require.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+			res = do("/sign_in/two_factor", "", `{"challenge":"`+c+`","code":"`+recoveryCodes[1]+`"}`)
+			require.Equal(t, http.StatusBadRequest, res.StatusCode)
+		})
+	})
+
+	t.Run("Disable", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnprocessableEntity, do("/two_factor/disable", tokens.Token, `{"code":"000000"}`).StatusCode)
+		assert.Equal(t, http.StatusOK, do("/two_factor/disable", tokens.Token, `{"code":"`+recoveryCodes[1]+`"}`).StatusCode)
+
+		assert.False(t, storage.TwoFactorEnabled("foo"))
+		_, err := storage.Authenticate("foo", "password")
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusUnprocessableEntity, do("/two_factor/disable", tokens.Token, `{"code":"`+recoveryCodes[2]+`"}`).StatusCode)
+	})
+
+	t.Run("Reset", func(t *testing.T) {
+		_, err := storage.EnrollTwoFactor("foo")
+		require.NoError(t, err)
+
+		users := UsersHandler(storage)
+		w := httptest.NewRecorder()
+		users.ServeHTTP(w, httptest.NewRequest("DELETE", "http://cloud.api/foo/two_factor", nil))
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+
+		w = httptest.NewRecorder()
+		users.ServeHTTP(w, httptest.NewRequest("DELETE", "http://cloud.api/foo/two_factor", nil))
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Result().StatusCode)
+	})
+}
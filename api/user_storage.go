@@ -0,0 +1,664 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/ap4y/cloud/acl"
+	"github.com/ap4y/cloud/internal/pathutil"
+)
+
+// MinPasswordLength defines minimum length of user passwords.
+const MinPasswordLength = 8
+
+var (
+	// ErrUserExists returned when creating user with a taken username.
+	ErrUserExists = errors.New("user already exists")
+	// ErrUserNotFound returned for operations on unknown users.
+	ErrUserNotFound = errors.New("user not found")
+	// ErrInvalidUser returned for users with invalid usernames or
+	// without valid permissions.
+	ErrInvalidUser = errors.New("invalid user")
+	// ErrInvalidPassword returned for passwords shorter than MinPasswordLength.
+	ErrInvalidPassword = errors.New("password is too short")
+	// ErrLastAdmin returned for changes that leave no enabled admins.
+	ErrLastAdmin = errors.New("last admin can't be removed")
+)
+
+// User represents a user account without credentials.
+type User struct {
+	Username    string    `json:"username"`
+	Disabled    bool      `json:"disabled"`
+	Permissions *acl.User `json:"permissions"`
+	// TwoFactor is true for users with enabled second factor, it's
+	// ignored on updates.
+	TwoFactor bool `json:"two_factor"`
+}
+
+// UserStorage stores and validates credentials of user accounts that
+// can be managed at runtime. Disabled users are not authenticated
+// and tokens issued before password change are not valid. Usernames
+// are valid folder names without colons, at least one enabled admin
+// is kept.
+type UserStorage interface {
+	CredentialsStorage
+	TwoFactorStorage
+	AppPasswordStorage
+	acl.Provider
+	// Users returns all users sorted by username.
+	Users() ([]User, error)
+	// Create adds a new user with a password.
+	Create(user User, password string) error
+	// Import adds a new user with a bcrypt password hash.
+	Import(user User, passwordHash string) error
+	// Update replaces disabled flag and permissions of a user.
+	Update(user User) error
+	// SetPassword replaces password of a user.
+	SetPassword(username, password string) error
+	// Remove removes a user.
+	Remove(username string) error
+}
+
+type userRecord struct {
+	PasswordHash      string              `json:"password_hash"`
+	PasswordChangedAt time.Time           `json:"password_changed_at"`
+	TokenGeneration   int64               `json:"token_generation,omitempty"`
+	Disabled          bool                `json:"disabled,omitempty"`
+	Permissions       *acl.User           `json:"permissions,omitempty"`
+	TOTPSecret        string              `json:"totp_secret,omitempty"`
+	TOTPPending       string              `json:"totp_pending,omitempty"`
+	TOTPCounter       int64               `json:"totp_counter,omitempty"`
+	RecoveryCodes     []string            `json:"recovery_codes,omitempty"`
+	AppPasswords      []appPasswordRecord `json:"app_passwords,omitempty"`
+}
+
+type appPasswordRecord struct {
+	AppPassword
+	Hash string `json:"hash"`
+}
+
+type diskUserStorage struct {
+	sync.RWMutex
+	path   string
+	users  map[string]*userRecord
+	tokens *tokenIssuer
+}
+
+// NewDiskUserStorage returns a new UserStorage that stores user
+// accounts in a json file at path.
+func NewDiskUserStorage(path string, cfg TokenConfig) (UserStorage, error) {
+	if path == "" {
+		return nil, errors.New("path can't be empty")
+	}
+
+	tokens, err := newTokenIssuer(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("revocations: %s", err)
+	}
+
+	us := &diskUserStorage{path: path, users: map[string]*userRecord{}, tokens: tokens}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return us, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("file: %s", err)
+	}
+
+	if err := json.Unmarshal(data, &us.users); err != nil {
+		return nil, fmt.Errorf("json: %s", err)
+	}
+
+	return us, nil
+}
+
+func (us *diskUserStorage) Authenticate(username, password string) (*Tokens, error) {
+	if err := us.CheckPassword(username, password); err != nil {
+		return nil, err
+	}
+
+	if us.TwoFactorEnabled(username) {
+		return nil, ErrTwoFactorRequired
+	}
+
+	return us.issue(username, "")
+}
+
+func (us *diskUserStorage) Validate(tokenString string) (string, error) {
+	claims, err := us.tokens.parse(tokenString, accessTokenType)
+	if err != nil {
+		return "", err
+	}
+
+	if !us.isActive(claims) {
+		return "", fmt.Errorf("invalid token claims")
+	}
+
+	return claims.User, nil
+}
+
+func (us *diskUserStorage) Refresh(refreshToken string) (*Tokens, error) {
+	claims, err := us.tokens.parse(refreshToken, refreshTokenType)
+	if err != nil {
+		return nil, err
+	}
+
+	if !us.isActive(claims) {
+		return nil, fmt.Errorf("invalid token claims")
+	}
+
+	if err := us.tokens.revoke(refreshToken); err != nil {
+		return nil, err
+	}
+
+	return us.issue(claims.User, claims.Session)
+}
+
+func (us *diskUserStorage) Revoke(tokenString string) error {
+	return us.tokens.revokeSession(tokenString)
+}
+
+// issue returns tokens of the current token generation of a user for
+// a session, empty session starts a new one.
+func (us *diskUserStorage) issue(username, session string) (*Tokens, error) {
+	return us.tokens.issue(username, us.generation(username), session)
+}
+
+func (us *diskUserStorage) generation(username string) int64 {
+	us.RLock()
+	defer us.RUnlock()
+
+	if record, ok := us.users[username]; ok {
+		return record.TokenGeneration
+	}
+
+	return 0
+}
+
+// isActive returns true if token user is enabled and token was issued
+// for the current token generation, generation changes with password.
+// Tokens issued before generations were stored are verified using
+// time of the last password change.
+func (us *diskUserStorage) isActive(claims *tokenClaims) bool {
+	us.RLock()
+	defer us.RUnlock()
+
+	record, ok := us.users[claims.User]
+	return ok && !record.Disabled && claims.Generation == record.TokenGeneration &&
+		claims.IssuedAt >= record.PasswordChangedAt.Unix()
+}
+
+func (us *diskUserStorage) User(username string) (*acl.User, bool) {
+	us.RLock()
+	defer us.RUnlock()
+
+	record, ok := us.users[username]
+	if !ok || record.Permissions == nil {
+		return nil, false
+	}
+
+	return record.Permissions, true
+}
+
+func (us *diskUserStorage) Users() ([]User, error) {
+	us.RLock()
+	defer us.RUnlock()
+
+	users := make([]User, 0, len(us.users))
+	for username, record := range us.users {
+		users = append(users, User{username, record.Disabled, record.Permissions, record.TOTPSecret != ""})
+	}
+
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+	return users, nil
+}
+
+func (us *diskUserStorage) Create(user User, password string) error {
+	if len(password) < MinPasswordLength {
+		return ErrInvalidPassword
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("bcrypt: %s", err)
+	}
+
+	return us.Import(user, string(hash))
+}
+
+func (us *diskUserStorage) Import(user User, passwordHash string) error {
+	if !isUsername(user.Username) || user.Permissions == nil || !user.Permissions.IsValid() {
+		return ErrInvalidUser
+	}
+
+	us.Lock()
+	defer us.Unlock()
+
+	if _, ok := us.users[user.Username]; ok {
+		return ErrUserExists
+	}
+
+	return us.put(user.Username, &userRecord{
+		PasswordHash:      passwordHash,
+		PasswordChangedAt: time.Now(),
+		Disabled:          user.Disabled,
+		Permissions:       user.Permissions,
+	})
+}
+
+func (us *diskUserStorage) Update(user User) error {
+	if user.Permissions == nil || !user.Permissions.IsValid() {
+		return ErrInvalidUser
+	}
+
+	us.Lock()
+	defer us.Unlock()
+
+	record, ok := us.users[user.Username]
+	if !ok {
+		return ErrUserNotFound
+	}
+
+	demoted := user.Disabled || user.Permissions.Role != acl.RoleAdmin
+	if isAdmin(record) && demoted && !us.hasOtherAdmin(user.Username) {
+		return ErrLastAdmin
+	}
+
+	updated := *record
+	updated.Disabled = user.Disabled
+	updated.Permissions = user.Permissions
+	return us.put(user.Username, &updated)
+}
+
+func (us *diskUserStorage) CheckPassword(username, password string) error {
+	us.RLock()
+	record, ok := us.users[username]
+	var hash string
+	var disabled bool
+	if ok {
+		hash, disabled = record.PasswordHash, record.Disabled
+	}
+	us.RUnlock()
+
+	if !ok || disabled {
+		return fmt.Errorf("invalid username or password")
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		return fmt.Errorf("invalid username or password")
+	}
+
+	return nil
+}
+
+func (us *diskUserStorage) SetPassword(username, password string) error {
+	if len(password) < MinPasswordLength {
+		return ErrInvalidPassword
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("bcrypt: %s", err)
+	}
+
+	us.Lock()
+	defer us.Unlock()
+
+	record, ok := us.users[username]
+	if !ok {
+		return ErrUserNotFound
+	}
+
+	updated := *record
+	updated.PasswordHash = string(hash)
+	updated.PasswordChangedAt = time.Now()
+	updated.TokenGeneration++
+	updated.AppPasswords = nil
+	return us.put(username, &updated)
+}
+
+func (us *diskUserStorage) Remove(username string) error {
+	us.Lock()
+	defer us.Unlock()
+
+	record, ok := us.users[username]
+	if !ok {
+		return ErrUserNotFound
+	}
+
+	if isAdmin(record) && !us.hasOtherAdmin(username) {
+		return ErrLastAdmin
+	}
+
+	return us.put(username, nil)
+}
+
+func (us *diskUserStorage) TwoFactorEnabled(username string) bool {
+	us.RLock()
+	defer us.RUnlock()
+
+	record, ok := us.users[username]
+	return ok && record.TOTPSecret != ""
+}
+
+func (us *diskUserStorage) EnrollTwoFactor(username string) (*TwoFactorEnrollment, error) {
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	us.Lock()
+	defer us.Unlock()
+
+	record, ok := us.users[username]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+
+	if record.TOTPSecret != "" {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	updated := *record
+	updated.TOTPPending = secret
+	if err := us.put(username, &updated); err != nil {
+		return nil, err
+	}
+
+	return &TwoFactorEnrollment{secret, totpURI(username, secret)}, nil
+}
+
+func (us *diskUserStorage) ConfirmTwoFactor(username, code string) ([]string, error) {
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	us.Lock()
+	defer us.Unlock()
+
+	record, ok := us.users[username]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+
+	if record.TOTPSecret != "" {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	counter, ok := matchTOTP(record.TOTPPending, code, time.Now(), 0)
+	if record.TOTPPending == "" || !ok {
+		return nil, ErrInvalidCode
+	}
+
+	updated := *record
+	updated.TOTPSecret = record.TOTPPending
+	updated.TOTPPending = ""
+	updated.TOTPCounter = counter
+	updated.RecoveryCodes = hashes
+	if err := us.put(username, &updated); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func (us *diskUserStorage) VerifyTwoFactor(username, code string) error {
+	us.Lock()
+	defer us.Unlock()
+
+	record, ok := us.users[username]
+	if !ok {
+		return ErrUserNotFound
+	}
+
+	if record.TOTPSecret == "" {
+		return ErrTwoFactorDisabled
+	}
+
+	updated := *record
+	if counter, ok := matchTOTP(record.TOTPSecret, code, time.Now(), record.TOTPCounter); ok {
+		updated.TOTPCounter = counter
+		return us.put(username, &updated)
+	}
+
+	hash := hashRecoveryCode(code)
+	for idx, recoveryHash := range record.RecoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(recoveryHash)) == 1 {
+			updated.RecoveryCodes = append(append([]string{}, record.RecoveryCodes[:idx]...), record.RecoveryCodes[idx+1:]...)
+			return us.put(username, &updated)
+		}
+	}
+
+	return ErrInvalidCode
+}
+
+func (us *diskUserStorage) DisableTwoFactor(username string) error {
+	us.Lock()
+	defer us.Unlock()
+
+	record, ok := us.users[username]
+	if !ok {
+		return ErrUserNotFound
+	}
+
+	if record.TOTPSecret == "" && record.TOTPPending == "" {
+		return ErrTwoFactorDisabled
+	}
+
+	updated := *record
+	updated.TOTPSecret = ""
+	updated.TOTPPending = ""
+	updated.TOTPCounter = 0
+	updated.RecoveryCodes = nil
+	return us.put(username, &updated)
+}
+
+func (us *diskUserStorage) AppPasswords(username string) ([]AppPassword, error) {
+	us.RLock()
+	defer us.RUnlock()
+
+	record, ok := us.users[username]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+
+	passwords := make([]AppPassword, len(record.AppPasswords))
+	for idx, appPassword := range record.AppPasswords {
+		passwords[idx] = appPassword.AppPassword
+	}
+
+	return passwords, nil
+}
+
+func (us *diskUserStorage) CreateAppPassword(username, name string) (*AppPassword, string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, "", fmt.Errorf("failed to generate id: %s", err)
+	}
+
+	password, hash, err := newAppPassword()
+	if err != nil {
+		return nil, "", err
+	}
+
+	us.Lock()
+	defer us.Unlock()
+
+	record, ok := us.users[username]
+	if !ok {
+		return nil, "", ErrUserNotFound
+	}
+
+	appPassword := AppPassword{hex.EncodeToString(id), name, time.Now()}
+	updated := *record
+	updated.AppPasswords = append(append([]appPasswordRecord{}, record.AppPasswords...), appPasswordRecord{appPassword, hash})
+	if err := us.put(username, &updated); err != nil {
+		return nil, "", err
+	}
+
+	return &appPassword, password, nil
+}
+
+func (us *diskUserStorage) RemoveAppPassword(username, id string) error {
+	us.Lock()
+	defer us.Unlock()
+
+	record, ok := us.users[username]
+	if !ok {
+		return ErrUserNotFound
+	}
+
+	for idx, appPassword := range record.AppPasswords {
+		if appPassword.ID == id {
+			updated := *record
+			updated.AppPasswords = append(append([]appPasswordRecord{}, record.AppPasswords[:idx]...), record.AppPasswords[idx+1:]...)
+			return us.put(username, &updated)
+		}
+	}
+
+	return ErrAppPasswordNotFound
+}
+
+func (us *diskUserStorage) CheckAppPassword(username, password string) error {
+	hash := hashAppPassword(password)
+
+	us.RLock()
+	defer us.RUnlock()
+
+	record, ok := us.users[username]
+	if !ok || record.Disabled {
+		return fmt.Errorf("invalid username or password")
+	}
+
+	for _, appPassword := range record.AppPasswords {
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(appPassword.Hash)) == 1 {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid username or password")
+}
+
+func (us *diskUserStorage) Challenge(username, password string) (string, error) {
+	if !us.TwoFactorEnabled(username) {
+		return "", ErrTwoFactorDisabled
+	}
+
+	if err := us.CheckPassword(username, password); err != nil {
+		return "", err
+	}
+
+	challenge, _, err := us.tokens.sign(username, twoFactorTokenType, us.generation(username), "", time.Now(), TwoFactorChallengeLifetime)
+	return challenge, err
+}
+
+func (us *diskUserStorage) VerifyChallenge(challenge, code string) (*Tokens, error) {
+	claims, err := us.tokens.parse(challenge, twoFactorTokenType)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := us.tokens.revoke(challenge); err != nil {
+		return nil, err
+	}
+
+	if !us.isActive(claims) {
+		return nil, fmt.Errorf("invalid token claims")
+	}
+
+	if err := us.VerifyTwoFactor(claims.User, code); err != nil {
+		return nil, err
+	}
+
+	return us.issue(claims.User, "")
+}
+
+// hasOtherAdmin returns true if users other than username include an
+// enabled admin, caller has to hold the lock.
+func (us *diskUserStorage) hasOtherAdmin(username string) bool {
+	for name, record := range us.users {
+		if name != username && isAdmin(record) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isAdmin(record *userRecord) bool {
+	return !record.Disabled && record.Permissions != nil && record.Permissions.Role == acl.RoleAdmin
+}
+
+// isUsername returns true if name can be used as a home folder name
+// and in basic auth credentials.
+func isUsername(name string) bool {
+	return pathutil.IsFolderName(name) && !strings.Contains(name, ":")
+}
+
+// save atomically writes users into a file, caller has to hold the
+// lock.
+// put replaces record of a user and saves users, nil record removes
+// the user. Records are never modified in place, so previous record is
+// restored if save fails. Caller has to hold the lock.
+func (us *diskUserStorage) put(username string, record *userRecord) error {
+	prev, ok := us.users[username]
+	if record == nil {
+		delete(us.users, username)
+	} else {
+		us.users[username] = record
+	}
+
+	if err := us.save(); err != nil {
+		if ok {
+			us.users[username] = prev
+		} else {
+			delete(us.users, username)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (us *diskUserStorage) save() error {
+	data, err := json.MarshalIndent(us.users, "", "  ")
+	if err != nil {
+		return fmt.Errorf("json: %s", err)
+	}
+
+	dir, name := filepath.Split(us.path)
+	file, err := ioutil.TempFile(dir, "."+name+".")
+	if err != nil {
+		return fmt.Errorf("file: %s", err)
+	}
+	defer os.Remove(file.Name()) // nolint: errcheck
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf("file: %s", err)
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("file: %s", err)
+	}
+
+	if err := os.Rename(file.Name(), us.path); err != nil {
+		return fmt.Errorf("rename: %s", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,186 @@
+package api
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ap4y/cloud/acl"
+)
+
+func TestDiskUserStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "users")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cfg := TokenConfig{SigningMethod: jwt.SigningMethodHS256, SignKey: []byte("secret")}
+	path := filepath.Join(dir, "users.json")
+	storage, err := NewDiskUserStorage(path, cfg)
+	require.NoError(t, err)
+
+	admin := &acl.User{Role: acl.RoleAdmin}
+	viewer := &acl.User{Role: acl.RoleViewer}
+
+	t.Run("Create", func(t *testing.T) {
+		require.NoError(t, storage.Create(User{Username: "foo", Permissions: admin}, "password"))
+		require.NoError(t, storage.Create(User{Username: "bar", Permissions: viewer}, "password"))
+
+		assert.Equal(t, ErrUserExists, storage.Create(User{Username: "foo", Permissions: admin}, "password"))
+		assert.Equal(t, ErrInvalidPassword, storage.Create(User{Username: "baz", Permissions: admin}, "short"))
+		assert.Equal(t, ErrInvalidUser, storage.Create(User{Username: "baz"}, "password"))
+		assert.Equal(t, ErrInvalidUser, storage.Create(User{Username: "baz", Permissions: &acl.User{Role: "foo"}}, "password"))
+		assert.Equal(t, ErrInvalidUser, storage.Create(User{Permissions: admin}, "password"))
+		for _, username := range []string{"../foo", "foo/bar", "foo\\bar", "foo:bar", ".foo"} {
+			assert.Equal(t, ErrInvalidUser, storage.Create(User{Username: username, Permissions: admin}, "password"), username)
+		}
+
+		users, err := storage.Users()
+		require.NoError(t, err)
+		assert.Equal(t, []User{{"bar", false, viewer, false}, {"foo", false, admin, false}}, users)
+
+		user, ok := storage.User("bar")
+		require.True(t, ok)
+		assert.Equal(t, viewer, user)
+	})
+
+	t.Run("Authenticate", func(t *testing.T) {
+		tokens, err := storage.Authenticate("foo", "password")
+		require.NoError(t, err)
+
+		username, err := storage.Validate(tokens.Token)
+		require.NoError(t, err)
+		assert.Equal(t, "foo", username)
+
+		_, err = storage.Authenticate("foo", "invalid")
+		assert.Error(t, err)
+		_, err = storage.Authenticate("baz", "password")
+		assert.Error(t, err)
+	})
+
+	t.Run("Import", func(t *testing.T) {
+		hash := "$2b$10$fEWhY87kzeaV3hUEB6phTuyWjpv73V5m.YcqTxHXnvqEGIou1tXGO"
+		require.NoError(t, storage.Import(User{Username: "test", Permissions: viewer}, hash))
+		assert.Equal(t, ErrUserExists, storage.Import(User{Username: "test", Permissions: viewer}, hash))
+		assert.Equal(t, ErrInvalidUser, storage.Import(User{Username: "test:foo", Permissions: viewer}, hash))
+
+		_, err := storage.Authenticate("test", "changeme")
+		require.NoError(t, err)
+	})
+
+	t.Run("Disable", func(t *testing.T) {
+		tokens, err := storage.Authenticate("bar", "password")
+		require.NoError(t, err)
+
+		require.NoError(t, storage.Update(User{Username: "bar", Disabled: true, Permissions: viewer}))
+		assert.Equal(t, ErrUserNotFound, storage.Update(User{Username: "baz", Permissions: viewer}))
+		assert.Equal(t, ErrInvalidUser, storage.Update(User{Username: "bar"}))
+
+		_, err = storage.Validate(tokens.Token)
+		assert.Error(t, err)
+		_, err = storage.Refresh(tokens.RefreshToken)
+		assert.Error(t, err)
+		_, err = storage.Authenticate("bar", "password")
+		assert.Error(t, err)
+
+		require.NoError(t, storage.Update(User{Username: "bar", Permissions: viewer}))
+		_, err = storage.Validate(tokens.Token)
+		assert.NoError(t, err)
+	})
+
+	t.Run("SetPassword", func(t *testing.T) {
+		tokens, err := storage.Authenticate("bar", "password")
+		require.NoError(t, err)
+
+		assert.Equal(t, ErrInvalidPassword, storage.SetPassword("bar", "short"))
+		assert.Equal(t, ErrUserNotFound, storage.SetPassword("baz", "password"))
+		require.NoError(t, storage.SetPassword("bar", "new password"))
+
+		_, err = storage.Validate(tokens.Token)
+		assert.Error(t, err)
+		_, err = storage.Refresh(tokens.RefreshToken)
+		assert.Error(t, err)
+
+		assert.Error(t, storage.CheckPassword("bar", "password"))
+		assert.NoError(t, storage.CheckPassword("bar", "new password"))
+
+		tokens, err = storage.Authenticate("bar", "new password")
+		require.NoError(t, err)
+		_, err = storage.Validate(tokens.Token)
+		assert.NoError(t, err)
+	})
+
+	t.Run("CheckPassword/concurrent", func(t *testing.T) {
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			storage.CheckPassword("bar", "new password") // nolint: errcheck
+		}()
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, storage.SetPassword("bar", "new password"))
+		}()
+		wg.Wait()
+
+		assert.NoError(t, storage.CheckPassword("bar", "new password"))
+	})
+
+	t.Run("LastAdmin", func(t *testing.T) {
+		assert.Equal(t, ErrLastAdmin, storage.Update(User{Username: "foo", Permissions: viewer}))
+		assert.Equal(t, ErrLastAdmin, storage.Update(User{Username: "foo", Disabled: true, Permissions: admin}))
+		assert.Equal(t, ErrLastAdmin, storage.Remove("foo"))
+
+		require.NoError(t, storage.Update(User{Username: "test", Permissions: admin}))
+		require.NoError(t, storage.Update(User{Username: "foo", Permissions: viewer}))
+		assert.Equal(t, ErrLastAdmin, storage.Remove("test"))
+		require.NoError(t, storage.Update(User{Username: "foo", Permissions: admin}))
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		require.NoError(t, storage.Remove("test"))
+		assert.Equal(t, ErrUserNotFound, storage.Remove("test"))
+
+		_, ok := storage.User("test")
+		assert.False(t, ok)
+	})
+
+	t.Run("failed save", func(t *testing.T) {
+		us := storage.(*diskUserStorage)
+		us.path = filepath.Join(dir, "missing", "users.json")
+		defer func() { us.path = path }()
+
+		hash := "$2b$10$fEWhY87kzeaV3hUEB6phTuyWjpv73V5m.YcqTxHXnvqEGIou1tXGO"
+		require.Error(t, storage.Import(User{Username: "test", Permissions: viewer}, hash))
+		_, ok := storage.User("test")
+		assert.False(t, ok)
+
+		require.Error(t, storage.Update(User{Username: "bar", Disabled: true, Permissions: admin}))
+		user, ok := storage.User("bar")
+		require.True(t, ok)
+		assert.Equal(t, viewer, user)
+
+		require.Error(t, storage.SetPassword("bar", "other password"))
+		assert.NoError(t, storage.CheckPassword("bar", "new password"))
+
+		require.Error(t, storage.Remove("bar"))
+		_, ok = storage.User("bar")
+		assert.True(t, ok)
+	})
+
+	t.Run("Reload", func(t *testing.T) {
+		storage, err := NewDiskUserStorage(path, cfg)
+		require.NoError(t, err)
+
+		users, err := storage.Users()
+		require.NoError(t, err)
+		assert.Equal(t, []User{{"bar", false, viewer, false}, {"foo", false, admin, false}}, users)
+
+		assert.NoError(t, storage.CheckPassword("bar", "new password"))
+	})
+}
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi"
+
+	"github.com/ap4y/cloud/contextkey"
+	"github.com/ap4y/cloud/internal/httputil"
+)
+
+type usersHandler struct {
+	storage UserStorage
+}
+
+// UsersHandler returns a new handler for user management endpoints.
+func UsersHandler(storage UserStorage) http.Handler {
+	uh := &usersHandler{storage}
+
+	mux := chi.NewRouter()
+	mux.Get("/", uh.listUsers)
+	mux.Post("/", uh.createUser)
+	mux.Put("/{username}", uh.updateUser)
+	mux.Delete("/{username}", uh.removeUser)
+	mux.Post("/{username}/password", uh.resetPassword)
+	mux.Delete("/{username}/two_factor", uh.resetTwoFactor)
+
+	return mux
+}
+
+func (uh *usersHandler) listUsers(w http.ResponseWriter, req *http.Request) {
+	users, err := uh.storage.Users()
+	if err != nil {
+		httputil.Error(w, fmt.Sprintf("Failed to fetch users: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	httputil.Respond(w, users)
+}
+
+func (uh *usersHandler) createUser(w http.ResponseWriter, req *http.Request) {
+	var body struct {
+		User
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		httputil.Error(w, fmt.Sprintf("Failed to decode json: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := uh.storage.Create(body.User, body.Password); err != nil {
+		httputil.Error(w, fmt.Sprintf("Failed to create user: %s", err), userErrorStatus(err))
+		return
+	}
+
+	httputil.Respond(w, body.User)
+}
+
+func (uh *usersHandler) updateUser(w http.ResponseWriter, req *http.Request) {
+	user := User{}
+	if err := json.NewDecoder(req.Body).Decode(&user); err != nil {
+		httputil.Error(w, fmt.Sprintf("Failed to decode json: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	user.Username = chi.URLParam(req, "username")
+	if user.Disabled && isCurrentUser(req, user.Username) {
+		httputil.Error(w, "Current user can't be disabled", http.StatusUnprocessableEntity)
+		return
+	}
+
+	if err := uh.storage.Update(user); err != nil {
+		httputil.Error(w, fmt.Sprintf("Failed to update user: %s", err), userErrorStatus(err))
+		return
+	}
+
+	httputil.Respond(w, user)
+}
+
+func (uh *usersHandler) removeUser(w http.ResponseWriter, req *http.Request) {
+	username := chi.URLParam(req, "username")
+	if isCurrentUser(req, username) {
+		httputil.Error(w, "Current user can't be removed", http.StatusUnprocessableEntity)
+		return
+	}
+
+	if err := uh.storage.Remove(username); err != nil {
+		httputil.Error(w, fmt.Sprintf("Failed to remove user: %s", err), userErrorStatus(err))
+		return
+	}
+
+	httputil.Respond(w, map[string]string{})
+}
+
+func (uh *usersHandler) resetPassword(w http.ResponseWriter, req *http.Request) {
+	body := map[string]string{}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		httputil.Error(w, fmt.Sprintf("Failed to decode json: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := uh.storage.SetPassword(chi.URLParam(req, "username"), body["password"]); err != nil {
+		httputil.Error(w, fmt.Sprintf("Failed to reset password: %s", err), userErrorStatus(err))
+		return
+	}
+
+	httputil.Respond(w, map[string]string{})
+}
+
+func (uh *usersHandler) resetTwoFactor(w http.ResponseWriter, req *http.Request) {
+	if err := uh.storage.DisableTwoFactor(chi.URLParam(req, "username")); err != nil {
+		httputil.Error(w, fmt.Sprintf("Failed to reset two-factor authentication: %s", err), userErrorStatus(err))
+		return
+	}
+
+	httputil.Respond(w, map[string]string{})
+}
+
+// changePassword changes password of the authenticated user, current
+// password has to be provided. Tokens issued before the change are
+// invalidated and a new pair or a two-factor challenge is returned.
+func changePassword(storage UserStorage) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		body := map[string]string{}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			httputil.Error(w, fmt.Sprintf("Failed to decode json: %s", err), http.StatusBadRequest)
+			return
+		}
+
+		username, _ := req.Context().Value(contextkey.UsernameCtxKey).(string)
+		if err := storage.CheckPassword(username, body["current_password"]); err != nil {
+			httputil.Error(w, fmt.Sprintf("Failed to change password: %s", err), http.StatusBadRequest)
+			return
+		}
+
+		if err := storage.SetPassword(username, body["password"]); err != nil {
+			httputil.Error(w, fmt.Sprintf("Failed to change password: %s", err), userErrorStatus(err))
+			return
+		}
+
+		signIn(w, storage, username, body["password"])
+	}
+}
+
+func isCurrentUser(req *http.Request, username string) bool {
+	current, _ := req.Context().Value(contextkey.UsernameCtxKey).(string)
+	return current == username
+}
+
+func userErrorStatus(err error) int {
+	switch err {
+	case ErrUserNotFound, ErrAppPasswordNotFound:
+		return http.StatusNotFound
+	case ErrUserExists, ErrTwoFactorEnabled, ErrLastAdmin:
+		return http.StatusConflict
+	case ErrInvalidUser, ErrInvalidPassword, ErrTwoFactorDisabled, ErrInvalidCode:
+		return http.StatusUnprocessableEntity
+	}
+
+	return http.StatusBadRequest
+}
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ap4y/cloud/acl"
+	"github.com/ap4y/cloud/contextkey"
+)
+
+func TestUsersHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "users")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cfg := TokenConfig{SigningMethod: jwt.SigningMethodHS256, SignKey: []byte("secret")}
+	storage, err := NewDiskUserStorage(filepath.Join(dir, "users.json"), cfg)
+	require.NoError(t, err)
+	require.NoError(t, storage.Create(User{Username: "admin", Permissions: &acl.User{Role: acl.RoleAdmin}}, "password"))
+
+	handler := UsersHandler(storage)
+	do := func(method, path, body string) *http.Response {
+		req := httptest.NewRequest(method, "http://cloud.api"+path, strings.NewReader(body))
+		ctx := context.WithValue(req.Context(), contextkey.UsernameCtxKey, "admin")
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req.WithContext(ctx))
+		return w.Result()
+	}
+
+	t.Run("Create", func(t *testing.T) {
+		tcs := []struct {
+			name   string
+			body   string
+			status int
+		}{
+			{"valid", `{"username":"foo","password":"password","permissions":{"role":"viewer"}}`, http.StatusOK},
+			{"existing", `{"username":"foo","password":"password","permissions":{"role":"viewer"}}`, http.StatusConflict},
+			{"short password", `{"username":"bar","password":"short","permissions":{"role":"viewer"}}`, http.StatusUnprocessableEntity},
+			{"without permissions", `{"username":"bar","password":"password"}`, http.StatusUnprocessableEntity},
+			{"invalid json", `{`, http.StatusBadRequest},
+		}
+
+		for _, tc := range tcs {
+			t.Run(tc.name, func(t *testing.T) {
+				assert.Equal(t, tc.status, do("POST", "/", tc.body).StatusCode)
+			})
+		}
+
+		_, err := storage.Authenticate("foo", "password")
+		assert.NoError(t, err)
+	})
+
+	t.Run("List", func(t *testing.T) {
+		res := do("GET", "/", "")
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		users := []User{}
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&users))
+		require.Len(t, users, 2)
+		assert.Equal(t, "admin", users[0].Username)
+		assert.Equal(t, "foo", users[1].Username)
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, do("PUT", "/foo", `{"disabled":true,"permissions":{"role":"editor"}}`).StatusCode)
+		assert.Equal(t, http.StatusNotFound, do("PUT", "/bar", `{"permissions":{"role":"editor"}}`).StatusCode)
+		assert.Equal(t, http.StatusUnprocessableEntity, do("PUT", "/admin", `{"disabled":true,"permissions":{"role":"admin"}}`).StatusCode)
+
+		_, err := storage.Authenticate("foo", "password")
+		assert.Error(t, err)
+
+		user, ok := storage.User("foo")
+		require.True(t, ok)
+		assert.Equal(t, acl.RoleEditor, user.Role)
+	})
+
+	t.Run("Reset password", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, do("POST", "/foo/password", `{"password":"new password"}`).StatusCode)
+		assert.Equal(t, http.StatusUnprocessableEntity, do("POST", "/foo/password", `{"password":"short"}`).StatusCode)
+		assert.Equal(t, http.StatusNotFound, do("POST", "/bar/password", `{"password":"new password"}`).StatusCode)
+
+		assert.NoError(t, storage.CheckPassword("admin", "password"))
+		require.Equal(t, http.StatusOK, do("PUT", "/foo", `{"permissions":{"role":"editor"}}`).StatusCode)
+		assert.NoError(t, storage.CheckPassword("foo", "new password"))
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnprocessableEntity, do("DELETE", "/admin", "").StatusCode)
+		assert.Equal(t, http.StatusOK, do("DELETE", "/foo", "").StatusCode)
+		assert.Equal(t, http.StatusNotFound, do("DELETE", "/foo", "").StatusCode)
+	})
+}
+
+func TestChangePassword(t *testing.T) {
+	dir, err := ioutil.TempDir("", "users")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cfg := TokenConfig{SigningMethod: jwt.SigningMethodHS256, SignKey: []byte("secret")}
+	storage, err := NewDiskUserStorage(filepath.Join(dir, "users.json"), cfg)
+	require.NoError(t, err)
+	require.NoError(t, storage.Create(User{Username: "foo", Permissions: &acl.User{Role: acl.RoleViewer}}, "password"))
+
+	tokens, err := storage.Authenticate("foo", "password")
+	require.NoError(t, err)
+
+	handler := AuthHandler(storage, nil)
+	tcs := []struct {
+		name   string
+		token  string
+		body   string
+		status int
+	}{
+		{"unauthenticated", "", `{"current_password":"password","password":"new password"}`, http.StatusUnauthorized},
+		{"invalid current password", tokens.Token, `{"current_password":"invalid","password":"new password"}`, http.StatusBadRequest},
+		{"short password", tokens.Token, `{"current_password":"password","password":"short"}`, http.StatusUnprocessableEntity},
+		{"valid", tokens.Token, `{"current_password":"password","password":"new password"}`, http.StatusOK},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "http://cloud.api/password", strings.NewReader(tc.body))
+			if tc.token != "" {
+				req.AddCookie(&http.Cookie{Name: tokenCookieKey, Value: tc.token})
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			res := w.Result()
+			require.Equal(t, tc.status, res.StatusCode)
+			if res.StatusCode != http.StatusOK {
+				return
+			}
+
+			newTokens := &Tokens{}
+			require.NoError(t, json.NewDecoder(res.Body).Decode(newTokens))
+			_, err := storage.Validate(newTokens.Token)
+			assert.NoError(t, err)
+		})
+	}
+
+	assert.NoError(t, storage.CheckPassword("foo", "new password"))
+}
@@ -294,6 +294,9 @@ const ImagePreview = ({ images, albumName, share, match, fetchExif }) => {
   const imageURL = ({ path }, type = "image") =>
     apiClient.imageURL(albumName, path, type, share);
 
+  const previewURL = image =>
+    (image.renditions && image.renditions.preview) || imageURL(image);
+
   const prevImage =
     images[selectedIdx === 0 ? images.length - 1 : selectedIdx - 1];
   const nextImage =
@@ -352,7 +355,7 @@ const ImagePreview = ({ images, albumName, share, match, fetchExif }) => {
 
           <Img
             alt={selectedImage.name}
-            src={imageURL(selectedImage)}
+            src={previewURL(selectedImage)}
             onClick={toggleControls}
             loader={<Spinner />}
           />
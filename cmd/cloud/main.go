@@ -2,7 +2,9 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
+	"os"
 
 	"github.com/ap4y/cloud/internal/cli"
 )
@@ -14,8 +16,19 @@ var (
 )
 
 func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [index [album...]]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
+	if flag.Arg(0) == "index" {
+		if err := cli.Index(*configPath, flag.Args()[1:]...); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	if err := cli.Run(*configPath, *devURL, *addr); err != nil {
 		log.Fatal(err)
 	}
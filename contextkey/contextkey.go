@@ -9,3 +9,9 @@ var UsernameCtxKey = &contextKey{"Username"}
 
 // ShareCtxKey defines share request context key.
 var ShareCtxKey = &contextKey{"Share"}
+
+// UserCtxKey defines user permissions request context key.
+var UserCtxKey = &contextKey{"User"}
+
+// SourceCtxKey defines files source request context key.
+var SourceCtxKey = &contextKey{"Source"}
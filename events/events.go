@@ -0,0 +1,87 @@
+package events
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ap4y/cloud/module"
+)
+
+// EventType defines types of filesystem changes.
+type EventType string
+
+const (
+	// EventCreated represents new files and directories.
+	EventCreated EventType = "created"
+	// EventModified represents finished writes to a file.
+	EventModified EventType = "modified"
+	// EventRemoved represents removed files and directories.
+	EventRemoved EventType = "removed"
+	// EventRenamed represents files and directories moved within a
+	// watched tree.
+	EventRenamed EventType = "renamed"
+)
+
+// ErrUnsupported returned when filesystem watching is not supported
+// on a current platform.
+var ErrUnsupported = errors.New("watching is not supported")
+
+// subscriberBuffer defines how many events are queued for a slow
+// subscriber before new events are dropped.
+const subscriberBuffer = 64
+
+// Event stores a single filesystem change. Paths are relative to the
+// module base path.
+type Event struct {
+	Type    EventType   `json:"type"`
+	Module  module.Type `json:"module"`
+	Path    string      `json:"path"`
+	OldPath string      `json:"old_path,omitempty"`
+	Time    time.Time   `json:"time"`
+}
+
+// Broker fans out published events to all subscribers.
+type Broker struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+}
+
+// NewBroker returns a new Broker instance.
+func NewBroker() *Broker {
+	return &Broker{subscribers: map[chan Event]struct{}{}}
+}
+
+// Publish sends event to all subscribers, event is dropped for
+// subscribers that are not keeping up.
+func (b *Broker) Publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel with published events and a function
+// that cancels subscription.
+func (b *Broker) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
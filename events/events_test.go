@@ -0,0 +1,33 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ap4y/cloud/module"
+)
+
+func TestBroker(t *testing.T) {
+	broker := NewBroker()
+
+	ch1, cancel1 := broker.Subscribe()
+	ch2, cancel2 := broker.Subscribe()
+	defer cancel2()
+
+	event := Event{Type: EventCreated, Module: module.Files, Path: "/foo"}
+	broker.Publish(event)
+	assert.Equal(t, event, <-ch1)
+	assert.Equal(t, event, <-ch2)
+
+	cancel1()
+	cancel1()
+	_, ok := <-ch1
+	assert.False(t, ok)
+
+	for i := 0; i < subscriberBuffer*2; i++ {
+		broker.Publish(event)
+	}
+	require.Len(t, ch2, subscriberBuffer)
+}
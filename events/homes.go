@@ -0,0 +1,63 @@
+package events
+
+import (
+	"strings"
+
+	"github.com/ap4y/cloud/module"
+)
+
+// Homes maps events of a module with per-user home folders into homes
+// of users. Event paths of such module start with a username, events
+// of the optional shared folder are visible to all users.
+type Homes struct {
+	Module module.Type
+	Shared string
+}
+
+// Event returns event with paths relative to the home of a user,
+// false is returned for events outside of it. Items moved between
+// homes are reported as created or removed. Events of other modules
+// are returned as is.
+func (h *Homes) Event(username string, event Event) (Event, bool) {
+	if h == nil || event.Module != h.Module {
+		return event, true
+	}
+
+	newPath, isNew := h.homePath(username, event.Path)
+	oldPath, isOld := h.homePath(username, event.OldPath)
+
+	switch {
+	case isNew && isOld:
+		event.Path, event.OldPath = newPath, oldPath
+	case isNew:
+		event.Path, event.OldPath = newPath, ""
+		if event.Type == EventRenamed {
+			event.Type = EventCreated
+		}
+	case isOld:
+		event.Type, event.Path, event.OldPath = EventRemoved, oldPath, ""
+	default:
+		return event, false
+	}
+
+	return event, true
+}
+
+// homePath returns path p relative to the home of a user, paths of
+// the shared folder are mounted into all homes under the same name.
+func (h *Homes) homePath(username, p string) (string, bool) {
+	if p == "" || username == "" {
+		return "", false
+	}
+
+	if shared := "/" + h.Shared; h.Shared != "" && (p == shared || strings.HasPrefix(p, shared+"/")) {
+		return p, true
+	}
+
+	home := "/" + username
+	if !strings.HasPrefix(p, home+"/") {
+		return "", false
+	}
+
+	return strings.TrimPrefix(p, home), true
+}
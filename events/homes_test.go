@@ -0,0 +1,83 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ap4y/cloud/module"
+)
+
+func TestHomesEvent(t *testing.T) {
+	homes := &Homes{Module: module.Files, Shared: "shared"}
+
+	tcs := []struct {
+		name     string
+		username string
+		event    Event
+		expected Event
+		ok       bool
+	}{
+		{
+			"home", "alice",
+			Event{Type: EventCreated, Module: module.Files, Path: "/alice/foo"},
+			Event{Type: EventCreated, Module: module.Files, Path: "/foo"}, true,
+		},
+		{
+			"other home", "bob",
+			Event{Type: EventCreated, Module: module.Files, Path: "/alice/foo"},
+			Event{}, false,
+		},
+		{
+			"home folder", "alice",
+			Event{Type: EventCreated, Module: module.Files, Path: "/alice"},
+			Event{}, false,
+		},
+		{
+			"shared", "bob",
+			Event{Type: EventModified, Module: module.Files, Path: "/shared/foo"},
+			Event{Type: EventModified, Module: module.Files, Path: "/shared/foo"}, true,
+		},
+		{
+			"renamed", "alice",
+			Event{Type: EventRenamed, Module: module.Files, Path: "/alice/bar", OldPath: "/alice/foo"},
+			Event{Type: EventRenamed, Module: module.Files, Path: "/bar", OldPath: "/foo"}, true,
+		},
+		{
+			"moved into home", "alice",
+			Event{Type: EventRenamed, Module: module.Files, Path: "/alice/foo", OldPath: "/bob/foo"},
+			Event{Type: EventCreated, Module: module.Files, Path: "/foo"}, true,
+		},
+		{
+			"moved out of home", "bob",
+			Event{Type: EventRenamed, Module: module.Files, Path: "/alice/foo", OldPath: "/bob/foo"},
+			Event{Type: EventRemoved, Module: module.Files, Path: "/foo"}, true,
+		},
+		{
+			"without user", "",
+			Event{Type: EventCreated, Module: module.Files, Path: "/shared/foo"},
+			Event{}, false,
+		},
+		{
+			"other module", "alice",
+			Event{Type: EventCreated, Module: module.Gallery, Path: "/bob/foo"},
+			Event{Type: EventCreated, Module: module.Gallery, Path: "/bob/foo"}, true,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			event, ok := homes.Event(tc.username, tc.event)
+			assert.Equal(t, tc.ok, ok)
+			if ok {
+				assert.Equal(t, tc.expected, event)
+			}
+		})
+	}
+
+	var disabled *Homes
+	event := Event{Module: module.Files, Path: "/alice/foo"}
+	mapped, ok := disabled.Event("bob", event)
+	assert.True(t, ok)
+	assert.Equal(t, event, mapped)
+}
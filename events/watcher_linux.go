@@ -0,0 +1,253 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/ap4y/cloud/module"
+)
+
+const watchMask = syscall.IN_CREATE | syscall.IN_CLOSE_WRITE | syscall.IN_DELETE |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO
+
+// moveTimeout defines how long IN_MOVED_FROM event waits for a
+// matching IN_MOVED_TO event, pair can be split between reads.
+const moveTimeout = 100 * time.Millisecond
+
+// Watcher publishes changes of a directory tree using inotify. Hidden
+// files and directories (including temporary files of atomic writes)
+// are not reported, renames of hidden files are reported as new
+// files.
+type Watcher struct {
+	broker   *Broker
+	module   module.Type
+	basePath string
+	fd       int
+	file     *os.File
+	paths    map[int]string
+	moves    map[uint32]moveFrom
+}
+
+type moveFrom struct {
+	path  string
+	isDir bool
+	at    time.Time
+}
+
+// Watch starts watching basePath tree and publishes events into
+// broker.
+func Watch(broker *Broker, mod module.Type, basePath string) (*Watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_NONBLOCK | syscall.IN_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("inotify: %s", err)
+	}
+
+	w := &Watcher{
+		broker:   broker,
+		module:   mod,
+		basePath: filepath.Clean(basePath),
+		fd:       fd,
+		file:     os.NewFile(uintptr(fd), "inotify"),
+		paths:    map[int]string{},
+		moves:    map[uint32]moveFrom{},
+	}
+
+	if err := w.addTree(w.basePath); err != nil {
+		w.file.Close()
+		return nil, err
+	}
+
+	go w.run()
+	return w, nil
+}
+
+// Close stops watching and releases inotify descriptor.
+func (w *Watcher) Close() error {
+	return w.file.Close()
+}
+
+func (w *Watcher) run() {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		var deadline time.Time
+		if len(w.moves) > 0 {
+			deadline = time.Now().Add(moveTimeout)
+		}
+		w.file.SetReadDeadline(deadline) // nolint: errcheck
+
+		n, err := w.file.Read(buf)
+		if os.IsTimeout(err) {
+			w.expireMoves(time.Now())
+			continue
+		}
+
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				log.Println("failed to read inotify events:", err)
+			}
+			return
+		}
+
+		w.process(buf[:n])
+		w.expireMoves(time.Now().Add(-moveTimeout))
+	}
+}
+
+func (w *Watcher) process(buf []byte) {
+	for offset := 0; offset+syscall.SizeofInotifyEvent <= len(buf); {
+		raw := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+		nameStart := offset + syscall.SizeofInotifyEvent
+		offset = nameStart + int(raw.Len)
+		name := strings.TrimRight(string(buf[nameStart:offset]), "\x00")
+
+		if raw.Mask&syscall.IN_Q_OVERFLOW != 0 {
+			log.Println("inotify queue overflow, events were dropped")
+			continue
+		}
+
+		if raw.Mask&syscall.IN_IGNORED != 0 {
+			delete(w.paths, int(raw.Wd))
+			continue
+		}
+
+		dir, ok := w.paths[int(raw.Wd)]
+		if !ok || name == "" {
+			continue
+		}
+
+		path := filepath.Join(dir, name)
+		isDir := raw.Mask&syscall.IN_ISDIR != 0
+
+		switch {
+		case raw.Mask&syscall.IN_MOVED_FROM != 0:
+			w.moves[raw.Cookie] = moveFrom{path, isDir, time.Now()}
+		case raw.Mask&syscall.IN_MOVED_TO != 0:
+			from, ok := w.moves[raw.Cookie]
+			delete(w.moves, raw.Cookie)
+
+			if isDir && ok && w.isHidden(path) {
+				w.removeTree(from.path)
+			} else if isDir && ok {
+				w.renameTree(from.path, path)
+			} else if isDir {
+				w.addTree(path) // nolint: errcheck
+			}
+
+			if ok && !w.isHidden(from.path) && !w.isHidden(path) {
+				w.publish(EventRenamed, path, from.path)
+				continue
+			}
+
+			if ok {
+				w.publish(EventRemoved, from.path, "")
+			}
+			w.publish(EventCreated, path, "")
+		case raw.Mask&syscall.IN_CREATE != 0:
+			if isDir {
+				w.addTree(path) // nolint: errcheck
+			}
+			w.publish(EventCreated, path, "")
+		case raw.Mask&syscall.IN_CLOSE_WRITE != 0:
+			w.publish(EventModified, path, "")
+		case raw.Mask&syscall.IN_DELETE != 0:
+			w.publish(EventRemoved, path, "")
+		}
+	}
+}
+
+// expireMoves publishes moves that happened before a provided time
+// and didn't receive a matching event. Items moved outside of the
+// watched tree only have a IN_MOVED_FROM event.
+func (w *Watcher) expireMoves(before time.Time) {
+	for cookie, from := range w.moves {
+		if from.at.After(before) {
+			continue
+		}
+
+		delete(w.moves, cookie)
+		if from.isDir {
+			w.removeTree(from.path)
+		}
+		w.publish(EventRemoved, from.path, "")
+	}
+}
+
+func (w *Watcher) publish(eventType EventType, path, oldPath string) {
+	if w.isHidden(path) {
+		return
+	}
+
+	event := Event{Type: eventType, Module: w.module, Path: w.relPath(path), Time: time.Now()}
+	if oldPath != "" {
+		event.OldPath = w.relPath(oldPath)
+	}
+
+	w.broker.Publish(event)
+}
+
+func (w *Watcher) relPath(path string) string {
+	rel, err := filepath.Rel(w.basePath, path)
+	if err != nil || rel == "." {
+		return "/"
+	}
+
+	return "/" + filepath.ToSlash(rel)
+}
+
+func (w *Watcher) addTree(root string) error {
+	return filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("walk %s: %s", path, err)
+		}
+
+		if !fi.IsDir() {
+			return nil
+		}
+
+		if w.isHidden(path) {
+			return filepath.SkipDir
+		}
+
+		wd, err := syscall.InotifyAddWatch(w.fd, path, watchMask)
+		if err != nil {
+			return fmt.Errorf("watch %s: %s", path, err)
+		}
+
+		w.paths[wd] = path
+		return nil
+	})
+}
+
+func (w *Watcher) renameTree(oldPath, newPath string) {
+	for wd, path := range w.paths {
+		if path == oldPath || strings.HasPrefix(path, oldPath+string(filepath.Separator)) {
+			w.paths[wd] = newPath + strings.TrimPrefix(path, oldPath)
+		}
+	}
+}
+
+func (w *Watcher) removeTree(root string) {
+	for wd, path := range w.paths {
+		if path == root || strings.HasPrefix(path, root+string(filepath.Separator)) {
+			syscall.InotifyRmWatch(w.fd, uint32(wd)) // nolint: errcheck
+			delete(w.paths, wd)
+		}
+	}
+}
+
+func (w *Watcher) isHidden(path string) bool {
+	for _, component := range strings.Split(w.relPath(path), "/") {
+		if strings.HasPrefix(component, ".") {
+			return true
+		}
+	}
+
+	return false
+}
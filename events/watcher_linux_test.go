@@ -0,0 +1,164 @@
+package events
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ap4y/cloud/module"
+)
+
+func TestWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watcher")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "test1"), 0700))
+
+	broker := NewBroker()
+	events, cancel := broker.Subscribe()
+	defer cancel()
+
+	w, err := Watch(broker, module.Files, dir)
+	require.NoError(t, err)
+	defer w.Close()
+
+	next := func() Event {
+		t.Helper()
+
+		select {
+		case event := <-events:
+			assert.EqualValues(t, module.Files, event.Module)
+			return event
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for event")
+			return Event{}
+		}
+	}
+
+	t.Run("created/modified", func(t *testing.T) {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "test1", "foo"), []byte("foo"), 0600))
+
+		event := next()
+		assert.Equal(t, EventCreated, event.Type)
+		assert.Equal(t, "/test1/foo", event.Path)
+
+		event = next()
+		assert.Equal(t, EventModified, event.Type)
+		assert.Equal(t, "/test1/foo", event.Path)
+	})
+
+	t.Run("renamed", func(t *testing.T) {
+		require.NoError(t, os.Rename(filepath.Join(dir, "test1", "foo"), filepath.Join(dir, "bar")))
+
+		event := next()
+		assert.Equal(t, EventRenamed, event.Type)
+		assert.Equal(t, "/bar", event.Path)
+		assert.Equal(t, "/test1/foo", event.OldPath)
+	})
+
+	t.Run("removed", func(t *testing.T) {
+		require.NoError(t, os.Remove(filepath.Join(dir, "bar")))
+
+		event := next()
+		assert.Equal(t, EventRemoved, event.Type)
+		assert.Equal(t, "/bar", event.Path)
+	})
+
+	t.Run("hidden", func(t *testing.T) {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, ".foo.tmp"), []byte("foo"), 0600))
+		require.NoError(t, os.Rename(filepath.Join(dir, ".foo.tmp"), filepath.Join(dir, "foo")))
+
+		event := next()
+		assert.Equal(t, EventCreated, event.Type)
+		assert.Equal(t, "/foo", event.Path)
+	})
+
+	t.Run("new directory", func(t *testing.T) {
+		require.NoError(t, os.Mkdir(filepath.Join(dir, "test2"), 0700))
+
+		event := next()
+		assert.Equal(t, EventCreated, event.Type)
+		assert.Equal(t, "/test2", event.Path)
+
+		require.NoError(t, os.Rename(filepath.Join(dir, "test2"), filepath.Join(dir, "test1", "inner")))
+		event = next()
+		assert.Equal(t, EventRenamed, event.Type)
+		assert.Equal(t, "/test1/inner", event.Path)
+
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "test1", "inner", "baz"), []byte("baz"), 0600))
+		event = next()
+		assert.Equal(t, EventCreated, event.Type)
+		assert.Equal(t, "/test1/inner/baz", event.Path)
+		assert.Equal(t, EventModified, next().Type)
+	})
+
+	t.Run("moved outside", func(t *testing.T) {
+		outside, err := ioutil.TempDir("", "outside")
+		require.NoError(t, err)
+		defer os.RemoveAll(outside)
+
+		require.NoError(t, os.Rename(filepath.Join(dir, "test1", "inner"), filepath.Join(outside, "inner")))
+		event := next()
+		assert.Equal(t, EventRemoved, event.Type)
+		assert.Equal(t, "/test1/inner", event.Path)
+
+		require.NoError(t, ioutil.WriteFile(filepath.Join(outside, "inner", "qux"), []byte("qux"), 0600))
+		select {
+		case event := <-events:
+			t.Fatalf("unexpected event %v", event)
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+}
+
+func TestWatcherSplitMoves(t *testing.T) {
+	broker := NewBroker()
+	events, cancel := broker.Subscribe()
+	defer cancel()
+
+	w := &Watcher{
+		broker:   broker,
+		module:   module.Files,
+		basePath: "/base",
+		paths:    map[int]string{1: "/base"},
+		moves:    map[uint32]moveFrom{},
+	}
+
+	rawEvent := func(mask, cookie uint32, name string) []byte {
+		buf := make([]byte, syscall.SizeofInotifyEvent+16)
+		event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[0]))
+		event.Wd, event.Mask, event.Cookie, event.Len = 1, mask, cookie, 16
+		copy(buf[syscall.SizeofInotifyEvent:], name)
+		return buf
+	}
+
+	t.Run("renamed", func(t *testing.T) {
+		w.process(rawEvent(syscall.IN_MOVED_FROM, 1, "foo"))
+		w.expireMoves(time.Now().Add(-moveTimeout))
+		w.process(rawEvent(syscall.IN_MOVED_TO, 1, "bar"))
+
+		event := <-events
+		assert.Equal(t, EventRenamed, event.Type)
+		assert.Equal(t, "/bar", event.Path)
+		assert.Equal(t, "/foo", event.OldPath)
+		assert.Len(t, w.moves, 0)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		w.process(rawEvent(syscall.IN_MOVED_FROM, 2, "foo"))
+		w.expireMoves(time.Now())
+
+		event := <-events
+		assert.Equal(t, EventRemoved, event.Type)
+		assert.Equal(t, "/foo", event.Path)
+		assert.Len(t, w.moves, 0)
+	})
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+// +build !linux
+
+package events
+
+import "github.com/ap4y/cloud/module"
+
+// Watcher is not available on this platform.
+type Watcher struct{}
+
+// Watch returns ErrUnsupported on platforms without inotify.
+func Watch(broker *Broker, mod module.Type, basePath string) (*Watcher, error) {
+	return nil, ErrUnsupported
+}
+
+// Close is a no-op on this platform.
+func (w *Watcher) Close() error {
+	return nil
+}
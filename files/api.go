@@ -1,16 +1,23 @@
 package files
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 	"net/url"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/go-chi/chi"
 
+	"github.com/ap4y/cloud/acl"
 	"github.com/ap4y/cloud/contextkey"
 	"github.com/ap4y/cloud/internal/httputil"
+	"github.com/ap4y/cloud/internal/pathutil"
 	"github.com/ap4y/cloud/module"
 	"github.com/ap4y/cloud/share"
 )
@@ -21,30 +28,102 @@ type apiItem struct {
 	URL      string    `json:"url"`
 }
 
+type apiListing struct {
+	Path       string    `json:"path"`
+	Items      []apiItem `json:"items"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
 type filesAPI struct {
 	http.Handler
-	source Source
+	resolve func(req *http.Request) (Source, error)
+	// sourceName identifies source resolved for a request.
+	sourceName func(req *http.Request) string
+	uploads    UploadStore
+}
+
+// NewFilesAPI returns a new http.Handler instance that implements
+// files related endpoints. Resumable uploads are staged in uploads.
+func NewFilesAPI(source Source, uploads UploadStore) http.Handler {
+	resolve := func(*http.Request) (Source, error) { return source, nil }
+	return newFilesAPI(resolve, func(*http.Request) string { return "" }, uploads)
+}
+
+// NewHomesAPI returns a new http.Handler instance that implements
+// files related endpoints over home folders of users. Resumable
+// uploads are staged in uploads.
+func NewHomesAPI(homes *Homes, uploads UploadStore) http.Handler {
+	home := func(req *http.Request) string {
+		name, _ := homes.home(req)
+		return name
+	}
+	return newFilesAPI(homes.resolve, home, uploads)
 }
 
-// NewFilesAPI returns a new http.Handler instance that implements files related endpoints.
-func NewFilesAPI(source Source) http.Handler {
+func newFilesAPI(resolve func(req *http.Request) (Source, error), sourceName func(req *http.Request) string, uploads UploadStore) http.Handler {
 	mux := chi.NewRouter()
-	api := &filesAPI{mux, source}
+	api := &filesAPI{mux, resolve, sourceName, uploads}
 
+	mux.Use(api.sourceHandler)
 	mux.Route("/", func(r chi.Router) {
-		r.Get("/", verifyHandler("", api.listTree))
-		r.Post("/mkdir/{path}*", share.BlockHandler(api.createFolder))
-		r.Post("/rmdir/{path}*", share.BlockHandler(api.removeFolder))
-		r.Post("/upload/{path}*", share.BlockHandler(api.uploadFile))
+		r.Get("/", listHandler("", api.listTree))
+		r.Get("/list", listHandler("", api.listFolder))
+		r.Get("/list/{path}*", listHandler("path", api.listFolder))
+		r.Post("/mkdir/{path}*", share.BlockHandler(writeHandler("path", api.createFolder)))
+		r.Post("/rmdir/{path}*", share.BlockHandler(writeHandler("path", api.removeFolder)))
+		r.Post("/upload/{path}*", share.BlockHandler(writeHandler("path", api.uploadFile)))
 		r.Get("/file/{path}*", verifyHandler("path", api.getFile))
-		r.Delete("/file/{path}*", share.BlockHandler(api.removeFile))
+		r.Get("/stat/{path}*", verifyHandler("path", api.statItem))
+		r.Get("/archive", listHandler("", api.getArchive))
+		r.Get("/archive/{path}*", listHandler("path", api.getArchive))
+		r.Delete("/file/{path}*", share.BlockHandler(writeHandler("path", api.removeFile)))
+		r.Post("/move", share.BlockHandler(api.moveItem))
+		r.Post("/copy", share.BlockHandler(api.copyItem))
+
+		// Trash contains items from all paths, access is verified
+		// against original path of each item.
+		r.Get("/trash", share.BlockHandler(trashHandler(api.listTrash)))
+		r.Delete("/trash", share.BlockHandler(trashHandler(api.emptyTrash)))
+		r.Post("/trash/{id}/restore", share.BlockHandler(trashHandler(api.trashItemHandler(api.restoreTrashItem))))
+		r.Delete("/trash/{id}", share.BlockHandler(trashHandler(api.trashItemHandler(api.purgeTrashItem))))
+
+		r.Route("/uploads", func(r chi.Router) {
+			r.Use(tusHandler, acl.ModuleHandler(module.Files, acl.Write))
+			r.Options("/", share.BlockHandler(api.uploadOptions))
+			r.Post("/", share.BlockHandler(api.createUpload))
+			r.Head("/{id}", share.BlockHandler(api.uploadStatus))
+			r.Patch("/{id}", share.BlockHandler(api.patchUpload))
+			r.Delete("/{id}", share.BlockHandler(api.terminateUpload))
+		})
 	})
 
 	return api
 }
 
+// sourceHandler places source resolved for a request into the
+// request context.
+func (api *filesAPI) sourceHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		source, err := api.resolve(req)
+		if err == ErrNoShareOwner {
+			httputil.Error(w, err.Error(), http.StatusGone)
+			return
+		} else if err != nil {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+
+		next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), contextkey.SourceCtxKey, source)))
+	})
+}
+
+// source returns source resolved for a request.
+func (api *filesAPI) source(req *http.Request) Source {
+	return req.Context().Value(contextkey.SourceCtxKey).(Source)
+}
+
 func (api *filesAPI) listTree(w http.ResponseWriter, req *http.Request) {
-	tree, err := api.source.Tree()
+	tree, err := api.source(req).Tree()
 	if err != nil {
 		httputil.Error(w, fmt.Sprint("failed to traverse path:", err), http.StatusBadRequest)
 		return
@@ -66,11 +145,54 @@ func (api *filesAPI) listTree(w http.ResponseWriter, req *http.Request) {
 		tree.Children = filtered
 	}
 
+	visibleTree(req, tree)
 	httputil.Respond(w, toAPIItem(tree))
 }
 
+func (api *filesAPI) listFolder(w http.ResponseWriter, req *http.Request) {
+	limit := 0
+	if param := req.URL.Query().Get("limit"); param != "" {
+		var err error
+		if limit, err = strconv.Atoi(param); err != nil {
+			httputil.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	dirPath := "/" + chi.URLParam(req, "path")
+	share, isShare := req.Context().Value(contextkey.ShareCtxKey).(*share.Share)
+	if isShare && dirPath == "/" {
+		dirPath = share.Name
+	}
+
+	query := req.URL.Query()
+	listing, err := api.source(req).List(dirPath, query.Get("cursor"), limit, ListSort(query.Get("sort")))
+	if err != nil {
+		httputil.Error(w, fmt.Sprint("failed to list folder:", err), http.StatusBadRequest)
+		return
+	}
+
+	// Only shared items are listed in a share root, pages of such
+	// listing may contain less items than limit.
+	if isShare && chi.URLParam(req, "path") == "" {
+		filtered := make([]*Item, 0, len(listing.Items))
+		for _, item := range listing.Items {
+			if share.Includes(share.Name, item.Path) {
+				filtered = append(filtered, item)
+			}
+		}
+		listing.Items = filtered
+	}
+
+	if !acl.Allowed(req, module.Files, listing.Path, acl.Read) {
+		listing.Items = visibleItems(req, listing.Items)
+	}
+
+	httputil.Respond(w, apiListing{listing.Path, apiTree(listing.Items), listing.NextCursor})
+}
+
 func (api *filesAPI) createFolder(w http.ResponseWriter, req *http.Request) {
-	item, err := api.source.Mkdir(chi.URLParam(req, "path"))
+	item, err := api.source(req).Mkdir(chi.URLParam(req, "path"))
 	if err != nil {
 		httputil.Error(w, fmt.Sprint("failed to created folder:", err), http.StatusBadRequest)
 		return
@@ -80,7 +202,7 @@ func (api *filesAPI) createFolder(w http.ResponseWriter, req *http.Request) {
 }
 
 func (api *filesAPI) removeFolder(w http.ResponseWriter, req *http.Request) {
-	item, err := api.source.Rmdir(chi.URLParam(req, "path"))
+	item, err := api.source(req).Rmdir(chi.URLParam(req, "path"))
 	if err != nil {
 		httputil.Error(w, fmt.Sprint("failed to created folder:", err), http.StatusBadRequest)
 		return
@@ -104,7 +226,7 @@ func (api *filesAPI) uploadFile(w http.ResponseWriter, req *http.Request) {
 	}
 
 	defer file.Close()
-	item, err := api.source.Save(file, path)
+	item, err := api.source(req).Save(file, path)
 	if err != nil {
 		httputil.Error(w, fmt.Sprint("failed to save upload:", err), http.StatusBadRequest)
 		return
@@ -115,7 +237,7 @@ func (api *filesAPI) uploadFile(w http.ResponseWriter, req *http.Request) {
 
 func (api *filesAPI) getFile(w http.ResponseWriter, req *http.Request) {
 	filePath := chi.URLParam(req, "path")
-	file, err := api.source.File(filePath)
+	file, err := api.source(req).File(filePath)
 	if err != nil {
 		httputil.Error(w, fmt.Sprint("failed to traverse path:", err), http.StatusBadRequest)
 		return
@@ -130,9 +252,100 @@ func (api *filesAPI) getFile(w http.ResponseWriter, req *http.Request) {
 	http.ServeContent(w, req, fi.Name(), fi.ModTime(), file)
 }
 
+func (api *filesAPI) getArchive(w http.ResponseWriter, req *http.Request) {
+	source := api.source(req)
+	base := pathutil.Clean(chi.URLParam(req, "path"))
+	name := path.Base(base)
+	var items []*Item
+
+	if share, ok := req.Context().Value(contextkey.ShareCtxKey).(*share.Share); ok && base == "/" {
+		base, name = share.Name, path.Base(share.Name)
+		for _, itemPath := range share.Items {
+			if item, err := source.Stat(itemPath, false); err == nil {
+				items = append(items, item)
+			}
+		}
+	} else if item, err := source.Stat(base, false); err != nil {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	} else if base == "/" {
+		if items, err = listAll(source, base); err != nil {
+			httputil.Error(w, fmt.Sprint("failed to list path:", err), http.StatusBadRequest)
+			return
+		}
+		items = visibleItems(req, items)
+	} else {
+		base, items = path.Dir(base), []*Item{item}
+	}
+
+	if name == "/" {
+		name = "files"
+	}
+
+	archive := httputil.NewArchive(w, name+".zip")
+	for _, item := range items {
+		if err := archiveItem(req, source, archive, base, item); err != nil {
+			log.Println("failed to archive item:", err)
+			panic(http.ErrAbortHandler)
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		log.Println("failed to archive item:", err)
+	}
+}
+
+// archiveItem adds item into archive, directories are listed and
+// added recursively. Only children visible to the user from the
+// request context are added.
+func archiveItem(req *http.Request, source Source, archive *httputil.Archive, base string, item *Item) error {
+	name := strings.TrimPrefix(strings.TrimPrefix(item.Path, base), "/")
+	if item.Type == ItemTypeDirectory {
+		if err := archive.AddDir(name, item.ModTime); err != nil {
+			return err
+		}
+
+		children, err := listAll(source, item.Path)
+		if err != nil {
+			return err
+		}
+
+		if !acl.Allowed(req, module.Files, item.Path, acl.Read) {
+			children = visibleItems(req, children)
+		}
+
+		for _, child := range children {
+			if err := archiveItem(req, source, archive, base, child); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	file, err := source.File(item.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return archive.AddFile(name, item.ModTime, file)
+}
+
+func (api *filesAPI) statItem(w http.ResponseWriter, req *http.Request) {
+	withHash, _ := strconv.ParseBool(req.URL.Query().Get("hash"))
+	item, err := api.source(req).Stat(chi.URLParam(req, "path"), withHash)
+	if err != nil {
+		httputil.Error(w, fmt.Sprint("failed to stat item:", err), http.StatusNotFound)
+		return
+	}
+
+	httputil.Respond(w, toAPIItem(item))
+}
+
 func (api *filesAPI) removeFile(w http.ResponseWriter, req *http.Request) {
 	filePath := chi.URLParam(req, "path")
-	item, err := api.source.Remove(filePath)
+	item, err := api.source(req).Remove(filePath)
 	if err != nil {
 		httputil.Error(w, fmt.Sprint("failed to remove file:", err), http.StatusBadRequest)
 		return
@@ -141,6 +354,145 @@ func (api *filesAPI) removeFile(w http.ResponseWriter, req *http.Request) {
 	httputil.Respond(w, toAPIItem(item))
 }
 
+type transferRequest struct {
+	Src string `json:"src"`
+	Dst string `json:"dst"`
+}
+
+func (api *filesAPI) moveItem(w http.ResponseWriter, req *http.Request) {
+	api.transferItem(w, req, acl.Write, api.source(req).Move)
+}
+
+func (api *filesAPI) copyItem(w http.ResponseWriter, req *http.Request) {
+	api.transferItem(w, req, acl.Read, api.source(req).Copy)
+}
+
+// transferItem transfers item between paths, srcAccess defines access
+// required to the source path.
+func (api *filesAPI) transferItem(w http.ResponseWriter, req *http.Request, srcAccess acl.Access, transfer func(src, dst string) (*Item, error)) {
+	body := &transferRequest{}
+	if err := json.NewDecoder(req.Body).Decode(body); err != nil {
+		httputil.Error(w, fmt.Sprint("failed to decode json:", err), http.StatusBadRequest)
+		return
+	}
+
+	if body.Src == "" || body.Dst == "" {
+		httputil.Error(w, "src and dst are required", http.StatusBadRequest)
+		return
+	}
+
+	if !acl.Allowed(req, module.Files, body.Src, srcAccess) || !acl.Allowed(req, module.Files, body.Dst, acl.Write) {
+		httputil.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	item, err := transfer(body.Src, body.Dst)
+	if err == ErrConflict {
+		httputil.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		httputil.Error(w, fmt.Sprint("failed to transfer item:", err), http.StatusBadRequest)
+		return
+	}
+
+	httputil.Respond(w, toAPIItem(item))
+}
+
+func (api *filesAPI) listTrash(w http.ResponseWriter, req *http.Request) {
+	items, err := api.source(req).Trash()
+	if err != nil {
+		httputil.Error(w, fmt.Sprint("failed to list trash:", err), http.StatusBadRequest)
+		return
+	}
+
+	filtered := make([]TrashItem, 0, len(items))
+	for _, item := range items {
+		if acl.Allowed(req, module.Files, item.Path, acl.Write) {
+			filtered = append(filtered, item)
+		}
+	}
+
+	httputil.Respond(w, filtered)
+}
+
+// trashItemHandler verifies write access of the user from the context
+// to the original path of the trash item parameter.
+func (api *filesAPI) trashItemHandler(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		items, err := api.source(req).Trash()
+		if err != nil {
+			httputil.Error(w, fmt.Sprint("failed to list trash:", err), http.StatusBadRequest)
+			return
+		}
+
+		id := chi.URLParam(req, "id")
+		for _, item := range items {
+			if item.ID == id && !acl.Allowed(req, module.Files, item.Path, acl.Write) {
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
+
+func (api *filesAPI) restoreTrashItem(w http.ResponseWriter, req *http.Request) {
+	item, err := api.source(req).Restore(chi.URLParam(req, "id"))
+	if err == ErrConflict {
+		httputil.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		httputil.Error(w, fmt.Sprint("failed to restore item:", err), http.StatusBadRequest)
+		return
+	}
+
+	httputil.Respond(w, toAPIItem(item))
+}
+
+func (api *filesAPI) purgeTrashItem(w http.ResponseWriter, req *http.Request) {
+	if err := api.source(req).Purge(chi.URLParam(req, "id")); err != nil {
+		httputil.Error(w, fmt.Sprint("failed to purge item:", err), http.StatusBadRequest)
+		return
+	}
+
+	httputil.Respond(w, map[string]string{})
+}
+
+// emptyTrash purges all trash items the user from the context has
+// write access to.
+func (api *filesAPI) emptyTrash(w http.ResponseWriter, req *http.Request) {
+	source := api.source(req)
+	if acl.Allowed(req, module.Files, "", acl.Write) {
+		if err := source.ExpireTrash(0); err != nil {
+			httputil.Error(w, fmt.Sprint("failed to empty trash:", err), http.StatusBadRequest)
+			return
+		}
+
+		httputil.Respond(w, map[string]string{})
+		return
+	}
+
+	items, err := source.Trash()
+	if err != nil {
+		httputil.Error(w, fmt.Sprint("failed to list trash:", err), http.StatusBadRequest)
+		return
+	}
+
+	for _, item := range items {
+		if !acl.Allowed(req, module.Files, item.Path, acl.Write) {
+			continue
+		}
+
+		if err := source.Purge(item.ID); err != nil {
+			httputil.Error(w, fmt.Sprint("failed to empty trash:", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	httputil.Respond(w, map[string]string{})
+}
+
 func itemPath(item *Item) string {
 	if item.Type == ItemTypeFile {
 		return fmt.Sprintf("/file%s", item.Path)
@@ -155,6 +507,33 @@ func toAPIItem(item *Item) apiItem {
 	return aItem
 }
 
+// visibleItems returns items the user from the request context can
+// see, parents of allowed paths are visible to navigate to them.
+func visibleItems(req *http.Request, items []*Item) []*Item {
+	filtered := make([]*Item, 0, len(items))
+	for _, item := range items {
+		if acl.Visible(req, module.Files, item.Path, acl.Read) {
+			filtered = append(filtered, item)
+		}
+	}
+
+	return filtered
+}
+
+// visibleTree removes nodes of the tree the user from the request
+// context can't see.
+func visibleTree(req *http.Request, tree *Item) {
+	if acl.Allowed(req, module.Files, tree.Path, acl.Read) {
+		return
+	}
+
+	tree.Children = visibleItems(req, tree.Children)
+	tree.ChildCount = len(tree.Children)
+	for _, child := range tree.Children {
+		visibleTree(req, child)
+	}
+}
+
 func apiTree(tree []*Item) []apiItem {
 	result := make([]apiItem, len(tree))
 	for idx, item := range tree {
@@ -194,7 +573,45 @@ func locateTreeNode(tree *Item, path string) *Item {
 	return node
 }
 
+// writeHandler verifies write access of the user from the context to
+// the item parameter, empty parameter refers to all files.
+func writeHandler(itemParam string, next http.HandlerFunc) http.HandlerFunc {
+	return acl.VerifyHandler(module.Files, acl.Write, itemParam, "", next)
+}
+
+// trashHandler verifies that user from the context has write access
+// to some files, trash items are verified by handlers.
+func trashHandler(next http.HandlerFunc) http.HandlerFunc {
+	return acl.ModuleHandler(module.Files, acl.Write)(next).ServeHTTP
+}
+
+// verifyHandler verifies share and read access of the user from the
+// context against item parameter.
 func verifyHandler(itemParam string, next http.HandlerFunc) http.HandlerFunc {
+	return shareHandler(itemParam, acl.VerifyHandler(module.Files, acl.Read, itemParam, "", next))
+}
+
+// listHandler verifies share and that user from the context can see
+// item parameter, listed items have to be filtered by handlers.
+func listHandler(itemParam string, next http.HandlerFunc) http.HandlerFunc {
+	return shareHandler(itemParam, func(w http.ResponseWriter, req *http.Request) {
+		p := ""
+		if itemParam != "" {
+			p = chi.URLParam(req, itemParam)
+		}
+
+		if !acl.Visible(req, module.Files, p, acl.Read) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
+
+// shareHandler verifies that item parameter is included in the share
+// from the context.
+func shareHandler(itemParam string, next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 		share, ok := req.Context().Value(contextkey.ShareCtxKey).(*share.Share)
 		if !ok {
@@ -212,14 +629,11 @@ func verifyHandler(itemParam string, next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		filePath := "/" + chi.URLParam(req, itemParam)
-		for _, item := range share.Items {
-			if strings.HasPrefix(filePath, item) {
-				next.ServeHTTP(w, req)
-				return
-			}
+		if !share.IncludesPath(pathutil.Clean(chi.URLParam(req, itemParam))) {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
 		}
 
-		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		next.ServeHTTP(w, req)
 	})
 }
@@ -1,6 +1,7 @@
 package files
 
 import (
+	"archive/zip"
 	"bytes"
 	"context"
 	"encoding/json"
@@ -10,11 +11,13 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/ap4y/cloud/acl"
 	"github.com/ap4y/cloud/contextkey"
 	"github.com/ap4y/cloud/module"
 	"github.com/ap4y/cloud/share"
@@ -24,10 +27,17 @@ func TestFilesAPI(t *testing.T) {
 	pwd, err := os.Getwd()
 	require.NoError(t, err)
 
-	src, err := NewDiskSource(filepath.Join(pwd, "fixtures"))
+	src, err := NewDiskSource(filepath.Join(pwd, "fixtures"), "")
 	require.NoError(t, err)
 
-	api := NewFilesAPI(src)
+	uploadsDir, err := ioutil.TempDir("", "uploads")
+	require.NoError(t, err)
+	defer os.RemoveAll(uploadsDir)
+
+	uploads, err := NewDiskUploadStore(uploadsDir)
+	require.NoError(t, err)
+
+	api := NewFilesAPI(src, uploads)
 
 	share := &share.Share{Type: module.Files, Name: "/test1", Items: []string{"/test1/inner"}}
 
@@ -67,6 +77,160 @@ func TestFilesAPI(t *testing.T) {
 		require.Len(t, item.Children, 1)
 	})
 
+	viewer := &acl.User{Role: acl.RoleViewer, Rules: []acl.Rule{{Module: module.Files, Path: "/test1/inner"}}}
+
+	t.Run("listTree/with rules", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://cloud.api/", nil)
+		ctx := context.WithValue(req.Context(), contextkey.UserCtxKey, viewer)
+		api.ServeHTTP(w, req.WithContext(ctx))
+
+		resp := w.Result()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		tree := &apiItem{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(tree))
+		require.Len(t, tree.Children, 1)
+		assert.Equal(t, "/test1", tree.Children[0].Path)
+		require.Len(t, tree.Children[0].Children, 1)
+		assert.Equal(t, "/test1/inner", tree.Children[0].Children[0].Path)
+		assert.Len(t, tree.Children[0].Children[0].Children, 1)
+	})
+
+	t.Run("getFile/with rules and dot segments", func(t *testing.T) {
+		for path, code := range map[string]int{
+			"/file/test1/inner/foo":          http.StatusOK,
+			"/file/test2/../test1/inner/foo": http.StatusForbidden,
+		} {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "http://cloud.api"+path, nil)
+			ctx := context.WithValue(req.Context(), contextkey.UserCtxKey, viewer)
+			api.ServeHTTP(w, req.WithContext(ctx))
+			assert.Equal(t, code, w.Result().StatusCode, path)
+		}
+	})
+
+	t.Run("listFolder/with rules", func(t *testing.T) {
+		for _, tc := range []struct {
+			path  string
+			code  int
+			items []string
+		}{
+			{"/list", http.StatusOK, []string{"/test1"}},
+			{"/list/test1", http.StatusOK, []string{"/test1/inner"}},
+			{"/list/test1/inner", http.StatusOK, []string{"/test1/inner/foo"}},
+			{"/list/test2", http.StatusForbidden, nil},
+		} {
+			t.Run(tc.path, func(t *testing.T) {
+				w := httptest.NewRecorder()
+				req := httptest.NewRequest("GET", "http://cloud.api"+tc.path, nil)
+				ctx := context.WithValue(req.Context(), contextkey.UserCtxKey, viewer)
+				api.ServeHTTP(w, req.WithContext(ctx))
+
+				resp := w.Result()
+				require.Equal(t, tc.code, resp.StatusCode)
+				if tc.items == nil {
+					return
+				}
+
+				listing := &apiListing{}
+				require.NoError(t, json.NewDecoder(resp.Body).Decode(listing))
+				paths := make([]string, len(listing.Items))
+				for i, item := range listing.Items {
+					paths[i] = item.Path
+				}
+				assert.Equal(t, tc.items, paths)
+			})
+		}
+	})
+
+	t.Run("getArchive/with rules", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://cloud.api/archive", nil)
+		ctx := context.WithValue(req.Context(), contextkey.UserCtxKey, viewer)
+		api.ServeHTTP(w, req.WithContext(ctx))
+
+		resp := w.Result()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+		require.NoError(t, err)
+
+		names := make([]string, len(zr.File))
+		for i, file := range zr.File {
+			names[i] = file.Name
+		}
+		assert.Equal(t, []string{"test1/", "test1/inner/", "test1/inner/foo"}, names)
+	})
+
+	t.Run("listFolder", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://cloud.api/list/test1?limit=1", nil)
+		api.ServeHTTP(w, req)
+
+		resp := w.Result()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		listing := &apiListing{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(listing))
+		assert.Equal(t, "/test1", listing.Path)
+		require.Len(t, listing.Items, 1)
+		assert.Equal(t, "/test1/inner", listing.Items[0].Path)
+		require.NotEmpty(t, listing.NextCursor)
+
+		w = httptest.NewRecorder()
+		req = httptest.NewRequest("GET", "http://cloud.api/list/test1?limit=1&cursor="+listing.NextCursor, nil)
+		api.ServeHTTP(w, req)
+
+		resp = w.Result()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		listing = &apiListing{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(listing))
+		require.Len(t, listing.Items, 1)
+		assert.Equal(t, "/test1/bar", listing.Items[0].Path)
+		assert.Equal(t, "/file/test1/bar", listing.Items[0].URL)
+		assert.Empty(t, listing.NextCursor)
+
+		w = httptest.NewRecorder()
+		req = httptest.NewRequest("GET", "http://cloud.api/list?sort=foo", nil)
+		api.ServeHTTP(w, req)
+		require.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+	})
+
+	t.Run("listFolder/with share", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://cloud.api/list", nil)
+		ctx := context.WithValue(req.Context(), contextkey.ShareCtxKey, share)
+		api.ServeHTTP(w, req.WithContext(ctx))
+
+		resp := w.Result()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		listing := &apiListing{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(listing))
+		assert.Equal(t, "/test1", listing.Path)
+		require.Len(t, listing.Items, 1)
+		assert.Equal(t, "/test1/inner", listing.Items[0].Path)
+
+		w = httptest.NewRecorder()
+		req = httptest.NewRequest("GET", "http://cloud.api/list/test1/inner", nil)
+		api.ServeHTTP(w, req.WithContext(ctx))
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+	})
+
+	t.Run("listFolder/with unmatched share", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://cloud.api/list/test2", nil)
+		ctx := context.WithValue(req.Context(), contextkey.ShareCtxKey, share)
+		api.ServeHTTP(w, req.WithContext(ctx))
+
+		resp := w.Result()
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
 	t.Run("getFile", func(t *testing.T) {
 		w := httptest.NewRecorder()
 		req := httptest.NewRequest("GET", "http://cloud.api/file/foo", nil)
@@ -106,6 +270,125 @@ func TestFilesAPI(t *testing.T) {
 		require.Equal(t, http.StatusNotFound, resp.StatusCode)
 	})
 
+	t.Run("getArchive", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://cloud.api/archive/test1", nil)
+		api.ServeHTTP(w, req)
+
+		resp := w.Result()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "application/zip", resp.Header.Get("Content-Type"))
+		assert.Equal(t, `attachment; filename=test1.zip`, resp.Header.Get("Content-Disposition"))
+
+		assert.Equal(t, map[string]string{
+			"test1/":          "",
+			"test1/bar":       "bar\n",
+			"test1/inner/":    "",
+			"test1/inner/foo": "foo\n",
+		}, readArchive(t, resp))
+	})
+
+	t.Run("getArchive/root", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://cloud.api/archive", nil)
+		api.ServeHTTP(w, req)
+
+		resp := w.Result()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, `attachment; filename=files.zip`, resp.Header.Get("Content-Disposition"))
+
+		entries := readArchive(t, resp)
+		assert.Equal(t, "foo\n", entries["foo"])
+		assert.Equal(t, "foo\n", entries["test1/inner/foo"])
+		assert.Contains(t, entries, "test2/baz")
+	})
+
+	t.Run("getArchive/with share", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://cloud.api/archive", nil)
+		ctx := context.WithValue(req.Context(), contextkey.ShareCtxKey, share)
+		api.ServeHTTP(w, req.WithContext(ctx))
+
+		resp := w.Result()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, `attachment; filename=test1.zip`, resp.Header.Get("Content-Disposition"))
+
+		assert.Equal(t, map[string]string{
+			"inner/":    "",
+			"inner/foo": "foo\n",
+		}, readArchive(t, resp))
+	})
+
+	t.Run("getArchive/with unmatched share", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://cloud.api/archive/test1", nil)
+		ctx := context.WithValue(req.Context(), contextkey.ShareCtxKey, share)
+		api.ServeHTTP(w, req.WithContext(ctx))
+
+		resp := w.Result()
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("getArchive/with share traversal", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://cloud.api/archive/test1/inner/../../test2", nil)
+		ctx := context.WithValue(req.Context(), contextkey.ShareCtxKey, share)
+		api.ServeHTTP(w, req.WithContext(ctx))
+
+		resp := w.Result()
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("getArchive/missing", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://cloud.api/archive/missing", nil)
+		api.ServeHTTP(w, req)
+
+		resp := w.Result()
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("statItem", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://cloud.api/stat/foo?hash=true", nil)
+		api.ServeHTTP(w, req)
+
+		resp := w.Result()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		item := &apiItem{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(item))
+		assert.Equal(t, "/foo", item.Path)
+		assert.Equal(t, "/file/foo", item.URL)
+		assert.Equal(t, int64(4), item.Size)
+		assert.Equal(t, "text/plain; charset=utf-8", item.MimeType)
+		assert.Equal(t, "b5bb9d8014a0f9b1d61e21e796d78dccdf1352f23cd32812f4850b878ae4944c", item.SHA256)
+
+		w = httptest.NewRecorder()
+		req = httptest.NewRequest("GET", "http://cloud.api/stat/missing", nil)
+		api.ServeHTTP(w, req)
+		require.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+	})
+
+	t.Run("statItem/with share", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://cloud.api/stat/test1/inner", nil)
+		ctx := context.WithValue(req.Context(), contextkey.ShareCtxKey, share)
+		api.ServeHTTP(w, req.WithContext(ctx))
+
+		resp := w.Result()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		item := &apiItem{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(item))
+		assert.Equal(t, 1, item.ChildCount)
+
+		w = httptest.NewRecorder()
+		req = httptest.NewRequest("GET", "http://cloud.api/stat/foo", nil)
+		api.ServeHTTP(w, req.WithContext(ctx))
+		require.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+	})
+
 	t.Run("uploadFile/removeFile", func(t *testing.T) {
 		var buf bytes.Buffer
 		formWriter := multipart.NewWriter(&buf)
@@ -217,4 +500,241 @@ func TestFilesAPI(t *testing.T) {
 		resp := w.Result()
 		require.Equal(t, http.StatusNotFound, resp.StatusCode)
 	})
+
+	t.Run("copyItem/moveItem", func(t *testing.T) {
+		defer os.Remove("./fixtures/test2/copy")
+		defer os.Remove("./fixtures/test2/moved")
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "http://cloud.api/copy", strings.NewReader(`{"src":"/foo","dst":"/test2/copy"}`))
+		api.ServeHTTP(w, req)
+
+		resp := w.Result()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		item := &apiItem{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(item))
+		assert.Equal(t, "/test2/copy", item.Path)
+		assert.Equal(t, "/file/test2/copy", item.URL)
+
+		w = httptest.NewRecorder()
+		req = httptest.NewRequest("POST", "http://cloud.api/move", strings.NewReader(`{"src":"/test2/copy","dst":"/test2/moved"}`))
+		api.ServeHTTP(w, req)
+
+		resp = w.Result()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		item = &apiItem{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(item))
+		assert.Equal(t, "/test2/moved", item.Path)
+
+		w = httptest.NewRecorder()
+		req = httptest.NewRequest("POST", "http://cloud.api/move", strings.NewReader(`{"src":"/test2/moved","dst":"/foo"}`))
+		api.ServeHTTP(w, req)
+		require.Equal(t, http.StatusConflict, w.Result().StatusCode)
+
+		w = httptest.NewRecorder()
+		req = httptest.NewRequest("POST", "http://cloud.api/copy", strings.NewReader(`{"src":"/test2/moved"}`))
+		api.ServeHTTP(w, req)
+		require.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+	})
+
+	t.Run("moveItem/with share", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "http://cloud.api/move", strings.NewReader(`{"src":"/foo","dst":"/test2/foo"}`))
+		ctx := context.WithValue(req.Context(), contextkey.ShareCtxKey, share)
+		api.ServeHTTP(w, req.WithContext(ctx))
+
+		resp := w.Result()
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+	t.Run("listTrash/with share", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://cloud.api/trash", nil)
+		ctx := context.WithValue(req.Context(), contextkey.ShareCtxKey, share)
+		api.ServeHTTP(w, req.WithContext(ctx))
+
+		resp := w.Result()
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func readArchive(t *testing.T, resp *http.Response) map[string]string {
+	t.Helper()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+
+	entries := map[string]string{}
+	for _, file := range zr.File {
+		r, err := file.Open()
+		require.NoError(t, err)
+		content, err := ioutil.ReadAll(r)
+		require.NoError(t, err)
+		r.Close()
+
+		entries[file.Name] = string(content)
+	}
+
+	return entries
+}
+
+func TestFilesAPITrash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trash")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	basePath := filepath.Join(dir, "files")
+	require.NoError(t, os.MkdirAll(basePath, 0700))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(basePath, "foo"), []byte("foo\n"), 0600))
+
+	src, err := NewDiskSource(basePath, filepath.Join(dir, "trash"))
+	require.NoError(t, err)
+
+	uploads, err := NewDiskUploadStore(filepath.Join(dir, "uploads"))
+	require.NoError(t, err)
+
+	api := NewFilesAPI(src, uploads)
+
+	listTrash := func() []TrashItem {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://cloud.api/trash", nil)
+		api.ServeHTTP(w, req)
+
+		resp := w.Result()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		items := []TrashItem{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&items))
+		return items
+	}
+
+	t.Run("restoreTrashItem", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("DELETE", "http://cloud.api/file/foo", nil)
+		api.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+
+		items := listTrash()
+		require.Len(t, items, 1)
+		assert.Equal(t, "/foo", items[0].Path)
+
+		w = httptest.NewRecorder()
+		req = httptest.NewRequest("POST", "http://cloud.api/trash/"+items[0].ID+"/restore", nil)
+		api.ServeHTTP(w, req)
+
+		resp := w.Result()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		item := &apiItem{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(item))
+		assert.Equal(t, "/foo", item.Path)
+		assert.Equal(t, "/file/foo", item.URL)
+		assert.Len(t, listTrash(), 0)
+	})
+
+	t.Run("restoreTrashItem/conflict", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("DELETE", "http://cloud.api/file/foo", nil)
+		api.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+		require.NoError(t, ioutil.WriteFile(filepath.Join(basePath, "foo"), []byte("foo\n"), 0600))
+
+		items := listTrash()
+		require.Len(t, items, 1)
+
+		w = httptest.NewRecorder()
+		req = httptest.NewRequest("POST", "http://cloud.api/trash/"+items[0].ID+"/restore", nil)
+		api.ServeHTTP(w, req)
+		require.Equal(t, http.StatusConflict, w.Result().StatusCode)
+	})
+
+	t.Run("purgeTrashItem", func(t *testing.T) {
+		items := listTrash()
+		require.Len(t, items, 1)
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("DELETE", "http://cloud.api/trash/"+items[0].ID, nil)
+		api.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+		assert.Len(t, listTrash(), 0)
+
+		w = httptest.NewRecorder()
+		req = httptest.NewRequest("DELETE", "http://cloud.api/trash/"+items[0].ID, nil)
+		api.ServeHTTP(w, req)
+		require.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+	})
+
+	t.Run("with rules", func(t *testing.T) {
+		require.NoError(t, os.MkdirAll(filepath.Join(basePath, "bar"), 0700))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(basePath, "bar", "baz"), []byte("baz\n"), 0600))
+		for _, name := range []string{"foo", "bar/baz"} {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("DELETE", "http://cloud.api/file/"+name, nil)
+			api.ServeHTTP(w, req)
+			require.Equal(t, http.StatusOK, w.Result().StatusCode)
+		}
+
+		items := listTrash()
+		require.Len(t, items, 2)
+
+		editor := &acl.User{Role: acl.RoleEditor, Rules: []acl.Rule{{Module: module.Files, Path: "/bar"}}}
+		serve := func(method, path string) *http.Response {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(method, "http://cloud.api"+path, nil)
+			ctx := context.WithValue(req.Context(), contextkey.UserCtxKey, editor)
+			api.ServeHTTP(w, req.WithContext(ctx))
+			return w.Result()
+		}
+
+		resp := serve("GET", "/trash")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		allowed := []TrashItem{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&allowed))
+		require.Len(t, allowed, 1)
+		assert.Equal(t, "/bar/baz", allowed[0].Path)
+
+		for _, item := range items {
+			code := http.StatusForbidden
+			if item.Path == "/bar/baz" {
+				code = http.StatusOK
+			}
+			assert.Equal(t, code, serve("POST", "/trash/"+item.ID+"/restore").StatusCode)
+		}
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("DELETE", "http://cloud.api/file/bar/baz", nil)
+		api.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+
+		require.Equal(t, http.StatusOK, serve("DELETE", "/trash").StatusCode)
+		items = listTrash()
+		require.Len(t, items, 1)
+		assert.Equal(t, "/foo", items[0].Path)
+		assert.Equal(t, http.StatusForbidden, serve("DELETE", "/trash/"+items[0].ID).StatusCode)
+
+		viewer := &acl.User{Role: acl.RoleViewer}
+		w = httptest.NewRecorder()
+		req = httptest.NewRequest("GET", "http://cloud.api/trash", nil)
+		api.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), contextkey.UserCtxKey, viewer)))
+		assert.Equal(t, http.StatusForbidden, w.Result().StatusCode)
+
+		w = httptest.NewRecorder()
+		req = httptest.NewRequest("POST", "http://cloud.api/trash/"+items[0].ID+"/restore", nil)
+		api.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+	})
+
+	t.Run("emptyTrash", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("DELETE", "http://cloud.api/file/foo", nil)
+		api.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+		require.Len(t, listTrash(), 1)
+
+		w = httptest.NewRecorder()
+		req = httptest.NewRequest("DELETE", "http://cloud.api/trash", nil)
+		api.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+		assert.Len(t, listTrash(), 0)
+	})
 }
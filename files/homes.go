@@ -0,0 +1,193 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ap4y/cloud/contextkey"
+	"github.com/ap4y/cloud/internal/pathutil"
+	"github.com/ap4y/cloud/share"
+)
+
+var (
+	// ErrNoHome returned for users without a home folder.
+	ErrNoHome = errors.New("home folder not found")
+	// ErrNoShareOwner returned for shares created without an owner,
+	// such shares can't be resolved to a home folder and have to be
+	// recreated.
+	ErrNoShareOwner = errors.New("share has no owner")
+)
+
+// Homes provides isolated per-user sources rooted at home folders of
+// a base path. Optional shared folder is mounted into every home.
+type Homes struct {
+	sync.Mutex
+	basePath   string
+	trashPath  string
+	homes      map[string]Source
+	shared     Source
+	sharedName string
+}
+
+// NewHomes returns sources rooted at {basePath}/{username}, homes of
+// provided users are created upfront and remaining homes are created
+// on first access. Removed items are moved into per-user folders of
+// trashPath, empty trashPath disables trash. Non-empty sharedName
+// defines folder of basePath that is visible to all users under the
+// same name.
+func NewHomes(basePath, trashPath, sharedName string, usernames []string) (*Homes, error) {
+	h := &Homes{basePath: basePath, trashPath: trashPath, homes: map[string]Source{}, sharedName: sharedName}
+
+	if sharedName != "" {
+		source, err := h.newSource(sharedName)
+		if err != nil {
+			return nil, err
+		}
+		h.shared = source
+	}
+
+	for _, username := range usernames {
+		if _, err := h.Source(username); err != nil {
+			return nil, fmt.Errorf("%s: %s", username, err)
+		}
+	}
+
+	return h, nil
+}
+
+func (h *Homes) newSource(name string) (Source, error) {
+	if err := os.MkdirAll(filepath.Join(h.basePath, name), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create home dir: %s", err)
+	}
+
+	trash := ""
+	if h.trashPath != "" {
+		trash = filepath.Join(h.trashPath, name)
+	}
+
+	return NewDiskSource(filepath.Join(h.basePath, name), trash)
+}
+
+// Source returns home source of a user, ErrNoHome is returned for
+// usernames that can't be used as folder names.
+func (h *Homes) Source(username string) (Source, error) {
+	if !pathutil.IsFolderName(username) || username == h.sharedName {
+		return nil, ErrNoHome
+	}
+
+	h.Lock()
+	defer h.Unlock()
+
+	home, ok := h.homes[username]
+	if !ok {
+		var err error
+		if home, err = h.newSource(username); err != nil {
+			return nil, err
+		}
+		h.homes[username] = home
+	}
+
+	if h.shared == nil {
+		return home, nil
+	}
+
+	return newMountSource(home, h.shared, h.sharedName), nil
+}
+
+// ExpireTrash permanently removes items trashed longer than retention
+// ago from all homes and a shared folder.
+func (h *Homes) ExpireTrash(retention time.Duration) error {
+	h.Lock()
+	homes := make(map[string]Source, len(h.homes))
+	for username, home := range h.homes {
+		homes[username] = home
+	}
+	h.Unlock()
+
+	for username, home := range homes {
+		if err := home.ExpireTrash(retention); err != nil {
+			return fmt.Errorf("%s: %s", username, err)
+		}
+	}
+
+	if h.shared == nil {
+		return nil
+	}
+
+	return h.shared.ExpireTrash(retention)
+}
+
+// resolve returns home source of the user from the request context,
+// shares resolve against home of the share owner.
+func (h *Homes) resolve(req *http.Request) (Source, error) {
+	username, err := h.home(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.Source(username)
+}
+
+// home returns name of the home folder resolved for a request.
+func (h *Homes) home(req *http.Request) (string, error) {
+	username, _ := req.Context().Value(contextkey.UsernameCtxKey).(string)
+	if s, ok := req.Context().Value(contextkey.ShareCtxKey).(*share.Share); ok {
+		if s.Owner == "" {
+			return "", ErrNoShareOwner
+		}
+		username = s.Owner
+	}
+
+	return username, nil
+}
+
+type homesWebDAV struct {
+	sync.Mutex
+	homes    *Homes
+	prefix   string
+	handlers map[string]http.Handler
+}
+
+// NewHomesWebDAV returns a new http.Handler that implements WebDAV
+// protocol for home sources of authenticated users. prefix defines
+// path handler is mounted on.
+func NewHomesWebDAV(homes *Homes, prefix string) http.Handler {
+	return &homesWebDAV{homes: homes, prefix: prefix, handlers: map[string]http.Handler{}}
+}
+
+func (dav *homesWebDAV) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	handler, err := dav.handler(req)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	handler.ServeHTTP(w, req)
+}
+
+// handler returns WebDAV handler of the user from the request
+// context, handlers are cached to keep locks between requests.
+func (dav *homesWebDAV) handler(req *http.Request) (http.Handler, error) {
+	username, _ := req.Context().Value(contextkey.UsernameCtxKey).(string)
+
+	dav.Lock()
+	defer dav.Unlock()
+
+	if handler, ok := dav.handlers[username]; ok {
+		return handler, nil
+	}
+
+	source, err := dav.homes.Source(username)
+	if err != nil {
+		return nil, err
+	}
+
+	handler := NewWebDAV(source, dav.prefix)
+	dav.handlers[username] = handler
+	return handler, nil
+}
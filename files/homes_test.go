@@ -0,0 +1,117 @@
+package files
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ap4y/cloud/contextkey"
+	"github.com/ap4y/cloud/module"
+	"github.com/ap4y/cloud/share"
+)
+
+func TestHomes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "homes")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	_, err = NewHomes(dir, "", "shared", []string{"../foo"})
+	require.Error(t, err)
+	_, err = NewHomes(dir, "", "shared", []string{"shared"})
+	require.Error(t, err)
+
+	homes, err := NewHomes(dir, "", "shared", []string{"alice", "bob"})
+	require.NoError(t, err)
+
+	for _, name := range []string{"alice", "bob", "shared"} {
+		fi, err := os.Stat(filepath.Join(dir, name))
+		require.NoError(t, err)
+		assert.True(t, fi.IsDir())
+	}
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "alice/foo"), []byte("foo"), 0600))
+
+	_, err = homes.Source("")
+	assert.Equal(t, ErrNoHome, err)
+	_, err = homes.Source("shared")
+	assert.Equal(t, ErrNoHome, err)
+
+	_, err = homes.Source("carol")
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(dir, "carol"))
+	require.NoError(t, err)
+
+	source, err := homes.Source("bob")
+	require.NoError(t, err)
+	tree, err := source.Tree()
+	require.NoError(t, err)
+	require.Len(t, tree.Children, 1)
+	assert.Equal(t, "/shared", tree.Children[0].Path)
+
+	uploads, err := NewDiskUploadStore(filepath.Join(dir, ".uploads"))
+	require.NoError(t, err)
+	api := NewHomesAPI(homes, uploads)
+
+	fetch := func(path string, ctx context.Context) *http.Response {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://cloud.api"+path, nil)
+		api.ServeHTTP(w, req.WithContext(ctx))
+		return w.Result()
+	}
+
+	t.Run("API", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), contextkey.UsernameCtxKey, "alice")
+		resp := fetch("/list", ctx)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		listing := &apiListing{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(listing))
+		require.Len(t, listing.Items, 2)
+		assert.Equal(t, "/shared", listing.Items[0].Path)
+		assert.Equal(t, "/foo", listing.Items[1].Path)
+
+		ctx = context.WithValue(context.Background(), contextkey.UsernameCtxKey, "bob")
+		assert.Equal(t, http.StatusBadRequest, fetch("/file/foo", ctx).StatusCode)
+
+		assert.Equal(t, http.StatusNotFound, fetch("/list", context.Background()).StatusCode)
+	})
+
+	t.Run("API/with share", func(t *testing.T) {
+		s := &share.Share{Type: module.Files, Name: "/", Items: []string{"/foo"}, Owner: "alice"}
+		ctx := context.WithValue(context.Background(), contextkey.ShareCtxKey, s)
+		assert.Equal(t, http.StatusOK, fetch("/file/foo", ctx).StatusCode)
+
+		s.Owner = "bob"
+		assert.Equal(t, http.StatusBadRequest, fetch("/file/foo", ctx).StatusCode)
+
+		s.Owner = ""
+		assert.Equal(t, http.StatusGone, fetch("/file/foo", ctx).StatusCode)
+	})
+
+	t.Run("WebDAV", func(t *testing.T) {
+		dav := NewHomesWebDAV(homes, "/dav")
+		for username, status := range map[string]int{"alice": http.StatusOK, "bob": http.StatusNotFound, "": http.StatusNotFound} {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "http://cloud.api/dav/foo", nil)
+			ctx := context.WithValue(req.Context(), contextkey.UsernameCtxKey, username)
+			dav.ServeHTTP(w, req.WithContext(ctx))
+			assert.Equal(t, status, w.Result().StatusCode, username)
+		}
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("PROPFIND", "http://cloud.api/dav/", nil)
+		req.Header.Set("Depth", "1")
+		ctx := context.WithValue(req.Context(), contextkey.UsernameCtxKey, "alice")
+		dav.ServeHTTP(w, req.WithContext(ctx))
+		assert.Equal(t, http.StatusMultiStatus, w.Result().StatusCode)
+		assert.Contains(t, w.Body.String(), "<D:href>/dav/shared/</D:href>")
+		assert.Contains(t, w.Body.String(), "<D:href>/dav/foo</D:href>")
+	})
+}
@@ -0,0 +1,199 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ap4y/cloud/internal/paging"
+	"github.com/ap4y/cloud/internal/pathutil"
+)
+
+// ListSort defines sorting key of a directory listing, keys prefixed
+// with "-" sort in descending order.
+type ListSort string
+
+const (
+	// ListSortName sorts items by name.
+	ListSortName ListSort = "name"
+	// ListSortModTime sorts items by modification time.
+	ListSortModTime ListSort = "mtime"
+	// ListSortSize sorts items by size.
+	ListSortSize ListSort = "size"
+)
+
+const (
+	// DefaultListLimit defines page size used when limit is not provided.
+	DefaultListLimit = 100
+	// MaxListLimit defines maximum page size.
+	MaxListLimit = 1000
+)
+
+// ErrInvalidCursor returned for malformed cursors or cursors issued
+// for a different sorting.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Listing represents a single page of a directory listing.
+type Listing struct {
+	Path       string  `json:"path"`
+	Items      []*Item `json:"items"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+// listAll returns all items of a directory sorted by name.
+func listAll(source Source, dirPath string) ([]*Item, error) {
+	items := []*Item{}
+	cursor := ""
+	for {
+		listing, err := source.List(dirPath, cursor, MaxListLimit, ListSortName)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, listing.Items...)
+		if listing.NextCursor == "" {
+			return items, nil
+		}
+		cursor = listing.NextCursor
+	}
+}
+
+// listCursor stores sorting keys of the last returned item.
+type listCursor struct {
+	Sort    ListSort `json:"s"`
+	Dir     bool     `json:"d"`
+	Name    string   `json:"n"`
+	ModTime int64    `json:"t"`
+	Size    int64    `json:"z"`
+}
+
+func (ds *diskSource) List(dirPath, cursor string, limit int, sortBy ListSort) (*Listing, error) {
+	key, desc := strings.TrimPrefix(string(sortBy), "-"), strings.HasPrefix(string(sortBy), "-")
+	switch ListSort(key) {
+	case "":
+		sortBy, key = ListSortName, string(ListSortName)
+	case ListSortName, ListSortModTime, ListSortSize:
+	default:
+		return nil, fmt.Errorf("unknown sort: %s", sortBy)
+	}
+
+	if limit <= 0 {
+		limit = DefaultListLimit
+	} else if limit > MaxListLimit {
+		limit = MaxListLimit
+	}
+
+	diskPath := pathutil.Join(ds.basePath, dirPath)
+	fis, err := readDir(diskPath)
+	if err != nil {
+		return nil, err
+	}
+
+	relPath, err := filepath.Rel(ds.basePath, diskPath)
+	if err != nil {
+		return nil, fmt.Errorf("rel %s: %s", diskPath, err)
+	}
+	relPath = filepath.Join("/", relPath)
+
+	items := make([]*Item, len(fis))
+	for idx, fi := range fis {
+		items[idx] = newItem(filepath.Join(relPath, fi.Name()), fi)
+	}
+
+	less := func(a, b *Item) bool { return listLess(a, b, ListSort(key), desc) }
+	sort.Slice(items, func(i, j int) bool { return less(items[i], items[j]) })
+
+	if cursor != "" {
+		c := &listCursor{}
+		if err := paging.DecodeCursor(cursor, c); err != nil || c.Sort != sortBy {
+			return nil, ErrInvalidCursor
+		}
+
+		last := c.item()
+		items = items[sort.Search(len(items), func(i int) bool { return less(last, items[i]) }):]
+	}
+
+	listing := &Listing{Path: relPath, Items: items}
+	if len(items) > limit {
+		listing.Items = items[:limit]
+		listing.NextCursor = encodeListCursor(sortBy, items[limit-1])
+	}
+
+	for _, item := range listing.Items {
+		if item.Type == ItemTypeDirectory {
+			item.ChildCount = countEntries(filepath.Join(diskPath, item.Name))
+		}
+	}
+
+	return listing, nil
+}
+
+// listLess orders directories before files and items by a sorting
+// key, ties are resolved by name.
+func listLess(a, b *Item, key ListSort, desc bool) bool {
+	if a.Type != b.Type {
+		return a.Type == ItemTypeDirectory
+	}
+
+	switch {
+	case key == ListSortModTime && !a.ModTime.Equal(b.ModTime):
+		return a.ModTime.Before(b.ModTime) != desc
+	case key == ListSortSize && a.Size != b.Size:
+		return (a.Size < b.Size) != desc
+	case a.Name != b.Name:
+		return (a.Name < b.Name) != desc
+	}
+
+	return false
+}
+
+func readDir(diskPath string) ([]os.FileInfo, error) {
+	dir, err := os.Open(diskPath)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %s", diskPath, err)
+	}
+	defer dir.Close()
+
+	fis, err := dir.Readdir(-1)
+	if err != nil {
+		return nil, fmt.Errorf("readdir %s: %s", diskPath, err)
+	}
+
+	return fis, nil
+}
+
+// countEntries returns number of directory entries, unreadable
+// directories are reported as empty.
+func countEntries(diskPath string) int {
+	dir, err := os.Open(diskPath)
+	if err != nil {
+		return 0
+	}
+	defer dir.Close()
+
+	names, _ := dir.Readdirnames(-1)
+	return len(names)
+}
+
+func encodeListCursor(sortBy ListSort, item *Item) string {
+	return paging.EncodeCursor(listCursor{
+		Sort:    sortBy,
+		Dir:     item.Type == ItemTypeDirectory,
+		Name:    item.Name,
+		ModTime: item.ModTime.UnixNano(),
+		Size:    item.Size,
+	})
+}
+
+func (c *listCursor) item() *Item {
+	item := &Item{Type: ItemTypeFile, Name: c.Name, ModTime: time.Unix(0, c.ModTime), Size: c.Size}
+	if c.Dir {
+		item.Type = ItemTypeDirectory
+	}
+
+	return item
+}
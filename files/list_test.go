@@ -0,0 +1,118 @@
+package files
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskSourceList(t *testing.T) {
+	dir, err := ioutil.TempDir("", "list")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	files := []struct {
+		name    string
+		size    int
+		modTime time.Time
+	}{
+		{"a", 3, now.Add(-time.Hour)},
+		{"b", 1, now.Add(-3 * time.Hour)},
+		{"c", 2, now.Add(-2 * time.Hour)},
+		{"d", 2, now},
+	}
+	for _, file := range files {
+		path := filepath.Join(dir, file.name)
+		require.NoError(t, ioutil.WriteFile(path, []byte(strings.Repeat("x", file.size)), 0600))
+		require.NoError(t, os.Chtimes(path, file.modTime, file.modTime))
+	}
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "z", "inner"), 0700))
+
+	source, err := NewDiskSource(dir, "")
+	require.NoError(t, err)
+
+	names := func(listing *Listing) []string {
+		result := make([]string, len(listing.Items))
+		for idx, item := range listing.Items {
+			result[idx] = item.Name
+		}
+		return result
+	}
+
+	t.Run("sort", func(t *testing.T) {
+		tcs := []struct {
+			sort  ListSort
+			names []string
+		}{
+			{"", []string{"z", "a", "b", "c", "d"}},
+			{ListSortName, []string{"z", "a", "b", "c", "d"}},
+			{"-name", []string{"z", "d", "c", "b", "a"}},
+			{ListSortModTime, []string{"z", "b", "c", "a", "d"}},
+			{"-mtime", []string{"z", "d", "a", "c", "b"}},
+			{ListSortSize, []string{"z", "b", "c", "d", "a"}},
+			{"-size", []string{"z", "a", "d", "c", "b"}},
+		}
+
+		for _, tc := range tcs {
+			listing, err := source.List("/", "", 0, tc.sort)
+			require.NoError(t, err)
+			assert.Equal(t, "/", listing.Path)
+			assert.Equal(t, tc.names, names(listing), string(tc.sort))
+			assert.Empty(t, listing.NextCursor)
+		}
+
+		_, err := source.List("/", "", 0, "foo")
+		require.Error(t, err)
+	})
+
+	t.Run("pagination", func(t *testing.T) {
+		listing, err := source.List("/", "", 2, "-mtime")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"z", "d"}, names(listing))
+		require.NotEmpty(t, listing.NextCursor)
+
+		cursor := listing.NextCursor
+		listing, err = source.List("/", cursor, 2, "-mtime")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a", "c"}, names(listing))
+		require.NotEmpty(t, listing.NextCursor)
+
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "e"), []byte("e"), 0600))
+		defer os.Remove(filepath.Join(dir, "e"))
+
+		listing, err = source.List("/", listing.NextCursor, 2, "-mtime")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"b"}, names(listing))
+		assert.Empty(t, listing.NextCursor)
+
+		_, err = source.List("/", cursor, 2, "name")
+		assert.Equal(t, ErrInvalidCursor, err)
+		_, err = source.List("/", "foo", 2, "-mtime")
+		assert.Equal(t, ErrInvalidCursor, err)
+	})
+
+	t.Run("folder", func(t *testing.T) {
+		listing, err := source.List("/z", "", 0, "")
+		require.NoError(t, err)
+		assert.Equal(t, "/z", listing.Path)
+		require.Len(t, listing.Items, 1)
+		assert.Equal(t, "/z/inner", listing.Items[0].Path)
+		assert.Equal(t, ItemTypeDirectory, listing.Items[0].Type)
+
+		listing, err = source.List("../z", "", 0, "")
+		require.NoError(t, err)
+		assert.Equal(t, "/z", listing.Path)
+
+		_, err = source.List("/a", "", 0, "")
+		require.Error(t, err)
+		_, err = source.List("/missing", "", 0, "")
+		require.Error(t, err)
+	})
+}
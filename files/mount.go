@@ -0,0 +1,275 @@
+package files
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ap4y/cloud/internal/pathutil"
+)
+
+// errCrossMount returned for transfers between mounted sources.
+var errCrossMount = errors.New("transfer between mounted folders is not supported")
+
+// mountSource serves a source mounted as a top level folder of
+// another source, e.g. a shared folder inside of a home folder.
+// Items of the root source with the same name are hidden.
+type mountSource struct {
+	Source
+	mount Source
+	name  string
+}
+
+// newMountSource returns source that serves mount on /name of root.
+func newMountSource(root, mount Source, name string) Source {
+	return &mountSource{root, mount, "/" + strings.Trim(name, "/")}
+}
+
+// resolve returns source of a path along with a path relative to it.
+func (ms *mountSource) resolve(p string) (Source, string) {
+	p = pathutil.Clean(p)
+	if p == ms.name || strings.HasPrefix(p, ms.name+"/") {
+		return ms.mount, "/" + strings.TrimPrefix(strings.TrimPrefix(p, ms.name), "/")
+	}
+
+	return ms.Source, p
+}
+
+func (ms *mountSource) isMountPoint(p string) bool {
+	return pathutil.Clean(p) == ms.name
+}
+
+// prefix rewrites paths of mounted items to paths of the root source.
+func (ms *mountSource) prefix(item *Item) *Item {
+	if item.Path == "/" {
+		item.Name = path.Base(ms.name)
+	}
+	item.Path = path.Join(ms.name, item.Path)
+
+	for _, child := range item.Children {
+		ms.prefix(child)
+	}
+
+	return item
+}
+
+func (ms *mountSource) withoutMountPoint(items []*Item) []*Item {
+	filtered := make([]*Item, 0, len(items))
+	for _, item := range items {
+		if item.Path != ms.name {
+			filtered = append(filtered, item)
+		}
+	}
+
+	return filtered
+}
+
+func (ms *mountSource) Tree() (*Item, error) {
+	tree, err := ms.Source.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	mounted, err := ms.mount.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	tree.Children = append(ms.withoutMountPoint(tree.Children), ms.prefix(mounted))
+	tree.ChildCount = len(tree.Children)
+	return tree, nil
+}
+
+func (ms *mountSource) Stat(p string, withHash bool) (*Item, error) {
+	source, relPath := ms.resolve(p)
+	item, err := source.Stat(relPath, withHash)
+	if err != nil || source == ms.Source {
+		return item, err
+	}
+
+	return ms.prefix(item), nil
+}
+
+// List returns listing of a mounted or a root folder, mount point is
+// returned first on the first page of the root listing.
+func (ms *mountSource) List(dirPath, cursor string, limit int, sortBy ListSort) (*Listing, error) {
+	source, relPath := ms.resolve(dirPath)
+	listing, err := source.List(relPath, cursor, limit, sortBy)
+	if err != nil {
+		return nil, err
+	}
+
+	if source == ms.mount {
+		listing.Path = path.Join(ms.name, listing.Path)
+		for _, item := range listing.Items {
+			ms.prefix(item)
+		}
+
+		return listing, nil
+	}
+
+	listing.Items = ms.withoutMountPoint(listing.Items)
+	if relPath != "/" || cursor != "" {
+		return listing, nil
+	}
+
+	mountPoint, err := ms.Stat(ms.name, false)
+	if err != nil {
+		return nil, err
+	}
+
+	listing.Items = append([]*Item{mountPoint}, listing.Items...)
+	return listing, nil
+}
+
+func (ms *mountSource) Mkdir(p string) (*Item, error) {
+	source, relPath := ms.resolve(p)
+	item, err := source.Mkdir(relPath)
+	if err != nil || source == ms.Source {
+		return item, err
+	}
+
+	return ms.prefix(item), nil
+}
+
+func (ms *mountSource) Rmdir(p string) (*Item, error) {
+	if ms.isMountPoint(p) {
+		return nil, errors.New("invalid path")
+	}
+
+	source, relPath := ms.resolve(p)
+	item, err := source.Rmdir(relPath)
+	if err != nil || source == ms.Source {
+		return item, err
+	}
+
+	return ms.prefix(item), nil
+}
+
+func (ms *mountSource) File(filePath string) (*os.File, error) {
+	source, relPath := ms.resolve(filePath)
+	return source.File(relPath)
+}
+
+func (ms *mountSource) Save(r io.Reader, filePath string) (*Item, error) {
+	source, relPath := ms.resolve(filePath)
+	item, err := source.Save(r, relPath)
+	if err != nil || source == ms.Source {
+		return item, err
+	}
+
+	return ms.prefix(item), nil
+}
+
+func (ms *mountSource) Import(srcPath, filePath string) (*Item, error) {
+	source, relPath := ms.resolve(filePath)
+	item, err := source.Import(srcPath, relPath)
+	if err != nil || source == ms.Source {
+		return item, err
+	}
+
+	return ms.prefix(item), nil
+}
+
+func (ms *mountSource) Remove(filePath string) (*Item, error) {
+	if ms.isMountPoint(filePath) {
+		return nil, errors.New("invalid path")
+	}
+
+	source, relPath := ms.resolve(filePath)
+	item, err := source.Remove(relPath)
+	if err != nil || source == ms.Source {
+		return item, err
+	}
+
+	return ms.prefix(item), nil
+}
+
+func (ms *mountSource) Move(src, dst string) (*Item, error) {
+	return ms.transfer(src, dst, Source.Move)
+}
+
+func (ms *mountSource) Copy(src, dst string) (*Item, error) {
+	return ms.transfer(src, dst, Source.Copy)
+}
+
+func (ms *mountSource) transfer(src, dst string, transfer func(Source, string, string) (*Item, error)) (*Item, error) {
+	if ms.isMountPoint(src) || ms.isMountPoint(dst) {
+		return nil, errors.New("invalid path")
+	}
+
+	srcSource, srcPath := ms.resolve(src)
+	dstSource, dstPath := ms.resolve(dst)
+	if srcSource != dstSource {
+		return nil, errCrossMount
+	}
+
+	item, err := transfer(srcSource, srcPath, dstPath)
+	if err != nil || srcSource == ms.Source {
+		return item, err
+	}
+
+	return ms.prefix(item), nil
+}
+
+// Trash returns trashed items of both sources, newest first.
+func (ms *mountSource) Trash() ([]TrashItem, error) {
+	items, err := ms.Source.Trash()
+	if err != nil {
+		return nil, err
+	}
+
+	mounted, err := ms.mount.Trash()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range mounted {
+		item.Path = path.Join(ms.name, item.Path)
+		items = append(items, item)
+	}
+
+	sortTrash(items)
+	return items, nil
+}
+
+func (ms *mountSource) Restore(id string) (*Item, error) {
+	source := ms.trashSource(id)
+	item, err := source.Restore(id)
+	if err != nil || source == ms.Source {
+		return item, err
+	}
+
+	return ms.prefix(item), nil
+}
+
+func (ms *mountSource) Purge(id string) error {
+	return ms.trashSource(id).Purge(id)
+}
+
+func (ms *mountSource) ExpireTrash(retention time.Duration) error {
+	if err := ms.Source.ExpireTrash(retention); err != nil {
+		return err
+	}
+
+	return ms.mount.ExpireTrash(retention)
+}
+
+// trashSource returns source that contains trashed item.
+func (ms *mountSource) trashSource(id string) Source {
+	items, err := ms.mount.Trash()
+	if err != nil {
+		return ms.Source
+	}
+
+	for _, item := range items {
+		if item.ID == id {
+			return ms.mount
+		}
+	}
+
+	return ms.Source
+}
@@ -0,0 +1,121 @@
+package files
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMountSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mount")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"home/docs", "home/shared", "common/photos", "trash"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, name), 0700))
+	}
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "home/docs/foo"), []byte("foo"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "common/photos/bar"), []byte("bar"), 0600))
+
+	home, err := NewDiskSource(filepath.Join(dir, "home"), filepath.Join(dir, "trash/home"))
+	require.NoError(t, err)
+	common, err := NewDiskSource(filepath.Join(dir, "common"), filepath.Join(dir, "trash/common"))
+	require.NoError(t, err)
+
+	source := newMountSource(home, common, "shared")
+
+	t.Run("Tree", func(t *testing.T) {
+		tree, err := source.Tree()
+		require.NoError(t, err)
+		require.Len(t, tree.Children, 2)
+		assert.Equal(t, 2, tree.ChildCount)
+
+		assert.Equal(t, "/docs", tree.Children[0].Path)
+
+		mounted := tree.Children[1]
+		assert.Equal(t, "shared", mounted.Name)
+		assert.Equal(t, "/shared", mounted.Path)
+		require.Len(t, mounted.Children, 1)
+		assert.Equal(t, "/shared/photos", mounted.Children[0].Path)
+		assert.Equal(t, "/shared/photos/bar", mounted.Children[0].Children[0].Path)
+	})
+
+	t.Run("List", func(t *testing.T) {
+		listing, err := source.List("/", "", 0, ListSortName)
+		require.NoError(t, err)
+		require.Len(t, listing.Items, 2)
+		assert.Equal(t, "/shared", listing.Items[0].Path)
+		assert.Equal(t, "/docs", listing.Items[1].Path)
+
+		listing, err = source.List("/shared/photos", "", 0, ListSortName)
+		require.NoError(t, err)
+		assert.Equal(t, "/shared/photos", listing.Path)
+		require.Len(t, listing.Items, 1)
+		assert.Equal(t, "/shared/photos/bar", listing.Items[0].Path)
+	})
+
+	t.Run("File", func(t *testing.T) {
+		file, err := source.File("/shared/photos/bar")
+		require.NoError(t, err)
+		defer file.Close()
+
+		data, err := ioutil.ReadAll(file)
+		require.NoError(t, err)
+		assert.Equal(t, "bar", string(data))
+
+		// ".." segments are dropped the same way as by a disk source.
+		_, err = source.File("/shared/../docs/foo")
+		require.Error(t, err)
+	})
+
+	t.Run("Save", func(t *testing.T) {
+		item, err := source.Save(strings.NewReader("baz"), "/shared/baz")
+		require.NoError(t, err)
+		assert.Equal(t, "/shared/baz", item.Path)
+
+		_, err = os.Stat(filepath.Join(dir, "common/baz"))
+		require.NoError(t, err)
+	})
+
+	t.Run("Move", func(t *testing.T) {
+		item, err := source.Move("/shared/baz", "/shared/photos/baz")
+		require.NoError(t, err)
+		assert.Equal(t, "/shared/photos/baz", item.Path)
+
+		_, err = source.Move("/shared/photos/baz", "/docs/baz")
+		assert.Equal(t, errCrossMount, err)
+
+		_, err = source.Move("/shared", "/docs/shared")
+		assert.Error(t, err)
+	})
+
+	t.Run("Trash", func(t *testing.T) {
+		_, err := source.Rmdir("/shared")
+		require.Error(t, err)
+
+		_, err = source.Remove("/shared/photos/baz")
+		require.NoError(t, err)
+		_, err = source.Remove("/docs/foo")
+		require.NoError(t, err)
+
+		items, err := source.Trash()
+		require.NoError(t, err)
+		require.Len(t, items, 2)
+		assert.Equal(t, "/docs/foo", items[0].Path)
+		assert.Equal(t, "/shared/photos/baz", items[1].Path)
+
+		item, err := source.Restore(items[1].ID)
+		require.NoError(t, err)
+		assert.Equal(t, "/shared/photos/baz", item.Path)
+
+		require.NoError(t, source.Purge(items[0].ID))
+		items, err = source.Trash()
+		require.NoError(t, err)
+		assert.Len(t, items, 0)
+	})
+}
@@ -4,10 +4,15 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"mime"
 	"os"
 	"path/filepath"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/ap4y/cloud/internal/filecache"
 	"github.com/ap4y/cloud/internal/pathutil"
 )
 
@@ -23,30 +28,71 @@ const (
 
 // Item represents a single source file.
 type Item struct {
-	Type     ItemType  `json:"type"`
-	Name     string    `json:"name"`
-	Path     string    `json:"path"`
-	ModTime  time.Time `json:"updated_at"`
-	Children []*Item   `json:"children"`
+	Type    ItemType  `json:"type"`
+	Name    string    `json:"name"`
+	Path    string    `json:"path"`
+	ModTime time.Time `json:"updated_at"`
+	Size    int64     `json:"size"`
+	// MimeType is detected using file extension, content is
+	// sniffed by Stat for unknown extensions.
+	MimeType string `json:"mime_type,omitempty"`
+	// Mode stores octal unix permissions.
+	Mode       string `json:"mode,omitempty"`
+	ChildCount int    `json:"child_count"`
+	// SHA256 is only populated by Stat on request.
+	SHA256   string  `json:"sha256,omitempty"`
+	Children []*Item `json:"children"`
 }
 
+// ErrConflict returned when destination path already exists.
+var ErrConflict = errors.New("destination already exists")
+
 // Source provides album and images metadata.
 type Source interface {
 	Tree() (*Item, error)
+	// Stat returns metadata of a single item, content hash is
+	// calculated for files when withHash is set.
+	Stat(path string, withHash bool) (*Item, error)
+	// List returns a single page of a directory listing sorted by
+	// sortBy. Listing starts after the item encoded in cursor, empty
+	// cursor returns the first page.
+	List(dirPath, cursor string, limit int, sortBy ListSort) (*Listing, error)
 	Mkdir(path string) (*Item, error)
 	Rmdir(path string) (*Item, error)
 	File(filePath string) (*os.File, error)
 	Save(r io.Reader, filePath string) (*Item, error)
+	// Import moves file at srcPath on disk to filePath, file is
+	// copied only when paths are on different filesystems. Unlike
+	// Save existing items are not replaced, ErrConflict is returned
+	// instead.
+	Import(srcPath, filePath string) (*Item, error)
 	Remove(filePath string) (*Item, error)
+	// Move moves file or directory to a new path.
+	Move(src, dst string) (*Item, error)
+	// Copy recursively copies file or directory to a new path.
+	// Symlinks are copied as links, relative links keep their
+	// targets and links outside of the source are skipped.
+	Copy(src, dst string) (*Item, error)
+	// Trash returns items removed into a recycle bin.
+	Trash() ([]TrashItem, error)
+	// Restore moves trashed item back to it's original path.
+	Restore(id string) (*Item, error)
+	// Purge permanently removes trashed item.
+	Purge(id string) error
+	// ExpireTrash permanently removes items trashed longer than retention ago.
+	ExpireTrash(retention time.Duration) error
 }
 
 type diskSource struct {
-	basePath string
+	basePath  string
+	trashPath string
+	hashes    *filecache.Cache
 }
 
 // NewDiskSource returns disk based source for a provided base dir
-// path. Only images with requested extensions are returned.
-func NewDiskSource(basePath string) (Source, error) {
+// path. Removed items are moved into trashPath, empty trashPath
+// disables trash and items are removed permanently.
+func NewDiskSource(basePath, trashPath string) (Source, error) {
 	if !filepath.IsAbs(basePath) {
 		return nil, errors.New("path is not absolute")
 	}
@@ -60,7 +106,22 @@ func NewDiskSource(basePath string) (Source, error) {
 		return nil, errors.New("path is not directory")
 	}
 
-	return &diskSource{basePath}, nil
+	if trashPath != "" {
+		if !filepath.IsAbs(trashPath) {
+			return nil, errors.New("trash path is not absolute")
+		}
+
+		rel, err := filepath.Rel(basePath, trashPath)
+		if err != nil || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))) {
+			return nil, errors.New("trash path is inside of path")
+		}
+
+		if err := os.MkdirAll(trashPath, 0700); err != nil {
+			return nil, fmt.Errorf("failed to create trash dir: %s", err)
+		}
+	}
+
+	return &diskSource{basePath, trashPath, filecache.New(maxHashCacheEntries)}, nil
 }
 
 func (ds *diskSource) Tree() (*Item, error) {
@@ -89,23 +150,9 @@ func (ds *diskSource) Tree() (*Item, error) {
 		}
 		relPath := "/" + rel
 
-		var item *Item
+		item := newItem(relPath, fi)
 		if fi.IsDir() {
-			item = &Item{
-				Type:     ItemTypeDirectory,
-				Name:     fi.Name(),
-				Path:     relPath,
-				ModTime:  fi.ModTime(),
-				Children: make([]*Item, 0),
-			}
 			items[relPath+string(filepath.Separator)] = item
-		} else {
-			item = &Item{
-				Type:    ItemTypeFile,
-				Name:    fi.Name(),
-				Path:    relPath,
-				ModTime: fi.ModTime(),
-			}
 		}
 
 		dirPath, _ := filepath.Split(relPath)
@@ -118,6 +165,10 @@ func (ds *diskSource) Tree() (*Item, error) {
 		return nil, fmt.Errorf("walk: %s", err)
 	}
 
+	for _, item := range items {
+		item.ChildCount = len(item.Children)
+	}
+
 	return items["/"], nil
 }
 
@@ -143,7 +194,11 @@ func (ds *diskSource) Mkdir(path string) (*Item, error) {
 
 func (ds *diskSource) Rmdir(path string) (*Item, error) {
 	diskPath := pathutil.Join(ds.basePath, path)
-	if err := os.RemoveAll(diskPath); err != nil {
+	if diskPath == ds.basePath {
+		return nil, errors.New("invalid path")
+	}
+
+	if err := ds.discard(diskPath, os.RemoveAll); err != nil {
 		return nil, fmt.Errorf("rmdir %s: %s", diskPath, err)
 	}
 
@@ -175,16 +230,30 @@ func (ds *diskSource) File(filePath string) (*os.File, error) {
 func (ds *diskSource) Save(r io.Reader, filePath string) (*Item, error) {
 	diskPath := pathutil.Join(ds.basePath, filePath)
 
-	file, err := os.OpenFile(diskPath, os.O_RDWR|os.O_CREATE, 0600)
+	// Data is written into a temporary file first and renamed
+	// afterwards so partially written files never appear in a tree.
+	dir, name := filepath.Split(diskPath)
+	file, err := ioutil.TempFile(dir, "."+name+".")
+	if err != nil {
+		return nil, fmt.Errorf("file: %s", err)
+	}
+	defer os.Remove(file.Name()) // nolint: errcheck
+
+	size, err := io.Copy(file, r)
 	if err != nil {
+		file.Close()
 		return nil, fmt.Errorf("file: %s", err)
 	}
 
-	if _, err := io.Copy(file, r); err != nil {
+	if err := file.Close(); err != nil {
 		return nil, fmt.Errorf("file: %s", err)
 	}
 
-	relPath, err := filepath.Rel(ds.basePath, file.Name())
+	if err := os.Rename(file.Name(), diskPath); err != nil {
+		return nil, fmt.Errorf("rename: %s", err)
+	}
+
+	relPath, err := filepath.Rel(ds.basePath, diskPath)
 	if err != nil {
 		return nil, fmt.Errorf("rel %s: %s", diskPath, err)
 	}
@@ -195,13 +264,48 @@ func (ds *diskSource) Save(r io.Reader, filePath string) (*Item, error) {
 		Name:    filename,
 		Path:    "/" + relPath,
 		ModTime: time.Now(),
+		Size:    size,
 	}, nil
 }
 
+func (ds *diskSource) Import(srcPath, filePath string) (*Item, error) {
+	diskPath := pathutil.Join(ds.basePath, filePath)
+
+	if _, err := os.Lstat(diskPath); err == nil {
+		return nil, ErrConflict
+	}
+
+	err := os.Rename(srcPath, diskPath)
+	if err == nil {
+		return ds.item(diskPath)
+	}
+
+	if !isCrossDevice(err) {
+		return nil, fmt.Errorf("rename: %s", err)
+	}
+
+	file, err := os.Open(srcPath)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %s", srcPath, err)
+	}
+	defer file.Close()
+
+	item, err := ds.Save(file, filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Remove(srcPath); err != nil {
+		return nil, fmt.Errorf("remove %s: %s", srcPath, err)
+	}
+
+	return item, nil
+}
+
 func (ds *diskSource) Remove(filePath string) (*Item, error) {
 	diskPath := pathutil.Join(ds.basePath, filePath)
 
-	if err := os.Remove(diskPath); err != nil {
+	if err := ds.discard(diskPath, os.Remove); err != nil {
 		return nil, err
 	}
 
@@ -218,3 +322,209 @@ func (ds *diskSource) Remove(filePath string) (*Item, error) {
 		ModTime: time.Now(),
 	}, nil
 }
+
+func (ds *diskSource) Move(src, dst string) (*Item, error) {
+	srcPath, dstPath, err := ds.transferPaths(src, dst)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := movePath(srcPath, dstPath); err != nil {
+		return nil, err
+	}
+
+	return ds.item(dstPath)
+}
+
+func (ds *diskSource) Copy(src, dst string) (*Item, error) {
+	srcPath, dstPath, err := ds.transferPaths(src, dst)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := copyPath(ds.basePath, srcPath, dstPath); err != nil {
+		os.RemoveAll(dstPath) // nolint: errcheck
+		return nil, err
+	}
+
+	return ds.item(dstPath)
+}
+
+// transferPaths returns disk paths for move and copy operations.
+func (ds *diskSource) transferPaths(src, dst string) (string, string, error) {
+	srcPath := pathutil.Join(ds.basePath, src)
+	dstPath := pathutil.Join(ds.basePath, dst)
+
+	if srcPath == ds.basePath || dstPath == ds.basePath {
+		return "", "", errors.New("invalid path")
+	}
+
+	if dstPath == srcPath || strings.HasPrefix(dstPath, srcPath+string(filepath.Separator)) {
+		return "", "", errors.New("destination is inside of source")
+	}
+
+	if _, err := os.Stat(srcPath); err != nil {
+		return "", "", fmt.Errorf("stat %s: %s", srcPath, err)
+	}
+
+	if _, err := os.Lstat(dstPath); err == nil {
+		return "", "", ErrConflict
+	}
+
+	return srcPath, dstPath, nil
+}
+
+func (ds *diskSource) item(diskPath string) (*Item, error) {
+	fi, err := os.Stat(diskPath)
+	if err != nil {
+		return nil, fmt.Errorf("stat %s: %s", diskPath, err)
+	}
+
+	relPath, err := filepath.Rel(ds.basePath, diskPath)
+	if err != nil {
+		return nil, fmt.Errorf("rel %s: %s", diskPath, err)
+	}
+
+	item := newItem("/"+relPath, fi)
+	item.Children = nil
+	return item, nil
+}
+
+// newItem returns item populated from file info, directories have
+// empty children.
+func newItem(relPath string, fi os.FileInfo) *Item {
+	item := &Item{
+		Type:    ItemTypeFile,
+		Name:    fi.Name(),
+		Path:    relPath,
+		ModTime: fi.ModTime(),
+		Size:    fi.Size(),
+		Mode:    fmt.Sprintf("%04o", fi.Mode().Perm()),
+	}
+
+	if fi.IsDir() {
+		item.Type = ItemTypeDirectory
+		item.Size = 0
+		item.Children = make([]*Item, 0)
+	} else {
+		item.MimeType = mime.TypeByExtension(filepath.Ext(fi.Name()))
+	}
+
+	return item
+}
+
+// movePath renames src to dst, falls back to copy when paths are on
+// different filesystems.
+func movePath(src, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil {
+		return nil
+	}
+
+	if !isCrossDevice(err) {
+		return fmt.Errorf("rename: %s", err)
+	}
+
+	if err := copyPath("", src, dst); err != nil {
+		os.RemoveAll(dst) // nolint: errcheck
+		return err
+	}
+
+	if err := os.RemoveAll(src); err != nil {
+		return fmt.Errorf("remove %s: %s", src, err)
+	}
+
+	return nil
+}
+
+// isCrossDevice returns true for rename errors caused by paths on
+// different filesystems.
+func isCrossDevice(err error) bool {
+	linkErr, ok := err.(*os.LinkError)
+	return ok && linkErr.Err == syscall.EXDEV
+}
+
+// copyPath recursively copies file or directory from src to dst.
+// Relative symlinks are rewritten for dst when base is not empty, see
+// copySymlink.
+func copyPath(base, src, dst string) error {
+	fi, err := os.Lstat(src)
+	if err != nil {
+		return fmt.Errorf("stat %s: %s", src, err)
+	}
+
+	switch {
+	case fi.Mode()&os.ModeSymlink != 0:
+		return copySymlink(base, src, dst)
+	case !fi.Mode().IsDir() && !fi.Mode().IsRegular():
+		return nil
+	case !fi.IsDir():
+		return copyFile(src, dst, fi.Mode().Perm())
+	}
+
+	if err := os.Mkdir(dst, fi.Mode().Perm()); err != nil {
+		return fmt.Errorf("mkdir %s: %s", dst, err)
+	}
+
+	fis, err := ioutil.ReadDir(src)
+	if err != nil {
+		return fmt.Errorf("read dir %s: %s", src, err)
+	}
+
+	for _, fi := range fis {
+		if err := copyPath(base, filepath.Join(src, fi.Name()), filepath.Join(dst, fi.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// copySymlink recreates symlink instead of following it, so copies
+// never include files outside of the copied path. With non-empty base
+// relative links are rewritten to point to the same target from dst
+// and links with targets outside of base are skipped. Absolute links
+// and links of moved items keep their targets.
+func copySymlink(base, src, dst string) error {
+	target, err := os.Readlink(src)
+	if err != nil {
+		return fmt.Errorf("readlink %s: %s", src, err)
+	}
+
+	if base != "" && !filepath.IsAbs(target) {
+		targetPath := filepath.Join(filepath.Dir(src), target)
+		if targetPath != base && !strings.HasPrefix(targetPath, base+string(filepath.Separator)) {
+			return nil
+		}
+
+		if target, err = filepath.Rel(filepath.Dir(dst), targetPath); err != nil {
+			return fmt.Errorf("rel %s: %s", targetPath, err)
+		}
+	}
+
+	if err := os.Symlink(target, dst); err != nil {
+		return fmt.Errorf("symlink %s: %s", dst, err)
+	}
+
+	return nil
+}
+
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("open %s: %s", src, err)
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return fmt.Errorf("file: %s", err)
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("copy: %s", err)
+	}
+
+	return out.Close()
+}
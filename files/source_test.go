@@ -15,7 +15,7 @@ func TestDiskSource(t *testing.T) {
 	pwd, err := os.Getwd()
 	require.NoError(t, err)
 
-	source, err := NewDiskSource(filepath.Join(pwd, "fixtures"))
+	source, err := NewDiskSource(filepath.Join(pwd, "fixtures"), "")
 	require.NoError(t, err)
 
 	t.Run("Tree", func(t *testing.T) {
@@ -26,17 +26,20 @@ func TestDiskSource(t *testing.T) {
 		assert.Equal(t, "/", tree.Path)
 		assert.Equal(t, ItemTypeDirectory, tree.Type)
 		require.Len(t, tree.Children, 3)
+		assert.Equal(t, 3, tree.ChildCount)
 
 		item := tree.Children[0]
 		assert.Equal(t, "foo", item.Name)
 		assert.Equal(t, "/foo", item.Path)
 		assert.Equal(t, ItemTypeFile, item.Type)
+		assert.Equal(t, int64(4), item.Size)
 
 		item = tree.Children[1]
 		assert.Equal(t, "test1", item.Name)
 		assert.Equal(t, "/test1", item.Path)
 		assert.Equal(t, ItemTypeDirectory, item.Type)
 		require.Len(t, item.Children, 2)
+		assert.Equal(t, 2, item.ChildCount)
 		assert.Equal(t, "bar", item.Children[0].Name)
 		assert.Equal(t, "/test1/bar", item.Children[0].Path)
 		assert.Equal(t, ItemTypeFile, item.Children[0].Type)
@@ -141,6 +144,42 @@ func TestDiskSource(t *testing.T) {
 		assert.Equal(t, "test", string(res))
 	})
 
+	t.Run("Import", func(t *testing.T) {
+		src, err := ioutil.TempFile("./fixtures", ".import")
+		require.NoError(t, err)
+		_, err = src.WriteString("test")
+		require.NoError(t, err)
+		require.NoError(t, src.Close())
+		defer os.Remove(src.Name())
+
+		item, err := source.Import(src.Name(), "/test1/test")
+		require.NoError(t, err)
+		defer os.Remove("./fixtures/test1/test")
+		assert.Equal(t, "test", item.Name)
+		assert.Equal(t, "/test1/test", item.Path)
+		assert.Equal(t, int64(4), item.Size)
+
+		res, err := ioutil.ReadFile("./fixtures/test1/test")
+		require.NoError(t, err)
+		assert.Equal(t, "test", string(res))
+
+		_, err = os.Stat(src.Name())
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("Import/existing", func(t *testing.T) {
+		src, err := ioutil.TempFile("./fixtures", ".import")
+		require.NoError(t, err)
+		require.NoError(t, src.Close())
+		defer os.Remove(src.Name())
+
+		_, err = source.Import(src.Name(), "/test1/bar")
+		assert.Equal(t, ErrConflict, err)
+
+		_, err = os.Stat(src.Name())
+		require.NoError(t, err)
+	})
+
 	t.Run("Save/unsafe_filename", func(t *testing.T) {
 		item, err := source.Save(strings.NewReader("test"), "/test1/../test")
 		require.NoError(t, err)
@@ -184,4 +223,93 @@ func TestDiskSource(t *testing.T) {
 		assert.Equal(t, "/test1/test", item.Path)
 		assert.Equal(t, ItemTypeFile, item.Type)
 	})
+
+	t.Run("Copy", func(t *testing.T) {
+		item, err := source.Copy("/test1", "/test2/copy")
+		require.NoError(t, err)
+		defer os.RemoveAll("./fixtures/test2/copy")
+
+		assert.Equal(t, ItemTypeDirectory, item.Type)
+		assert.Equal(t, "copy", item.Name)
+		assert.Equal(t, "/test2/copy", item.Path)
+
+		res, err := ioutil.ReadFile("./fixtures/test2/copy/inner/foo")
+		require.NoError(t, err)
+		assert.Equal(t, "foo\n", string(res))
+
+		item, err = source.Copy("../foo", "/test2/copy/foo")
+		require.NoError(t, err)
+		assert.Equal(t, ItemTypeFile, item.Type)
+		assert.Equal(t, "/test2/copy/foo", item.Path)
+
+		_, err = source.Copy("/foo", "/test2/copy/foo")
+		assert.Equal(t, ErrConflict, err)
+
+		_, err = source.Copy("/test1", "/test1/inner/copy")
+		require.Error(t, err)
+
+		_, err = source.Copy("/missing", "/test2/missing")
+		require.Error(t, err)
+	})
+
+	t.Run("Copy/symlinks", func(t *testing.T) {
+		require.NoError(t, os.Mkdir("./fixtures/test2/links", 0700))
+		defer os.RemoveAll("./fixtures/test2/links")
+		require.NoError(t, os.Symlink("/etc", "./fixtures/test2/links/outside"))
+		require.NoError(t, os.Symlink("..", "./fixtures/test2/links/loop"))
+		require.NoError(t, os.Symlink("../baz", "./fixtures/test2/links/sibling"))
+		require.NoError(t, os.Symlink("../../..", "./fixtures/test2/links/escape"))
+
+		tcs := []struct {
+			dst     string
+			targets map[string]string
+		}{
+			{"/test2/links_copy", map[string]string{"outside": "/etc", "loop": "..", "sibling": "../baz"}},
+			{"/test1/inner/links_copy", map[string]string{"outside": "/etc", "loop": "../../../test2", "sibling": "../../../test2/baz"}},
+		}
+
+		for _, tc := range tcs {
+			_, err := source.Copy("/test2/links", tc.dst)
+			require.NoError(t, err)
+			defer os.RemoveAll("./fixtures" + tc.dst)
+
+			for name, target := range tc.targets {
+				fi, err := os.Lstat("./fixtures" + tc.dst + "/" + name)
+				require.NoError(t, err)
+				assert.True(t, fi.Mode()&os.ModeSymlink != 0, name)
+
+				res, err := os.Readlink("./fixtures" + tc.dst + "/" + name)
+				require.NoError(t, err)
+				assert.Equal(t, target, res)
+			}
+
+			_, err = os.Lstat("./fixtures" + tc.dst + "/escape")
+			assert.True(t, os.IsNotExist(err))
+		}
+	})
+
+	t.Run("Move", func(t *testing.T) {
+		_, err := source.Save(strings.NewReader("test"), "/test1/test")
+		require.NoError(t, err)
+		defer os.Remove("./fixtures/test1/test")
+		defer os.Remove("./fixtures/test2/test")
+
+		item, err := source.Move("/test1/test", "/test2/test")
+		require.NoError(t, err)
+		assert.Equal(t, ItemTypeFile, item.Type)
+		assert.Equal(t, "test", item.Name)
+		assert.Equal(t, "/test2/test", item.Path)
+
+		_, err = os.Stat("./fixtures/test1/test")
+		assert.True(t, os.IsNotExist(err))
+		res, err := ioutil.ReadFile("./fixtures/test2/test")
+		require.NoError(t, err)
+		assert.Equal(t, "test", string(res))
+
+		_, err = source.Move("/test2/test", "/foo")
+		assert.Equal(t, ErrConflict, err)
+
+		_, err = source.Move("/", "/test2/root")
+		require.Error(t, err)
+	})
 }
@@ -0,0 +1,75 @@
+package files
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/ap4y/cloud/internal/pathutil"
+)
+
+// maxHashCacheEntries defines how many content hashes are kept in
+// memory.
+const maxHashCacheEntries = 10000
+
+// sniffLen defines how many bytes are used for content type detection.
+const sniffLen = 512
+
+func (ds *diskSource) Stat(path string, withHash bool) (*Item, error) {
+	diskPath := pathutil.Join(ds.basePath, path)
+	item, err := ds.item(diskPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if item.Type == ItemTypeDirectory {
+		item.ChildCount = countEntries(diskPath)
+		return item, nil
+	}
+
+	file, err := os.Open(diskPath)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %s", diskPath, err)
+	}
+	defer file.Close()
+
+	if item.MimeType == "" {
+		buf := make([]byte, sniffLen)
+		n, err := io.ReadFull(file, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("read %s: %s", diskPath, err)
+		}
+
+		item.MimeType = http.DetectContentType(buf[:n])
+	}
+
+	if !withHash {
+		return item, nil
+	}
+
+	fi, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("stat %s: %s", diskPath, err)
+	}
+
+	if sum, ok := ds.hashes.Get(diskPath, fi); ok {
+		item.SHA256 = sum.(string)
+		return item, nil
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("seek %s: %s", diskPath, err)
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return nil, fmt.Errorf("read %s: %s", diskPath, err)
+	}
+
+	item.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	ds.hashes.Set(diskPath, fi, item.SHA256)
+	return item, nil
+}
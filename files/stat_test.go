@@ -0,0 +1,76 @@
+package files
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskSourceStat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stat")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "test1", "inner"), 0700))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "test1", "foo"), []byte("foo\n"), 0640))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "test1", "bar.json"), []byte("{}"), 0600))
+
+	source, err := NewDiskSource(dir, "")
+	require.NoError(t, err)
+
+	t.Run("file", func(t *testing.T) {
+		item, err := source.Stat("/test1/foo", false)
+		require.NoError(t, err)
+		assert.Equal(t, ItemTypeFile, item.Type)
+		assert.Equal(t, "/test1/foo", item.Path)
+		assert.Equal(t, int64(4), item.Size)
+		assert.Equal(t, "0640", item.Mode)
+		assert.Equal(t, "text/plain; charset=utf-8", item.MimeType)
+		assert.Empty(t, item.SHA256)
+
+		item, err = source.Stat("/test1/bar.json", false)
+		require.NoError(t, err)
+		assert.Equal(t, "application/json", item.MimeType)
+	})
+
+	t.Run("directory", func(t *testing.T) {
+		item, err := source.Stat("/test1", true)
+		require.NoError(t, err)
+		assert.Equal(t, ItemTypeDirectory, item.Type)
+		assert.Equal(t, 3, item.ChildCount)
+		assert.Equal(t, int64(0), item.Size)
+		assert.Empty(t, item.MimeType)
+		assert.Empty(t, item.SHA256)
+	})
+
+	t.Run("hash", func(t *testing.T) {
+		item, err := source.Stat("/test1/foo", true)
+		require.NoError(t, err)
+		assert.Equal(t, "b5bb9d8014a0f9b1d61e21e796d78dccdf1352f23cd32812f4850b878ae4944c", item.SHA256)
+
+		path := filepath.Join(dir, "test1", "foo")
+		fi, err := os.Stat(path)
+		require.NoError(t, err)
+		sum, ok := source.(*diskSource).hashes.Get(path, fi)
+		require.True(t, ok)
+		assert.Equal(t, item.SHA256, sum)
+
+		require.NoError(t, ioutil.WriteFile(path, []byte("bar\n"), 0640))
+		modTime := fi.ModTime().Add(time.Second)
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+
+		item, err = source.Stat("/test1/foo", true)
+		require.NoError(t, err)
+		assert.Equal(t, "7d865e959b2466918c9863afca942d0fb89d7c9ac0c99bafc3749504ded97730", item.SHA256)
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		_, err := source.Stat("/test1/missing", false)
+		require.Error(t, err)
+	})
+}
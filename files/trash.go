@@ -0,0 +1,214 @@
+package files
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrTrashDisabled returned for trash operations when trash is not configured.
+var ErrTrashDisabled = errors.New("trash is disabled")
+
+// DefaultTrashRetention defines how long removed items are kept in trash.
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+// TrashItem stores metadata of a removed item.
+type TrashItem struct {
+	ID        string    `json:"id"`
+	Type      ItemType  `json:"type"`
+	Name      string    `json:"name"`
+	Path      string    `json:"path"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// discard moves item into trash or removes it if trash is disabled.
+func (ds *diskSource) discard(diskPath string, remove func(string) error) error {
+	if ds.trashPath == "" {
+		return remove(diskPath)
+	}
+
+	fi, err := os.Stat(diskPath)
+	if err != nil {
+		return err
+	}
+
+	relPath, err := filepath.Rel(ds.basePath, diskPath)
+	if err != nil {
+		return fmt.Errorf("rel %s: %s", diskPath, err)
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return fmt.Errorf("failed to generate id: %s", err)
+	}
+
+	now := time.Now()
+	item := &TrashItem{
+		ID:        fmt.Sprintf("%d-%s", now.UnixNano(), hex.EncodeToString(id)),
+		Type:      ItemTypeFile,
+		Name:      fi.Name(),
+		Path:      "/" + relPath,
+		DeletedAt: now,
+	}
+	if fi.IsDir() {
+		item.Type = ItemTypeDirectory
+	}
+
+	if err := os.Mkdir(ds.trashItemPath(item.ID), 0700); err != nil {
+		return fmt.Errorf("mkdir: %s", err)
+	}
+
+	if err := ds.saveTrashItem(item); err != nil {
+		os.Remove(ds.trashItemPath(item.ID)) // nolint: errcheck
+		return err
+	}
+
+	if err := movePath(diskPath, filepath.Join(ds.trashItemPath(item.ID), item.Name)); err != nil {
+		os.Remove(ds.trashItemPath(item.ID))           // nolint: errcheck
+		os.Remove(ds.trashItemPath(item.ID) + ".json") // nolint: errcheck
+		return err
+	}
+
+	return nil
+}
+
+func (ds *diskSource) saveTrashItem(item *TrashItem) error {
+	file, err := os.OpenFile(ds.trashItemPath(item.ID)+".json", os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("file: %s", err)
+	}
+	defer file.Close()
+
+	if err := json.NewEncoder(file).Encode(item); err != nil {
+		return fmt.Errorf("json: %s", err)
+	}
+
+	return nil
+}
+
+func (ds *diskSource) Trash() ([]TrashItem, error) {
+	if ds.trashPath == "" {
+		return []TrashItem{}, nil
+	}
+
+	matches, err := filepath.Glob(filepath.Join(ds.trashPath, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("glob: %s", err)
+	}
+
+	items := make([]TrashItem, 0, len(matches))
+	for _, match := range matches {
+		item, err := ds.trashItem(strings.TrimSuffix(filepath.Base(match), ".json"))
+		if err != nil {
+			log.Printf("skipping trash item %s: %s", match, err)
+			continue
+		}
+
+		items = append(items, *item)
+	}
+
+	sortTrash(items)
+	return items, nil
+}
+
+// sortTrash orders trashed items by deletion time, newest first.
+func sortTrash(items []TrashItem) {
+	sort.Slice(items, func(i, j int) bool { return items[i].DeletedAt.After(items[j].DeletedAt) })
+}
+
+func (ds *diskSource) Restore(id string) (*Item, error) {
+	item, err := ds.trashItem(id)
+	if err != nil {
+		return nil, err
+	}
+
+	diskPath := filepath.Join(ds.basePath, item.Path)
+	if _, err := os.Lstat(diskPath); err == nil {
+		return nil, ErrConflict
+	}
+
+	if err := os.MkdirAll(filepath.Dir(diskPath), 0700); err != nil {
+		return nil, fmt.Errorf("mkdir: %s", err)
+	}
+
+	if err := movePath(filepath.Join(ds.trashItemPath(id), item.Name), diskPath); err != nil {
+		return nil, err
+	}
+
+	if err := ds.Purge(id); err != nil {
+		return nil, err
+	}
+
+	return ds.item(diskPath)
+}
+
+func (ds *diskSource) Purge(id string) error {
+	if _, err := ds.trashItem(id); err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(ds.trashItemPath(id)); err != nil {
+		return fmt.Errorf("remove: %s", err)
+	}
+
+	if err := os.Remove(ds.trashItemPath(id) + ".json"); err != nil {
+		return fmt.Errorf("remove: %s", err)
+	}
+
+	return nil
+}
+
+func (ds *diskSource) ExpireTrash(retention time.Duration) error {
+	items, err := ds.Trash()
+	if err != nil {
+		return err
+	}
+
+	expireBefore := time.Now().Add(-retention)
+	for _, item := range items {
+		if item.DeletedAt.After(expireBefore) {
+			continue
+		}
+
+		if err := ds.Purge(item.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (ds *diskSource) trashItem(id string) (*TrashItem, error) {
+	if ds.trashPath == "" {
+		return nil, ErrTrashDisabled
+	}
+
+	if id == "" || strings.ContainsAny(id, "/\\.") {
+		return nil, errors.New("invalid id")
+	}
+
+	file, err := os.Open(ds.trashItemPath(id) + ".json")
+	if err != nil {
+		return nil, fmt.Errorf("file: %s", err)
+	}
+	defer file.Close()
+
+	item := &TrashItem{}
+	if err := json.NewDecoder(file).Decode(item); err != nil {
+		return nil, fmt.Errorf("json: %s", err)
+	}
+
+	return item, nil
+}
+
+func (ds *diskSource) trashItemPath(id string) string {
+	return filepath.Join(ds.trashPath, id)
+}
@@ -0,0 +1,175 @@
+package files
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskSourceTrash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trash")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	basePath := filepath.Join(dir, "files")
+	trashPath := filepath.Join(dir, "trash")
+	require.NoError(t, os.MkdirAll(filepath.Join(basePath, "test1", "inner"), 0700))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(basePath, "foo"), []byte("foo\n"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(basePath, "test1", "inner", "bar"), []byte("bar\n"), 0600))
+
+	_, err = NewDiskSource(basePath, filepath.Join(basePath, "trash"))
+	require.Error(t, err)
+	_, err = NewDiskSource(basePath, "trash")
+	require.Error(t, err)
+	_, err = NewDiskSource(basePath, filepath.Join(basePath, "..trash"))
+	require.Error(t, err)
+
+	source, err := NewDiskSource(basePath, trashPath)
+	require.NoError(t, err)
+
+	t.Run("Remove/Restore", func(t *testing.T) {
+		_, err := source.Remove("/foo")
+		require.NoError(t, err)
+		_, err = os.Stat(filepath.Join(basePath, "foo"))
+		require.True(t, os.IsNotExist(err))
+
+		items, err := source.Trash()
+		require.NoError(t, err)
+		require.Len(t, items, 1)
+		assert.Equal(t, "foo", items[0].Name)
+		assert.Equal(t, "/foo", items[0].Path)
+		assert.Equal(t, ItemTypeFile, items[0].Type)
+
+		item, err := source.Restore(items[0].ID)
+		require.NoError(t, err)
+		assert.Equal(t, "/foo", item.Path)
+
+		data, err := ioutil.ReadFile(filepath.Join(basePath, "foo"))
+		require.NoError(t, err)
+		assert.Equal(t, "foo\n", string(data))
+
+		items, err = source.Trash()
+		require.NoError(t, err)
+		assert.Len(t, items, 0)
+	})
+
+	t.Run("Trash/corrupt item", func(t *testing.T) {
+		corruptPath := filepath.Join(trashPath, "corrupt.json")
+		require.NoError(t, ioutil.WriteFile(corruptPath, []byte("{"), 0600))
+		defer os.Remove(corruptPath)
+
+		_, err := source.Remove("/foo")
+		require.NoError(t, err)
+
+		items, err := source.Trash()
+		require.NoError(t, err)
+		require.Len(t, items, 1)
+		assert.Equal(t, "/foo", items[0].Path)
+
+		_, err = source.Restore(items[0].ID)
+		require.NoError(t, err)
+	})
+
+	t.Run("Rmdir/Restore", func(t *testing.T) {
+		_, err := source.Rmdir("/test1")
+		require.NoError(t, err)
+
+		items, err := source.Trash()
+		require.NoError(t, err)
+		require.Len(t, items, 1)
+		assert.Equal(t, "/test1", items[0].Path)
+		assert.Equal(t, ItemTypeDirectory, items[0].Type)
+
+		_, err = source.Mkdir("/test1")
+		require.NoError(t, err)
+		_, err = source.Restore(items[0].ID)
+		require.Equal(t, ErrConflict, err)
+
+		_, err = source.Rmdir("/test1")
+		require.NoError(t, err)
+		item, err := source.Restore(items[0].ID)
+		require.NoError(t, err)
+		assert.Equal(t, "/test1", item.Path)
+
+		data, err := ioutil.ReadFile(filepath.Join(basePath, "test1", "inner", "bar"))
+		require.NoError(t, err)
+		assert.Equal(t, "bar\n", string(data))
+
+		items, err = source.Trash()
+		require.NoError(t, err)
+		require.Len(t, items, 1)
+		require.NoError(t, source.Purge(items[0].ID))
+	})
+
+	t.Run("Restore/missing parent", func(t *testing.T) {
+		_, err := source.Remove("/test1/inner/bar")
+		require.NoError(t, err)
+		_, err = source.Rmdir("/test1")
+		require.NoError(t, err)
+
+		items, err := source.Trash()
+		require.NoError(t, err)
+		require.Len(t, items, 2)
+		assert.Equal(t, "/test1", items[0].Path)
+		assert.Equal(t, "/test1/inner/bar", items[1].Path)
+
+		item, err := source.Restore(items[1].ID)
+		require.NoError(t, err)
+		assert.Equal(t, "/test1/inner/bar", item.Path)
+
+		require.NoError(t, source.Purge(items[0].ID))
+	})
+
+	t.Run("Purge", func(t *testing.T) {
+		_, err := source.Remove("/foo")
+		require.NoError(t, err)
+
+		items, err := source.Trash()
+		require.NoError(t, err)
+		require.Len(t, items, 1)
+
+		require.NoError(t, source.Purge(items[0].ID))
+		_, err = os.Stat(filepath.Join(trashPath, items[0].ID))
+		require.True(t, os.IsNotExist(err))
+
+		require.Error(t, source.Purge(items[0].ID))
+		require.Error(t, source.Purge("../files"))
+	})
+
+	t.Run("ExpireTrash", func(t *testing.T) {
+		_, err := source.Remove("/test1/inner/bar")
+		require.NoError(t, err)
+
+		require.NoError(t, source.ExpireTrash(time.Hour))
+		items, err := source.Trash()
+		require.NoError(t, err)
+		require.Len(t, items, 1)
+
+		require.NoError(t, source.ExpireTrash(0))
+		items, err = source.Trash()
+		require.NoError(t, err)
+		assert.Len(t, items, 0)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		source, err := NewDiskSource(basePath, "")
+		require.NoError(t, err)
+
+		_, err = source.Mkdir("/disabled")
+		require.NoError(t, err)
+		_, err = source.Rmdir("/disabled")
+		require.NoError(t, err)
+
+		items, err := source.Trash()
+		require.NoError(t, err)
+		assert.Len(t, items, 0)
+
+		_, err = source.Restore("foo")
+		assert.Equal(t, ErrTrashDisabled, err)
+	})
+}
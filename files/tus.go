@@ -0,0 +1,234 @@
+package files
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi"
+
+	"github.com/ap4y/cloud/acl"
+	"github.com/ap4y/cloud/contextkey"
+	"github.com/ap4y/cloud/internal/httputil"
+	"github.com/ap4y/cloud/internal/pathutil"
+	"github.com/ap4y/cloud/module"
+)
+
+// Implementation of the tus resumable upload protocol
+// (https://tus.io/protocols/resumable-upload.html), core protocol
+// with creation and termination extensions.
+
+const (
+	tusVersion     = "1.0.0"
+	tusExtensions  = "creation,termination"
+	tusContentType = "application/offset+octet-stream"
+)
+
+func tusHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Tus-Resumable", tusVersion)
+
+		if req.Method == http.MethodOptions {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		if req.Header.Get("Tus-Resumable") != tusVersion {
+			w.Header().Set("Tus-Version", tusVersion)
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
+
+func (api *filesAPI) uploadOptions(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (api *filesAPI) createUpload(w http.ResponseWriter, req *http.Request) {
+	length, err := strconv.ParseInt(req.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		httputil.Error(w, "invalid Upload-Length", http.StatusBadRequest)
+		return
+	}
+
+	metadata, err := parseUploadMetadata(req.Header.Get("Upload-Metadata"))
+	if err != nil {
+		httputil.Error(w, fmt.Sprint("invalid Upload-Metadata:", err), http.StatusBadRequest)
+		return
+	}
+
+	filename := metadata["filename"]
+	if filename == "" || filename == "." || filename == ".." || strings.ContainsAny(filename, "/\\") {
+		httputil.Error(w, "invalid filename", http.StatusBadRequest)
+		return
+	}
+
+	uploadPath := pathutil.Clean(path.Join(pathutil.Clean(metadata["path"]), filename))
+	if !acl.Allowed(req, module.Files, uploadPath, acl.Write) {
+		httputil.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	username, _ := req.Context().Value(contextkey.UsernameCtxKey).(string)
+	upload, err := api.uploads.Create(username, api.sourceName(req), length, uploadPath, metadata)
+	if err != nil {
+		httputil.Error(w, fmt.Sprint("failed to create upload:", err), http.StatusBadRequest)
+		return
+	}
+
+	if upload.IsComplete() && !api.completeUpload(w, req, upload) {
+		return
+	}
+
+	w.Header().Set("Location", strings.TrimSuffix(req.URL.Path, "/")+"/"+upload.ID)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (api *filesAPI) uploadStatus(w http.ResponseWriter, req *http.Request) {
+	upload, err := api.upload(req)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	w.WriteHeader(http.StatusOK)
+}
+
+func (api *filesAPI) patchUpload(w http.ResponseWriter, req *http.Request) {
+	if req.Header.Get("Content-Type") != tusContentType {
+		httputil.Error(w, "invalid Content-Type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	offset, err := strconv.ParseInt(req.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		httputil.Error(w, "invalid Upload-Offset", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := api.upload(req); err != nil {
+		httputil.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	upload, err := api.uploads.Write(chi.URLParam(req, "id"), offset, req.Body)
+	switch err {
+	case nil:
+	case ErrUploadNotFound:
+		httputil.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	case ErrUploadOffset, ErrUploadLocked:
+		httputil.Error(w, err.Error(), http.StatusConflict)
+		return
+	default:
+		httputil.Error(w, fmt.Sprint("failed to write upload:", err), http.StatusBadRequest)
+		return
+	}
+
+	if upload.IsComplete() && !api.completeUpload(w, req, upload) {
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (api *filesAPI) terminateUpload(w http.ResponseWriter, req *http.Request) {
+	if _, err := api.upload(req); err != nil {
+		httputil.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	switch err := api.uploads.Remove(chi.URLParam(req, "id")); err {
+	case nil:
+	case ErrUploadNotFound:
+		httputil.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	case ErrUploadLocked:
+		httputil.Error(w, err.Error(), http.StatusConflict)
+		return
+	default:
+		httputil.Error(w, fmt.Sprint("failed to remove upload:", err), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// upload returns upload from the request url, uploads of other users
+// or sources are not found.
+func (api *filesAPI) upload(req *http.Request) (*Upload, error) {
+	upload, err := api.uploads.Get(chi.URLParam(req, "id"))
+	if err != nil {
+		return nil, err
+	}
+
+	username, _ := req.Context().Value(contextkey.UsernameCtxKey).(string)
+	if upload.Owner != username || upload.Source != api.sourceName(req) {
+		return nil, ErrUploadNotFound
+	}
+
+	return upload, nil
+}
+
+// completeUpload moves staged data of the upload into a source of the
+// request and writes error response on failures. Existing items are
+// not replaced by uploads.
+func (api *filesAPI) completeUpload(w http.ResponseWriter, req *http.Request, upload *Upload) bool {
+	err := api.uploads.Complete(upload.ID, func(dataPath string) error {
+		_, err := api.source(req).Import(dataPath, upload.Path)
+		return err
+	})
+
+	switch err {
+	case nil:
+		return true
+	case ErrConflict:
+		httputil.Error(w, err.Error(), http.StatusConflict)
+	default:
+		httputil.Error(w, fmt.Sprint("failed to save upload:", err), http.StatusBadRequest)
+	}
+
+	return false
+}
+
+// parseUploadMetadata decodes comma separated key value pairs with
+// base64 encoded values.
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	if header == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		kv := strings.SplitN(strings.TrimSpace(pair), " ", 2)
+		if kv[0] == "" {
+			return nil, fmt.Errorf("empty key")
+		}
+
+		if len(kv) == 1 {
+			metadata[kv[0]] = ""
+			continue
+		}
+
+		value, err := base64.StdEncoding.DecodeString(kv[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", kv[0], err)
+		}
+
+		metadata[kv[0]] = string(value)
+	}
+
+	return metadata, nil
+}
@@ -0,0 +1,229 @@
+package files
+
+import (
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ap4y/cloud/acl"
+	"github.com/ap4y/cloud/contextkey"
+	"github.com/ap4y/cloud/module"
+	"github.com/ap4y/cloud/share"
+)
+
+func TestTusUploads(t *testing.T) {
+	pwd, err := os.Getwd()
+	require.NoError(t, err)
+
+	src, err := NewDiskSource(filepath.Join(pwd, "fixtures"), "")
+	require.NoError(t, err)
+
+	dir, err := ioutil.TempDir("", "uploads")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	uploads, err := NewDiskUploadStore(dir)
+	require.NoError(t, err)
+
+	api := NewFilesAPI(src, uploads)
+
+	tusRequest := func(method, url string, body string, headers map[string]string) *http.Response {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "http://cloud.api"+url, strings.NewReader(body))
+		req.Header.Set("Tus-Resumable", tusVersion)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		api.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	metadata := "filename " + base64.StdEncoding.EncodeToString([]byte("upload")) +
+		",path " + base64.StdEncoding.EncodeToString([]byte("/test1"))
+
+	t.Run("options", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("OPTIONS", "http://cloud.api/uploads", nil)
+		api.ServeHTTP(w, req)
+
+		resp := w.Result()
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+		assert.Equal(t, tusVersion, resp.Header.Get("Tus-Version"))
+		assert.Equal(t, tusExtensions, resp.Header.Get("Tus-Extension"))
+	})
+
+	t.Run("unsupported version", func(t *testing.T) {
+		resp := tusRequest("POST", "/uploads", "", map[string]string{"Tus-Resumable": "0.2.0", "Upload-Length": "6"})
+		require.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+		assert.Equal(t, tusVersion, resp.Header.Get("Tus-Version"))
+	})
+
+	t.Run("create/invalid", func(t *testing.T) {
+		resp := tusRequest("POST", "/uploads", "", map[string]string{"Upload-Metadata": metadata})
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+		resp = tusRequest("POST", "/uploads", "", map[string]string{"Upload-Length": "6"})
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("create/patch", func(t *testing.T) {
+		defer os.Remove("./fixtures/test1/upload")
+
+		resp := tusRequest("POST", "/uploads", "", map[string]string{"Upload-Length": "6", "Upload-Metadata": metadata})
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+		location := resp.Header.Get("Location")
+		require.True(t, strings.HasPrefix(location, "/uploads/"))
+		url := strings.TrimPrefix(location, "http://cloud.api")
+
+		resp = tusRequest("HEAD", url, "", nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "0", resp.Header.Get("Upload-Offset"))
+		assert.Equal(t, "6", resp.Header.Get("Upload-Length"))
+		assert.Equal(t, "no-store", resp.Header.Get("Cache-Control"))
+
+		patchHeaders := map[string]string{"Content-Type": tusContentType, "Upload-Offset": "0"}
+		resp = tusRequest("PATCH", url, "foo", patchHeaders)
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+		assert.Equal(t, "3", resp.Header.Get("Upload-Offset"))
+
+		resp = tusRequest("PATCH", url, "foo", patchHeaders)
+		require.Equal(t, http.StatusConflict, resp.StatusCode)
+
+		resp = tusRequest("PATCH", url, "bar", map[string]string{"Upload-Offset": "3"})
+		require.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+
+		_, err := os.Stat("./fixtures/test1/upload")
+		require.True(t, os.IsNotExist(err))
+
+		resp = tusRequest("PATCH", url, "bar", map[string]string{"Content-Type": tusContentType, "Upload-Offset": "3"})
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+		assert.Equal(t, "6", resp.Header.Get("Upload-Offset"))
+
+		data, err := ioutil.ReadFile("./fixtures/test1/upload")
+		require.NoError(t, err)
+		assert.Equal(t, "foobar", string(data))
+
+		resp = tusRequest("HEAD", url, "", nil)
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("terminate", func(t *testing.T) {
+		resp := tusRequest("POST", "/uploads", "", map[string]string{"Upload-Length": "6", "Upload-Metadata": metadata})
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+		url := resp.Header.Get("Location")
+
+		resp = tusRequest("DELETE", url, "", nil)
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+		resp = tusRequest("HEAD", url, "", nil)
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+		resp = tusRequest("DELETE", url, "", nil)
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("other user", func(t *testing.T) {
+		userRequest := func(username, method, url string, headers map[string]string) *http.Response {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(method, "http://cloud.api"+url, strings.NewReader("foobar"))
+			req.Header.Set("Tus-Resumable", tusVersion)
+			for k, v := range headers {
+				req.Header.Set(k, v)
+			}
+			ctx := context.WithValue(req.Context(), contextkey.UsernameCtxKey, username)
+			api.ServeHTTP(w, req.WithContext(ctx))
+			return w.Result()
+		}
+
+		resp := userRequest("foo", "POST", "/uploads", map[string]string{"Upload-Length": "6", "Upload-Metadata": metadata})
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+		url := resp.Header.Get("Location")
+		defer userRequest("foo", "DELETE", url, nil)
+
+		resp = userRequest("bar", "HEAD", url, nil)
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+		resp = userRequest("bar", "PATCH", url, map[string]string{"Content-Type": tusContentType, "Upload-Offset": "0"})
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+		resp = userRequest("bar", "DELETE", url, nil)
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+		resp = userRequest("foo", "HEAD", url, nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "0", resp.Header.Get("Upload-Offset"))
+	})
+
+	t.Run("existing file", func(t *testing.T) {
+		existing := "filename " + base64.StdEncoding.EncodeToString([]byte("bar")) +
+			",path " + base64.StdEncoding.EncodeToString([]byte("/test1"))
+		resp := tusRequest("POST", "/uploads", "", map[string]string{"Upload-Length": "3", "Upload-Metadata": existing})
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+		url := resp.Header.Get("Location")
+
+		resp = tusRequest("PATCH", url, "foo", map[string]string{"Content-Type": tusContentType, "Upload-Offset": "0"})
+		require.Equal(t, http.StatusConflict, resp.StatusCode)
+
+		data, err := ioutil.ReadFile("./fixtures/test1/bar")
+		require.NoError(t, err)
+		assert.NotEqual(t, "foo", string(data))
+
+		resp = tusRequest("DELETE", url, "", nil)
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	})
+
+	t.Run("create/with rules", func(t *testing.T) {
+		editor := &acl.User{Role: acl.RoleEditor, Rules: []acl.Rule{{Module: module.Files, Path: "/test1"}}}
+		for path, code := range map[string]int{
+			"/test1":          http.StatusCreated,
+			"/test2/../test1": http.StatusForbidden,
+		} {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "http://cloud.api/uploads", nil)
+			req.Header.Set("Tus-Resumable", tusVersion)
+			req.Header.Set("Upload-Length", "6")
+			req.Header.Set("Upload-Metadata", "filename "+base64.StdEncoding.EncodeToString([]byte("upload"))+
+				",path "+base64.StdEncoding.EncodeToString([]byte(path)))
+			ctx := context.WithValue(req.Context(), contextkey.UserCtxKey, editor)
+			api.ServeHTTP(w, req.WithContext(ctx))
+
+			resp := w.Result()
+			require.Equal(t, code, resp.StatusCode, path)
+			if code == http.StatusCreated {
+				tusRequest("DELETE", resp.Header.Get("Location"), "", nil)
+			}
+		}
+	})
+
+	t.Run("with share", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "http://cloud.api/uploads", nil)
+		req.Header.Set("Tus-Resumable", tusVersion)
+		req.Header.Set("Upload-Length", "6")
+		req.Header.Set("Upload-Metadata", metadata)
+		s := &share.Share{Type: module.Files, Name: "/test1", Items: []string{"/test1/inner"}}
+		ctx := context.WithValue(req.Context(), contextkey.ShareCtxKey, s)
+		api.ServeHTTP(w, req.WithContext(ctx))
+
+		resp := w.Result()
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestParseUploadMetadata(t *testing.T) {
+	metadata, err := parseUploadMetadata("filename Zm9v,is_confidential,path L2Jhcg==")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"filename": "foo", "is_confidential": "", "path": "/bar"}, metadata)
+
+	_, err = parseUploadMetadata("filename !!!")
+	require.Error(t, err)
+}
@@ -0,0 +1,293 @@
+package files
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrUploadNotFound returned for unknown upload ids.
+	ErrUploadNotFound = errors.New("upload not found")
+	// ErrUploadLocked returned when upload is being written by another request.
+	ErrUploadLocked = errors.New("upload is locked")
+	// ErrUploadOffset returned when write offset doesn't match stored upload offset.
+	ErrUploadOffset = errors.New("offset mismatch")
+)
+
+// Upload stores resumable upload metadata. Owner and Source identify
+// user that created an upload and source it's saved into.
+type Upload struct {
+	ID        string            `json:"id"`
+	Owner     string            `json:"owner"`
+	Source    string            `json:"source"`
+	Length    int64             `json:"length"`
+	Offset    int64             `json:"offset"`
+	Path      string            `json:"path"`
+	Metadata  map[string]string `json:"metadata"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// IsComplete returns true if all upload data was received.
+func (u Upload) IsComplete() bool {
+	return u.Offset == u.Length
+}
+
+// UploadStore manages partially received uploads in a staging area.
+type UploadStore interface {
+	// Create starts a new upload of a given length for a destination
+	// path of a source by an owner.
+	Create(owner, source string, length int64, path string, metadata map[string]string) (*Upload, error)
+	// Get returns upload metadata.
+	Get(id string) (*Upload, error)
+	// Write appends data from a reader at offset and returns updated upload.
+	Write(id string, offset int64, r io.Reader) (*Upload, error)
+	// Complete passes disk path of the staged data of a complete
+	// upload to save and removes the upload. save is expected to move
+	// staged data.
+	Complete(id string, save func(dataPath string) error) error
+	// Remove removes upload metadata and staged data.
+	Remove(id string) error
+	// Expire removes uploads that were not written to longer than
+	// retention ago.
+	Expire(retention time.Duration) error
+}
+
+// DefaultUploadRetention defines how long abandoned uploads are kept
+// when retention is not configured.
+const DefaultUploadRetention = 24 * time.Hour
+
+type diskUploadStore struct {
+	dir string
+
+	mu     sync.Mutex
+	active map[string]bool
+}
+
+// NewDiskUploadStore returns a new UploadStore that stages uploads
+// in a provided dir. dir will be created if necessary.
+func NewDiskUploadStore(dir string) (UploadStore, error) {
+	if dir == "" {
+		return nil, errors.New("dir can't be empty")
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create uploads dir: %s", err)
+	}
+
+	return &diskUploadStore{dir: dir, active: map[string]bool{}}, nil
+}
+
+func (us *diskUploadStore) Create(owner, source string, length int64, path string, metadata map[string]string) (*Upload, error) {
+	if length < 0 {
+		return nil, errors.New("invalid length")
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate id: %s", err)
+	}
+
+	upload := &Upload{
+		ID:        hex.EncodeToString(id),
+		Owner:     owner,
+		Source:    source,
+		Length:    length,
+		Path:      path,
+		Metadata:  metadata,
+		CreatedAt: time.Now(),
+	}
+
+	data, err := os.OpenFile(us.dataPath(upload.ID), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("file: %s", err)
+	}
+	data.Close()
+
+	info, err := os.OpenFile(us.infoPath(upload.ID), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("file: %s", err)
+	}
+	defer info.Close()
+
+	if err := json.NewEncoder(info).Encode(upload); err != nil {
+		return nil, fmt.Errorf("json: %s", err)
+	}
+
+	return upload, nil
+}
+
+func (us *diskUploadStore) Get(id string) (*Upload, error) {
+	if !isUploadID(id) {
+		return nil, ErrUploadNotFound
+	}
+
+	info, err := os.Open(us.infoPath(id))
+	if os.IsNotExist(err) {
+		return nil, ErrUploadNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("file: %s", err)
+	}
+	defer info.Close()
+
+	upload := &Upload{}
+	if err := json.NewDecoder(info).Decode(upload); err != nil {
+		return nil, fmt.Errorf("json: %s", err)
+	}
+
+	fi, err := os.Stat(us.dataPath(id))
+	if err != nil {
+		return nil, fmt.Errorf("stat: %s", err)
+	}
+	upload.Offset = fi.Size()
+
+	return upload, nil
+}
+
+func (us *diskUploadStore) Write(id string, offset int64, r io.Reader) (*Upload, error) {
+	if err := us.lock(id); err != nil {
+		return nil, err
+	}
+	defer us.unlock(id)
+
+	upload, err := us.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if upload.Offset != offset {
+		return upload, ErrUploadOffset
+	}
+
+	data, err := os.OpenFile(us.dataPath(id), os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("file: %s", err)
+	}
+	defer data.Close()
+
+	n, err := io.Copy(data, io.LimitReader(r, upload.Length-upload.Offset))
+	upload.Offset += n
+	if err != nil {
+		return upload, fmt.Errorf("copy: %s", err)
+	}
+
+	return upload, nil
+}
+
+func (us *diskUploadStore) Complete(id string, save func(dataPath string) error) error {
+	if err := us.lock(id); err != nil {
+		return err
+	}
+	defer us.unlock(id)
+
+	upload, err := us.Get(id)
+	if err != nil {
+		return err
+	}
+
+	if !upload.IsComplete() {
+		return errors.New("upload is not complete")
+	}
+
+	if err := save(us.dataPath(id)); err != nil {
+		return err
+	}
+
+	return us.remove(id)
+}
+
+func (us *diskUploadStore) Remove(id string) error {
+	if err := us.lock(id); err != nil {
+		return err
+	}
+	defer us.unlock(id)
+
+	if _, err := us.Get(id); err != nil {
+		return err
+	}
+
+	return us.remove(id)
+}
+
+func (us *diskUploadStore) Expire(retention time.Duration) error {
+	infos, err := filepath.Glob(filepath.Join(us.dir, "*.info"))
+	if err != nil {
+		return fmt.Errorf("glob: %s", err)
+	}
+
+	for _, info := range infos {
+		id := strings.TrimSuffix(filepath.Base(info), ".info")
+		if !isUploadID(id) || us.lock(id) != nil {
+			continue
+		}
+
+		fi, err := os.Stat(us.dataPath(id))
+		if os.IsNotExist(err) || (err == nil && time.Since(fi.ModTime()) > retention) {
+			err = us.remove(id)
+		}
+		us.unlock(id)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// remove removes upload files, missing staged data is ignored. Caller
+// has to hold the upload lock.
+func (us *diskUploadStore) remove(id string) error {
+	if err := os.Remove(us.infoPath(id)); err != nil {
+		return fmt.Errorf("remove: %s", err)
+	}
+
+	if err := os.Remove(us.dataPath(id)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove: %s", err)
+	}
+
+	return nil
+}
+
+func (us *diskUploadStore) lock(id string) error {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	if us.active[id] {
+		return ErrUploadLocked
+	}
+
+	us.active[id] = true
+	return nil
+}
+
+func (us *diskUploadStore) unlock(id string) {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	delete(us.active, id)
+}
+
+func (us *diskUploadStore) infoPath(id string) string {
+	return filepath.Join(us.dir, id+".info")
+}
+
+func (us *diskUploadStore) dataPath(id string) string {
+	return filepath.Join(us.dir, id+".bin")
+}
+
+func isUploadID(id string) bool {
+	if _, err := hex.DecodeString(id); err != nil || id == "" {
+		return false
+	}
+
+	return true
+}
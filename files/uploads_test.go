@@ -0,0 +1,105 @@
+package files
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskUploadStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "uploads")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store, err := NewDiskUploadStore(dir)
+	require.NoError(t, err)
+
+	upload, err := store.Create("test", "", 6, "/test1/foo", map[string]string{"filename": "foo"})
+	require.NoError(t, err)
+	assert.NotEmpty(t, upload.ID)
+	assert.Equal(t, int64(0), upload.Offset)
+	assert.False(t, upload.IsComplete())
+	assert.Equal(t, "test", upload.Owner)
+
+	t.Run("Get", func(t *testing.T) {
+		res, err := store.Get(upload.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(6), res.Length)
+		assert.Equal(t, "/test1/foo", res.Path)
+		assert.Equal(t, "foo", res.Metadata["filename"])
+
+		_, err = store.Get("foo")
+		assert.Equal(t, ErrUploadNotFound, err)
+
+		_, err = store.Get("../" + upload.ID)
+		assert.Equal(t, ErrUploadNotFound, err)
+	})
+
+	t.Run("Write", func(t *testing.T) {
+		res, err := store.Write(upload.ID, 0, strings.NewReader("foo"))
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), res.Offset)
+
+		_, err = store.Write(upload.ID, 0, strings.NewReader("foo"))
+		assert.Equal(t, ErrUploadOffset, err)
+
+		res, err = store.Write(upload.ID, 3, strings.NewReader("barbaz"))
+		require.NoError(t, err)
+		assert.Equal(t, int64(6), res.Offset)
+		assert.True(t, res.IsComplete())
+
+	})
+
+	t.Run("Complete", func(t *testing.T) {
+		pending, err := store.Create("test", "", 6, "/test1/bar", nil)
+		require.NoError(t, err)
+		assert.Error(t, store.Complete(pending.ID, func(string) error { return nil }))
+		require.NoError(t, store.Remove(pending.ID))
+
+		complete, err := store.Create("test", "", 3, "/test1/bar", nil)
+		require.NoError(t, err)
+		_, err = store.Write(complete.ID, 0, strings.NewReader("bar"))
+		require.NoError(t, err)
+
+		dst := filepath.Join(dir, "bar")
+		err = store.Complete(complete.ID, func(dataPath string) error {
+			return os.Rename(dataPath, dst)
+		})
+		require.NoError(t, err)
+
+		data, err := ioutil.ReadFile(dst)
+		require.NoError(t, err)
+		assert.Equal(t, "bar", string(data))
+
+		_, err = store.Get(complete.ID)
+		assert.Equal(t, ErrUploadNotFound, err)
+	})
+
+	t.Run("Expire", func(t *testing.T) {
+		stale, err := store.Create("test", "", 3, "/test1/bar", nil)
+		require.NoError(t, err)
+		past := time.Now().Add(-2 * time.Hour)
+		require.NoError(t, os.Chtimes(filepath.Join(dir, stale.ID+".bin"), past, past))
+
+		require.NoError(t, store.Expire(time.Hour))
+
+		_, err = store.Get(stale.ID)
+		assert.Equal(t, ErrUploadNotFound, err)
+		_, err = store.Get(upload.ID)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		require.NoError(t, store.Remove(upload.ID))
+
+		_, err := store.Get(upload.ID)
+		assert.Equal(t, ErrUploadNotFound, err)
+		assert.Equal(t, ErrUploadNotFound, store.Remove(upload.ID))
+	})
+}
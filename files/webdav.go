@@ -0,0 +1,304 @@
+package files
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+// WebDAV protocol and locks are handled by golang.org/x/net/webdav,
+// davFS implements it's FileSystem over a Source.
+
+// NewWebDAV returns a new http.Handler that implements WebDAV
+// protocol for a Source. prefix defines path handler is mounted on.
+func NewWebDAV(source Source, prefix string) http.Handler {
+	prefix = strings.TrimSuffix(prefix, "/")
+	handler := &webdav.Handler{
+		Prefix:     prefix,
+		FileSystem: &davFS{source},
+		LockSystem: webdav.NewMemLS(),
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if isRecursiveTransfer(req, prefix) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		if req.Method == http.MethodPut {
+			// Body is reduced to a plain reader, so copy of the
+			// webdav.Handler goes through davWriter.ReadFrom and
+			// sees read errors of interrupted uploads.
+			req.Body = struct{ io.ReadCloser }{req.Body}
+		}
+
+		handler.ServeHTTP(w, req)
+	})
+}
+
+// isRecursiveTransfer returns true for COPY and MOVE requests with a
+// destination inside of the source collection, webdav.Handler
+// doesn't reject them.
+func isRecursiveTransfer(req *http.Request, prefix string) bool {
+	if req.Method != "COPY" && req.Method != "MOVE" {
+		return false
+	}
+
+	u, err := url.Parse(req.Header.Get("Destination"))
+	if err != nil {
+		return false
+	}
+
+	src := davPath(strings.TrimPrefix(req.URL.Path, prefix))
+	dst := davPath(strings.TrimPrefix(u.Path, prefix))
+	return src != dst && strings.HasPrefix(dst, strings.TrimSuffix(src, "/")+"/")
+}
+
+type davFS struct {
+	source Source
+}
+
+func (fs *davFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	name = davPath(name)
+	if _, err := fs.Stat(ctx, path.Dir(name)); err != nil {
+		return err
+	}
+
+	_, err := fs.source.Mkdir(name)
+	return err
+}
+
+// OpenFile opens files for reading, files opened for writing are
+// always truncated and replaced once closed.
+func (fs *davFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	name = davPath(name)
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC) == 0 {
+		if _, err := fs.Stat(ctx, name); err != nil {
+			return nil, err
+		}
+
+		file, err := fs.source.File(name)
+		if err != nil {
+			return nil, err
+		}
+
+		return &davFile{File: file, source: fs.source, name: name}, nil
+	}
+
+	if name == "/" {
+		return nil, os.ErrInvalid
+	}
+
+	if fi, err := fs.Stat(ctx, path.Dir(name)); err != nil || !fi.IsDir() {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+
+	return newDAVWriter(fs.source, name), nil
+}
+
+func (fs *davFS) RemoveAll(ctx context.Context, name string) error {
+	name = davPath(name)
+	if name == "/" {
+		return os.ErrInvalid
+	}
+
+	fi, err := fs.Stat(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	if fi.IsDir() {
+		_, err = fs.source.Rmdir(name)
+	} else {
+		_, err = fs.source.Remove(name)
+	}
+
+	return err
+}
+
+func (fs *davFS) Rename(ctx context.Context, oldName, newName string) error {
+	_, err := fs.source.Move(davPath(oldName), davPath(newName))
+	return err
+}
+
+// Stat reports all source errors as missing files, webdav.Handler
+// relies on os.IsNotExist to detect them.
+func (fs *davFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	name = davPath(name)
+	item, err := fs.source.Stat(name, false)
+	if err != nil {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+
+	return davFileInfo{item}, nil
+}
+
+// davFile is a read only source file, directory entries are listed
+// using a Source to include mounted folders.
+type davFile struct {
+	*os.File
+	source   Source
+	name     string
+	children []os.FileInfo
+}
+
+func (f *davFile) Readdir(count int) ([]os.FileInfo, error) {
+	if f.children == nil {
+		children, err := f.list()
+		if err != nil {
+			return nil, err
+		}
+		f.children = children
+	}
+
+	if count <= 0 {
+		children := f.children
+		f.children = []os.FileInfo{}
+		return children, nil
+	}
+
+	if len(f.children) == 0 {
+		return nil, io.EOF
+	}
+
+	if count > len(f.children) {
+		count = len(f.children)
+	}
+
+	children := f.children[:count]
+	f.children = f.children[count:]
+	return children, nil
+}
+
+func (f *davFile) list() ([]os.FileInfo, error) {
+	items, err := listAll(f.source, f.name)
+	if err != nil {
+		return nil, err
+	}
+
+	children := make([]os.FileInfo, len(items))
+	for i, item := range items {
+		children[i] = davFileInfo{item}
+	}
+
+	return children, nil
+}
+
+// davWriter streams written data into a Source, file is replaced
+// when writer is closed. Failed writes discard the data instead.
+type davWriter struct {
+	name string
+	pw   *io.PipeWriter
+	size int64
+	err  error
+	done chan error
+}
+
+func newDAVWriter(source Source, name string) *davWriter {
+	pr, pw := io.Pipe()
+	w := &davWriter{name: name, pw: pw, done: make(chan error, 1)}
+	go func() {
+		_, err := source.Save(pr, name)
+		pr.CloseWithError(err) // nolint: errcheck
+		w.done <- err
+	}()
+
+	return w
+}
+
+func (w *davWriter) Write(p []byte) (int, error) {
+	n, err := w.pw.Write(p)
+	w.size += int64(n)
+	if err != nil {
+		w.err = err
+	}
+
+	return n, err
+}
+
+// ReadFrom copies data from r, read errors are tracked to discard
+// partially received data on close.
+func (w *davWriter) ReadFrom(r io.Reader) (int64, error) {
+	n, err := io.Copy(w.pw, r)
+	w.size += n
+	if err != nil {
+		w.err = err
+	}
+
+	return n, err
+}
+
+func (w *davWriter) Close() error {
+	if w.err != nil {
+		w.pw.CloseWithError(w.err) // nolint: errcheck
+	} else {
+		w.pw.Close() // nolint: errcheck
+	}
+
+	return <-w.done
+}
+
+func (w *davWriter) Read(p []byte) (int, error) {
+	return 0, os.ErrInvalid
+}
+
+func (w *davWriter) Seek(offset int64, whence int) (int64, error) {
+	return 0, os.ErrInvalid
+}
+
+func (w *davWriter) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, os.ErrInvalid
+}
+
+func (w *davWriter) Stat() (os.FileInfo, error) {
+	return davFileInfo{&Item{
+		Type:    ItemTypeFile,
+		Name:    path.Base(w.name),
+		Path:    w.name,
+		ModTime: time.Now(),
+		Size:    w.size,
+	}}, nil
+}
+
+// davFileInfo implements os.FileInfo for source items.
+type davFileInfo struct {
+	item *Item
+}
+
+func (fi davFileInfo) Name() string       { return fi.item.Name }
+func (fi davFileInfo) Size() int64        { return fi.item.Size }
+func (fi davFileInfo) ModTime() time.Time { return fi.item.ModTime }
+func (fi davFileInfo) IsDir() bool        { return fi.item.Type == ItemTypeDirectory }
+func (fi davFileInfo) Sys() interface{}   { return nil }
+
+func (fi davFileInfo) Mode() os.FileMode {
+	perm, _ := strconv.ParseUint(fi.item.Mode, 8, 32)
+	mode := os.FileMode(perm)
+	if fi.IsDir() {
+		mode |= os.ModeDir
+	}
+
+	return mode
+}
+
+// ContentType implements webdav.ContentTyper, content is sniffed by
+// webdav.Handler for unknown types.
+func (fi davFileInfo) ContentType(ctx context.Context) (string, error) {
+	if fi.item.MimeType == "" {
+		return "", webdav.ErrNotImplemented
+	}
+
+	return fi.item.MimeType, nil
+}
+
+func davPath(name string) string {
+	return path.Clean("/" + name)
+}
@@ -0,0 +1,242 @@
+package files
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebDAV(t *testing.T) {
+	dir, err := ioutil.TempDir("", "webdav")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "test1", "inner"), 0700))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "foo"), []byte("foo\n"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "test1", "inner", "bar"), []byte("bar\n"), 0600))
+
+	src, err := NewDiskSource(dir, "")
+	require.NoError(t, err)
+
+	dav := NewWebDAV(src, "/dav")
+
+	davRequest := func(method, url, body string, headers map[string]string) (*http.Response, string) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "http://cloud.api"+url, strings.NewReader(body))
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		dav.ServeHTTP(w, req)
+
+		resp := w.Result()
+		data, _ := ioutil.ReadAll(resp.Body)
+		return resp, string(data)
+	}
+
+	t.Run("OPTIONS", func(t *testing.T) {
+		resp, _ := davRequest("OPTIONS", "/dav/", "", nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "1, 2", resp.Header.Get("DAV"))
+		assert.Contains(t, resp.Header.Get("Allow"), "PROPFIND")
+	})
+
+	t.Run("PROPFIND", func(t *testing.T) {
+		resp, body := davRequest("PROPFIND", "/dav/", "", map[string]string{"Depth": "1"})
+		require.Equal(t, http.StatusMultiStatus, resp.StatusCode)
+		assert.Contains(t, body, "<D:href>/dav/</D:href>")
+		assert.Contains(t, body, "<D:href>/dav/foo</D:href>")
+		assert.Contains(t, body, "<D:href>/dav/test1/</D:href>")
+		assert.Contains(t, body, "<D:resourcetype><D:collection xmlns:D=\"DAV:\"/></D:resourcetype>")
+		assert.Contains(t, body, "<D:getcontentlength>4</D:getcontentlength>")
+		assert.NotContains(t, body, "/dav/test1/inner")
+	})
+
+	t.Run("PROPFIND/depth 0", func(t *testing.T) {
+		resp, body := davRequest("PROPFIND", "/dav/test1", "", map[string]string{"Depth": "0"})
+		require.Equal(t, http.StatusMultiStatus, resp.StatusCode)
+		assert.Contains(t, body, "<D:href>/dav/test1/</D:href>")
+		assert.NotContains(t, body, "/dav/test1/inner")
+	})
+
+	t.Run("PROPFIND/depth infinity", func(t *testing.T) {
+		resp, body := davRequest("PROPFIND", "/dav/", "", map[string]string{"Depth": "infinity"})
+		require.Equal(t, http.StatusMultiStatus, resp.StatusCode)
+		assert.Contains(t, body, "<D:href>/dav/test1/inner/bar</D:href>")
+	})
+
+	t.Run("PROPFIND/prop", func(t *testing.T) {
+		body := `<?xml version="1.0"?><D:propfind xmlns:D="DAV:"><D:prop><D:getcontentlength/><X:foo xmlns:X="urn:x"/></D:prop></D:propfind>`
+		resp, res := davRequest("PROPFIND", "/dav/foo", body, map[string]string{"Depth": "0"})
+		require.Equal(t, http.StatusMultiStatus, resp.StatusCode)
+		assert.Contains(t, res, "<D:prop><D:getcontentlength>4</D:getcontentlength></D:prop><D:status>HTTP/1.1 200 OK</D:status>")
+		assert.Contains(t, res, "<D:prop><foo xmlns=\"urn:x\"></foo></D:prop><D:status>HTTP/1.1 404 Not Found</D:status>")
+		assert.NotContains(t, res, "displayname")
+	})
+
+	t.Run("PROPFIND/missing", func(t *testing.T) {
+		resp, _ := davRequest("PROPFIND", "/dav/missing", "", map[string]string{"Depth": "0"})
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("GET", func(t *testing.T) {
+		resp, body := davRequest("GET", "/dav/test1/inner/bar", "", nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "bar\n", body)
+		assert.NotEmpty(t, resp.Header.Get("ETag"))
+
+		resp, _ = davRequest("GET", "/dav/test1", "", nil)
+		require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	})
+
+	t.Run("PUT", func(t *testing.T) {
+		resp, _ := davRequest("PUT", "/dav/test1/baz", "baz", nil)
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		resp, _ = davRequest("PUT", "/dav/test1/baz", "qux", nil)
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, "test1", "baz"))
+		require.NoError(t, err)
+		assert.Equal(t, "qux", string(data))
+
+		resp, _ = davRequest("PUT", "/dav/missing/baz", "baz", nil)
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("PUT/interrupted", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		body := io.MultiReader(strings.NewReader("part"), iotest.TimeoutReader(strings.NewReader("rest")))
+		req := httptest.NewRequest("PUT", "http://cloud.api/dav/test1/baz", body)
+		dav.ServeHTTP(w, req)
+		require.Equal(t, http.StatusMethodNotAllowed, w.Result().StatusCode)
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, "test1", "baz"))
+		require.NoError(t, err)
+		assert.Equal(t, "qux", string(data))
+
+		files, err := ioutil.ReadDir(filepath.Join(dir, "test1"))
+		require.NoError(t, err)
+		for _, fi := range files {
+			assert.False(t, strings.HasPrefix(fi.Name(), "."), fi.Name())
+		}
+	})
+
+	t.Run("MKCOL", func(t *testing.T) {
+		resp, _ := davRequest("MKCOL", "/dav/test2", "", nil)
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		resp, _ = davRequest("MKCOL", "/dav/test2", "", nil)
+		require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+
+		resp, _ = davRequest("MKCOL", "/dav/missing/test2", "", nil)
+		require.Equal(t, http.StatusConflict, resp.StatusCode)
+	})
+
+	t.Run("COPY", func(t *testing.T) {
+		resp, _ := davRequest("COPY", "/dav/test1", "", map[string]string{"Destination": "http://cloud.api/dav/test2/copy"})
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, "test2", "copy", "inner", "bar"))
+		require.NoError(t, err)
+		assert.Equal(t, "bar\n", string(data))
+
+		resp, _ = davRequest("COPY", "/dav/foo", "", map[string]string{"Destination": "/dav/test2/copy", "Overwrite": "F"})
+		require.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+
+		resp, _ = davRequest("COPY", "/dav/foo", "", map[string]string{"Destination": "/dav/test2/copy"})
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+		data, err = ioutil.ReadFile(filepath.Join(dir, "test2", "copy"))
+		require.NoError(t, err)
+		assert.Equal(t, "foo\n", string(data))
+
+		resp, _ = davRequest("COPY", "/dav/test1", "", map[string]string{"Destination": "/dav/test1/inner"})
+		require.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("MOVE", func(t *testing.T) {
+		resp, _ := davRequest("MOVE", "/dav/test2/copy", "", map[string]string{"Destination": "/dav/test2/moved"})
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		_, err := os.Stat(filepath.Join(dir, "test2", "copy"))
+		assert.True(t, os.IsNotExist(err))
+		data, err := ioutil.ReadFile(filepath.Join(dir, "test2", "moved"))
+		require.NoError(t, err)
+		assert.Equal(t, "foo\n", string(data))
+
+		resp, _ = davRequest("MOVE", "/dav/missing", "", map[string]string{"Destination": "/dav/test2/missing"})
+		require.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("DELETE", func(t *testing.T) {
+		resp, _ := davRequest("DELETE", "/dav/test2", "", nil)
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+		_, err := os.Stat(filepath.Join(dir, "test2"))
+		assert.True(t, os.IsNotExist(err))
+
+		resp, _ = davRequest("DELETE", "/dav/test2", "", nil)
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+		resp, _ = davRequest("DELETE", "/dav/", "", nil)
+		require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	})
+
+	t.Run("LOCK/UNLOCK", func(t *testing.T) {
+		lockBody := `<?xml version="1.0"?><D:lockinfo xmlns:D="DAV:"><D:lockscope><D:exclusive/></D:lockscope><D:locktype><D:write/></D:locktype><D:owner><D:href>test</D:href></D:owner></D:lockinfo>`
+		resp, body := davRequest("LOCK", "/dav/test1", lockBody, map[string]string{"Timeout": "Second-60"})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Contains(t, body, "<D:owner><D:href>test</D:href></D:owner>")
+		assert.Contains(t, body, "<D:timeout>Second-60</D:timeout>")
+		token := resp.Header.Get("Lock-Token")
+		require.NotEmpty(t, token)
+
+		resp, _ = davRequest("LOCK", "/dav/test1/inner", lockBody, nil)
+		require.Equal(t, http.StatusLocked, resp.StatusCode)
+
+		resp, _ = davRequest("PUT", "/dav/test1/inner/bar", "baz", nil)
+		require.Equal(t, http.StatusLocked, resp.StatusCode)
+
+		resp, _ = davRequest("DELETE", "/dav/test1", "", nil)
+		require.Equal(t, http.StatusLocked, resp.StatusCode)
+
+		resp, _ = davRequest("PUT", "/dav/test1/inner/bar", "baz", map[string]string{"If": "(" + token + ")"})
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		resp, body = davRequest("LOCK", "/dav/test1", "", map[string]string{"If": "(" + token + ")", "Timeout": "Second-120"})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Contains(t, body, "<D:timeout>Second-120</D:timeout>")
+
+		resp, _ = davRequest("UNLOCK", "/dav/test1", "", map[string]string{"Lock-Token": "<opaquelocktoken:foo>"})
+		require.Equal(t, http.StatusConflict, resp.StatusCode)
+
+		resp, _ = davRequest("UNLOCK", "/dav/test1", "", map[string]string{"Lock-Token": token})
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+		resp, _ = davRequest("PUT", "/dav/test1/inner/bar", "baz", nil)
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+	})
+
+	t.Run("LOCK/unmapped", func(t *testing.T) {
+		lockBody := `<?xml version="1.0"?><D:lockinfo xmlns:D="DAV:"><D:lockscope><D:exclusive/></D:lockscope><D:locktype><D:write/></D:locktype></D:lockinfo>`
+		resp, _ := davRequest("LOCK", "/dav/test1/new", lockBody, map[string]string{"Depth": "0"})
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		fi, err := os.Stat(filepath.Join(dir, "test1", "new"))
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), fi.Size())
+
+		sharedBody := `<?xml version="1.0"?><D:lockinfo xmlns:D="DAV:"><D:lockscope><D:shared/></D:lockscope><D:locktype><D:write/></D:locktype></D:lockinfo>`
+		resp, _ = davRequest("LOCK", "/dav/foo", sharedBody, nil)
+		require.Equal(t, http.StatusNotImplemented, resp.StatusCode)
+	})
+}
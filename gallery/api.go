@@ -2,12 +2,17 @@ package gallery
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"net/http"
-	"time"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi"
 
+	"github.com/ap4y/cloud/acl"
 	"github.com/ap4y/cloud/contextkey"
 	"github.com/ap4y/cloud/internal/httputil"
 	"github.com/ap4y/cloud/module"
@@ -16,28 +21,83 @@ import (
 
 type galleryAPI struct {
 	http.Handler
-	source Source
-	cache  Cache
+	source      Source
+	cache       Cache
+	thumbnailer *Thumbnailer
+	indexer     *Indexer
+
+	albumHandlers map[string]http.HandlerFunc
+	imageHandlers map[string]http.HandlerFunc
 }
 
-// NewGalleryAPI returns a new http.Handler instance that implements gallery related endpoints.
-func NewGalleryAPI(source Source, cache Cache) http.Handler {
+// NewGalleryAPI returns a new http.Handler instance that implements
+// gallery related endpoints. Thumbnails are generated by a
+// thumbnailer and cached in a cache, indexer reports pre-generation
+// progress.
+func NewGalleryAPI(source Source, cache Cache, thumbnailer *Thumbnailer, indexer *Indexer) http.Handler {
 	mux := chi.NewRouter()
-	api := &galleryAPI{mux, source, cache}
+	api := &galleryAPI{Handler: mux, source: source, cache: cache, thumbnailer: thumbnailer, indexer: indexer}
+
+	api.albumHandlers = map[string]http.HandlerFunc{
+		"album":     verifyHandler("", api.getAlbum),
+		"images":    verifyHandler("", api.listAlbumImages),
+		"archive":   verifyHandler("", api.getArchive),
+		"locations": verifyHandler("", api.listAlbumLocations),
+	}
+	api.imageHandlers = map[string]http.HandlerFunc{
+		"image":     verifyHandler("file", api.getImage),
+		"thumbnail": verifyHandler("file", api.getImageThumbnail),
+		"exif":      verifyHandler("file", api.getImageEXIF),
+	}
 
 	mux.Route("/", func(r chi.Router) {
 		r.Get("/", share.BlockHandler(api.listAlbums))
-		r.Route("/{gallery}", func(r chi.Router) {
-			r.Get("/images", share.VerifyHandler(module.Gallery, "gallery", "", api.listAlbumImages))
-			r.Get("/image/{file}", share.VerifyHandler(module.Gallery, "gallery", "file", api.getImage))
-			r.Get("/thumbnail/{file}", share.VerifyHandler(module.Gallery, "gallery", "file", api.getImageThumbnail))
-			r.Get("/exif/{file}", share.VerifyHandler(module.Gallery, "gallery", "file", api.getImageEXIF))
-		})
+		r.Get("/cache", share.BlockHandler(acl.AdminHandler(http.HandlerFunc(api.cacheStats)).ServeHTTP))
+		r.Get("/index", share.BlockHandler(acl.VerifyHandler(module.Gallery, acl.Read, "", "", api.indexProgress)))
+		r.Get("/timeline", share.BlockHandler(api.getTimeline))
+		r.Get("/locations", api.listLocations)
+		r.Get("/*", api.routeAlbum)
 	})
 
 	return api
 }
 
+// verifyHandler verifies share and user from the context against
+// gallery and optional item parameters.
+func verifyHandler(itemParam string, next http.HandlerFunc) http.HandlerFunc {
+	return share.VerifyHandler(module.Gallery, "gallery", itemParam, acl.VerifyHandler(module.Gallery, acl.Read, "gallery", itemParam, next))
+}
+
+// routeAlbum dispatches requests under nested album paths. Album
+// paths may contain any number of segments so endpoint is resolved
+// from the trailing segments: /{gallery}/images and
+// /{gallery}/image/{file} style paths are supported.
+func (api *galleryAPI) routeAlbum(w http.ResponseWriter, req *http.Request) {
+	segments := strings.Split(strings.Trim(chi.URLParam(req, "*"), "/"), "/")
+	rctx := chi.RouteContext(req.Context())
+
+	last := len(segments) - 1
+	if last < 1 {
+		http.NotFound(w, req)
+		return
+	}
+
+	if handler, ok := api.albumHandlers[segments[last]]; ok {
+		rctx.URLParams.Add("gallery", strings.Join(segments[:last], "/"))
+		handler(w, req)
+		return
+	}
+
+	if handler, ok := api.imageHandlers[segments[last-1]]; ok && last > 1 {
+		rctx.URLParams.Add("gallery", strings.Join(segments[:last-1], "/"))
+		rctx.URLParams.Add("file", segments[last])
+		handler(w, req)
+		return
+	}
+
+	http.NotFound(w, req)
+}
+
 func (api *galleryAPI) listAlbums(w http.ResponseWriter, req *http.Request) {
 	albums, err := api.source.Albums()
 	if err != nil {
@@ -45,78 +105,322 @@ func (api *galleryAPI) listAlbums(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	httputil.Respond(w, albums)
+	allowed := make([]Album, 0, len(albums))
+	for _, album := range albums {
+		if acl.Allowed(req, module.Gallery, album.Name, acl.Read) {
+			allowed = append(allowed, album)
+		}
+	}
+
+	httputil.Respond(w, allowed)
 }
 
-func (api *galleryAPI) listAlbumImages(w http.ResponseWriter, req *http.Request) {
-	galleryName := chi.URLParam(req, "gallery")
-	images, err := api.source.Images(galleryName)
+func (api *galleryAPI) getAlbum(w http.ResponseWriter, req *http.Request) {
+	album, err := api.source.Album(chi.URLParam(req, "gallery"))
 	if err != nil {
-		httputil.Error(w, fmt.Sprint("failed to fetch images:", err), http.StatusBadRequest)
+		httputil.Error(w, fmt.Sprint("failed to fetch album:", err), http.StatusNotFound)
 		return
 	}
 
+	// Nested albums are hidden unless share includes them.
 	if share, ok := req.Context().Value(contextkey.ShareCtxKey).(*share.Share); ok {
-		shareImages := make([]Image, 0, len(images))
-		for _, image := range images {
-			if share.Includes(galleryName, image.Path) {
-				shareImages = append(shareImages, image)
+		children := make([]string, 0, len(album.Children))
+		for _, child := range album.Children {
+			if share.IncludesName(child) {
+				children = append(children, child)
 			}
 		}
-		images = shareImages
+		album.Children = children
+
+		if cover, image := path.Split(album.Cover); !share.Includes(strings.TrimSuffix(cover, "/"), image) {
+			album.Cover = ""
+		}
+	}
+
+	httputil.Respond(w, album)
+}
+
+func (api *galleryAPI) cacheStats(w http.ResponseWriter, req *http.Request) {
+	httputil.Respond(w, api.cache.Stats())
+}
+
+func (api *galleryAPI) indexProgress(w http.ResponseWriter, req *http.Request) {
+	httputil.Respond(w, api.indexer.Progress())
+}
+
+func (api *galleryAPI) listAlbumImages(w http.ResponseWriter, req *http.Request) {
+	images, err := api.albumImages(req)
+	if err != nil {
+		httputil.Error(w, fmt.Sprint("failed to fetch images:", err), http.StatusBadRequest)
+		return
+	}
+
+	// Rendition URLs share prefix of the request so they are valid
+	// for share mounts as well.
+	albumPath := strings.TrimSuffix(req.URL.Path, "/images")
+	strip := stripsMetadata(req)
+	for i := range images {
+		images[i].Renditions = api.renditionURLs(albumPath, images[i].Path)
+		if strip {
+			images[i].Location = nil
+		}
 	}
 
 	httputil.Respond(w, images)
 }
 
-func (api *galleryAPI) getImage(w http.ResponseWriter, req *http.Request) {
-	file, err := api.source.Image(chi.URLParam(req, "gallery"), chi.URLParam(req, "file"))
+func (api *galleryAPI) getTimeline(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	limit := 0
+	if param := query.Get("limit"); param != "" {
+		var err error
+		if limit, err = strconv.Atoi(param); err != nil {
+			httputil.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	include := func(album string) bool { return acl.Allowed(req, module.Gallery, album, acl.Read) }
+	timeline, err := NewTimeline(api.source, include, TimelineGroup(query.Get("group")), query.Get("cursor"), limit)
 	if err != nil {
-		http.Error(w, fmt.Sprint("failed to fetch image:", err), http.StatusNotFound)
+		httputil.Error(w, fmt.Sprint("failed to fetch timeline:", err), http.StatusBadRequest)
 		return
 	}
 
-	fi, err := file.Stat()
+	basePath := strings.TrimSuffix(req.URL.Path, "/timeline")
+	for _, group := range timeline.Groups {
+		for i, image := range group.Images {
+			group.Images[i].Renditions = api.renditionURLs(basePath+"/"+image.Album, image.Path)
+		}
+	}
+
+	httputil.Respond(w, timeline)
+}
+
+func (api *galleryAPI) listLocations(w http.ResponseWriter, req *http.Request) {
+	albums, err := api.source.Albums()
 	if err != nil {
-		http.Error(w, fmt.Sprint("failed to read image file stats:", err), http.StatusNotFound)
+		httputil.Error(w, fmt.Sprint("failed to fetch albums:", err), http.StatusBadRequest)
 		return
 	}
 
-	http.ServeContent(w, req, fi.Name(), fi.ModTime(), file)
+	s, isShare := req.Context().Value(contextkey.ShareCtxKey).(*share.Share)
+	if isShare && (s.Type != module.Gallery || !s.KeepMetadata) {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	basePath := strings.TrimSuffix(req.URL.Path, "/locations")
+	locations := NewFeatureCollection()
+	for _, album := range albums {
+		if isShare && !s.IncludesName(album.Name) || !acl.Allowed(req, module.Gallery, album.Name, acl.Read) {
+			continue
+		}
+
+		images, err := api.source.Images(album.Name)
+		if err != nil {
+			httputil.Error(w, fmt.Sprint("failed to fetch images:", err), http.StatusBadRequest)
+			return
+		}
+
+		for _, image := range images {
+			if !isShare || s.Includes(album.Name, image.Path) {
+				locations.Add(album.Name, image, thumbnailURL(basePath+"/"+album.Name, image.Path, DefaultRendition))
+			}
+		}
+	}
+
+	httputil.Respond(w, locations)
 }
 
-func (api *galleryAPI) getImageThumbnail(w http.ResponseWriter, req *http.Request) {
+func (api *galleryAPI) listAlbumLocations(w http.ResponseWriter, req *http.Request) {
+	if stripsMetadata(req) {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	images, err := api.albumImages(req)
+	if err != nil {
+		httputil.Error(w, fmt.Sprint("failed to fetch images:", err), http.StatusNotFound)
+		return
+	}
+
 	galleryName := chi.URLParam(req, "gallery")
-	fileName := chi.URLParam(req, "file")
+	albumPath := strings.TrimSuffix(req.URL.Path, "/locations")
+	locations := NewFeatureCollection()
+	for _, image := range images {
+		locations.Add(galleryName, image, thumbnailURL(albumPath, image.Path, DefaultRendition))
+	}
 
-	if thumb, modTime := api.cache.Thumbnail(galleryName, fileName); thumb != nil {
-		http.ServeContent(w, req, fileName, modTime, thumb)
+	httputil.Respond(w, locations)
+}
+
+// renditionURLs returns URLs of all available renditions of an image
+// for a given album URL path.
+func (api *galleryAPI) renditionURLs(albumPath, image string) map[string]string {
+	renditions := api.thumbnailer.Renditions()
+	urls := make(map[string]string, len(renditions))
+	for _, rendition := range renditions {
+		urls[rendition] = thumbnailURL(albumPath, image, rendition)
+	}
+
+	return urls
+}
+
+// thumbnailURL returns URL of an image rendition for a given album
+// URL path.
+func thumbnailURL(albumPath, image, rendition string) string {
+	thumbURL := &url.URL{
+		Path:     albumPath + "/thumbnail/" + image,
+		RawQuery: url.Values{"rendition": {rendition}}.Encode(),
+	}
+
+	return thumbURL.String()
+}
+
+func (api *galleryAPI) getArchive(w http.ResponseWriter, req *http.Request) {
+	images, err := api.albumImages(req)
+	if err != nil {
+		httputil.Error(w, fmt.Sprint("failed to fetch images:", err), http.StatusNotFound)
 		return
 	}
 
-	file, err := api.source.Image(galleryName, fileName)
+	galleryName := chi.URLParam(req, "gallery")
+	archive := httputil.NewArchive(w, galleryName+".zip")
+
+	strip := stripsMetadata(req)
+	for _, image := range images {
+		file, err := api.source.Image(galleryName, image.Path)
+		if err != nil {
+			log.Print("failed to fetch image:", err)
+			panic(http.ErrAbortHandler)
+		}
+
+		var r io.Reader = file
+		if strip {
+			if r, err = Sanitize(file); err != nil {
+				file.Close()
+				log.Print("failed to strip image metadata:", err)
+				panic(http.ErrAbortHandler)
+			}
+		}
+
+		err = archive.AddFile(image.Path, image.ModTime, r)
+		file.Close()
+		if err != nil {
+			log.Print("failed to archive image:", err)
+			panic(http.ErrAbortHandler)
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		log.Print("failed to archive image:", err)
+	}
+}
+
+// stripsMetadata returns true if images are requested via a share
+// that doesn't keep image metadata.
+func stripsMetadata(req *http.Request) bool {
+	s, ok := req.Context().Value(contextkey.ShareCtxKey).(*share.Share)
+	return ok && !s.KeepMetadata
+}
+
+// albumImages returns images of a requested album filtered by a
+// share from the request context.
+func (api *galleryAPI) albumImages(req *http.Request) ([]Image, error) {
+	galleryName := chi.URLParam(req, "gallery")
+	images, err := api.source.Images(galleryName)
+	if err != nil {
+		return nil, err
+	}
+
+	share, ok := req.Context().Value(contextkey.ShareCtxKey).(*share.Share)
+	if !ok {
+		return images, nil
+	}
+
+	shareImages := make([]Image, 0, len(images))
+	for _, image := range images {
+		if share.Includes(galleryName, image.Path) {
+			shareImages = append(shareImages, image)
+		}
+	}
+
+	return shareImages, nil
+}
+
+func (api *galleryAPI) getImage(w http.ResponseWriter, req *http.Request) {
+	file, err := api.source.Image(chi.URLParam(req, "gallery"), chi.URLParam(req, "file"))
 	if err != nil {
 		http.Error(w, fmt.Sprint("failed to fetch image:", err), http.StatusNotFound)
 		return
 	}
+	defer file.Close()
 
-	thumbData, err := Thumbnail(file, 200)
+	fi, err := file.Stat()
 	if err != nil {
-		http.Error(w, fmt.Sprint("failed to generate thumbnail:", err), http.StatusNotFound)
+		http.Error(w, fmt.Sprint("failed to read image file stats:", err), http.StatusNotFound)
+		return
+	}
+
+	// Sanitized images are oriented as well.
+	if stripsMetadata(req) {
+		img, err := Sanitize(file)
+		if err != nil {
+			http.Error(w, fmt.Sprint("failed to strip image metadata:", err), http.StatusNotFound)
+			return
+		}
+
+		http.ServeContent(w, req, fi.Name(), fi.ModTime(), img)
+		return
+	}
+
+	if display, _ := strconv.ParseBool(req.URL.Query().Get("display")); display {
+		img, err := Display(file)
+		if err != nil {
+			http.Error(w, fmt.Sprint("failed to orient image:", err), http.StatusNotFound)
+			return
+		}
+
+		if img != file {
+			w.Header().Set("Content-Type", "image/jpeg")
+		}
+
+		http.ServeContent(w, req, fi.Name(), fi.ModTime(), img)
+		return
+	}
+
+	http.ServeContent(w, req, fi.Name(), fi.ModTime(), file)
+}
+
+func (api *galleryAPI) getImageThumbnail(w http.ResponseWriter, req *http.Request) {
+	rendition := req.URL.Query().Get("rendition")
+	if rendition == "" {
+		rendition = DefaultRendition
+	}
+
+	fileName := chi.URLParam(req, "file")
+	thumb, modTime, err := api.thumbnailer.Thumbnail(req.Context(), chi.URLParam(req, "gallery"), fileName, rendition)
+	if err == ErrUnknownRendition {
+		http.Error(w, fmt.Sprint("failed to fetch thumbnail:", err), http.StatusBadRequest)
 		return
 	}
 
-	thumb, err := api.cache.StoreThumbnail(galleryName, fileName, thumbData)
 	if err != nil {
-		log.Print("failed to cache thumbnail:", err)
-		http.Error(w, "", http.StatusNotFound)
+		http.Error(w, fmt.Sprint("failed to fetch thumbnail:", err), http.StatusNotFound)
 		return
 	}
+	defer thumb.Close()
 
-	http.ServeContent(w, req, fileName, time.Now(), thumb)
+	http.ServeContent(w, req, fileName, modTime, thumb)
 }
 
 func (api *galleryAPI) getImageEXIF(w http.ResponseWriter, req *http.Request) {
+	if stripsMetadata(req) {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
 	file, err := api.source.Image(chi.URLParam(req, "gallery"), chi.URLParam(req, "file"))
 	if err != nil {
 		httputil.Error(w, fmt.Sprint("failed to fetch image:", err), http.StatusNotFound)
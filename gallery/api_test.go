@@ -1,8 +1,11 @@
 package gallery
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
 	"encoding/json"
+	"image"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -13,6 +16,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/ap4y/cloud/acl"
 	"github.com/ap4y/cloud/contextkey"
 	"github.com/ap4y/cloud/module"
 	"github.com/ap4y/cloud/share"
@@ -29,10 +33,12 @@ func TestGalleryAPI(t *testing.T) {
 	require.NoError(t, err)
 	defer os.RemoveAll(dir)
 
-	cache, err := NewDiskCache(dir)
+	cache, err := NewDiskCache(dir, 0, 0)
 	require.NoError(t, err)
 
-	api := NewGalleryAPI(src, cache)
+	thumbnailer, err := NewThumbnailer(src, cache, map[string]uint{"preview": 1080}, 0)
+	require.NoError(t, err)
+	api := NewGalleryAPI(src, cache, thumbnailer, NewIndexer(src, thumbnailer))
 	s := &share.Share{Type: module.Gallery, Name: "album1", Items: []string{"test.jpg"}}
 
 	t.Run("listAlbums", func(t *testing.T) {
@@ -60,6 +66,119 @@ func TestGalleryAPI(t *testing.T) {
 		require.Equal(t, http.StatusNotFound, resp.StatusCode)
 	})
 
+	t.Run("cacheStats", func(t *testing.T) {
+		for _, role := range []acl.Role{acl.RoleViewer, acl.RoleEditor} {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "http://cloud.api/cache", nil)
+			ctx := context.WithValue(req.Context(), contextkey.UserCtxKey, &acl.User{Role: role})
+			api.ServeHTTP(w, req.WithContext(ctx))
+			assert.Equal(t, http.StatusForbidden, w.Result().StatusCode, role)
+		}
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://cloud.api/cache", nil)
+		ctx := context.WithValue(req.Context(), contextkey.UserCtxKey, &acl.User{Role: acl.RoleAdmin})
+		api.ServeHTTP(w, req.WithContext(ctx))
+
+		resp := w.Result()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		stats := &CacheStats{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(stats))
+		assert.Equal(t, 0, stats.Entries)
+	})
+
+	t.Run("cacheStats/with share", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://cloud.api/cache", nil)
+		ctx := context.WithValue(req.Context(), contextkey.ShareCtxKey, s)
+		api.ServeHTTP(w, req.WithContext(ctx))
+
+		resp := w.Result()
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("indexProgress", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://cloud.api/index", nil)
+		api.ServeHTTP(w, req)
+
+		resp := w.Result()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		progress := &IndexProgress{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(progress))
+		assert.False(t, progress.Running)
+	})
+
+	t.Run("indexProgress/with share", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://cloud.api/index", nil)
+		ctx := context.WithValue(req.Context(), contextkey.ShareCtxKey, s)
+		api.ServeHTTP(w, req.WithContext(ctx))
+
+		resp := w.Result()
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("getTimeline", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://cloud.api/timeline?group=month&limit=1", nil)
+		api.ServeHTTP(w, req)
+
+		resp := w.Result()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		timeline := &Timeline{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(timeline))
+		require.Len(t, timeline.Groups, 1)
+		assert.Equal(t, "2018-08", timeline.Groups[0].Date)
+		assert.Equal(t, "album1", timeline.Groups[0].Images[0].Album)
+		assert.Equal(t, "/album1/thumbnail/test.jpg?rendition=thumbnail", timeline.Groups[0].Images[0].Renditions["thumbnail"])
+		assert.NotEmpty(t, timeline.NextCursor)
+	})
+
+	t.Run("getTimeline/invalid", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://cloud.api/timeline?limit=foo", nil)
+		api.ServeHTTP(w, req)
+		require.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+
+		w = httptest.NewRecorder()
+		req = httptest.NewRequest("GET", "http://cloud.api/timeline?group=week", nil)
+		api.ServeHTTP(w, req)
+		require.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+	})
+
+	t.Run("getTimeline/with rules", func(t *testing.T) {
+		user := &acl.User{Role: acl.RoleViewer, Rules: []acl.Rule{{Module: module.Gallery, Path: "album2"}}}
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://cloud.api/timeline", nil)
+		ctx := context.WithValue(req.Context(), contextkey.UserCtxKey, user)
+		api.ServeHTTP(w, req.WithContext(ctx))
+
+		resp := w.Result()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		timeline := &Timeline{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(timeline))
+		require.NotEmpty(t, timeline.Groups)
+		for _, group := range timeline.Groups {
+			for _, image := range group.Images {
+				assert.Equal(t, "album2", image.Album)
+			}
+		}
+	})
+
+	t.Run("getTimeline/with share", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://cloud.api/timeline", nil)
+		ctx := context.WithValue(req.Context(), contextkey.ShareCtxKey, s)
+		api.ServeHTTP(w, req.WithContext(ctx))
+
+		require.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+	})
+
 	t.Run("listAlbumImages", func(t *testing.T) {
 		w := httptest.NewRecorder()
 		req := httptest.NewRequest("GET", "http://cloud.api/album1/images", nil)
@@ -74,6 +193,10 @@ func TestGalleryAPI(t *testing.T) {
 
 		require.Len(t, images, 1)
 		assert.Equal(t, "test", images[0].Name)
+		assert.Equal(t, map[string]string{
+			"preview":   "/album1/thumbnail/test.jpg?rendition=preview",
+			"thumbnail": "/album1/thumbnail/test.jpg?rendition=thumbnail",
+		}, images[0].Renditions)
 	})
 
 	t.Run("listAlbumImages/with_share", func(t *testing.T) {
@@ -113,6 +236,22 @@ func TestGalleryAPI(t *testing.T) {
 		assert.Equal(t, "image/jpeg", resp.Header.Get("Content-Type"))
 	})
 
+	t.Run("getImage/display", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://cloud.api/album1/image/test.jpg?display=true", nil)
+		api.ServeHTTP(w, req)
+
+		resp := w.Result()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "image/jpeg", resp.Header.Get("Content-Type"))
+
+		data, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		image, err := ioutil.ReadFile("./fixtures/album1/test.jpg")
+		require.NoError(t, err)
+		assert.Equal(t, len(image), len(data))
+	})
+
 	t.Run("getImage/with share", func(t *testing.T) {
 		w := httptest.NewRecorder()
 		req := httptest.NewRequest("GET", "http://cloud.api/album1/image/test.jpg", nil)
@@ -122,6 +261,24 @@ func TestGalleryAPI(t *testing.T) {
 		resp := w.Result()
 		require.Equal(t, http.StatusOK, resp.StatusCode)
 		assert.Equal(t, "image/jpeg", resp.Header.Get("Content-Type"))
+
+		_, err := EXIF(resp.Body)
+		assert.Error(t, err)
+	})
+
+	t.Run("getImage/with keep metadata share", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://cloud.api/album1/image/test.jpg", nil)
+		ks := *s
+		ks.KeepMetadata = true
+		ctx := context.WithValue(req.Context(), contextkey.ShareCtxKey, &ks)
+		api.ServeHTTP(w, req.WithContext(ctx))
+
+		resp := w.Result()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		_, err := EXIF(resp.Body)
+		assert.NoError(t, err)
 	})
 
 	t.Run("getImage/with unmatched share", func(t *testing.T) {
@@ -144,6 +301,28 @@ func TestGalleryAPI(t *testing.T) {
 		assert.Equal(t, "image/jpeg", resp.Header.Get("Content-Type"))
 	})
 
+	t.Run("getImageThumbnail/rendition", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://cloud.api/album1/thumbnail/test.jpg?rendition=preview", nil)
+		api.ServeHTTP(w, req)
+
+		resp := w.Result()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		cfg, _, err := image.DecodeConfig(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, 1080, cfg.Height)
+	})
+
+	t.Run("getImageThumbnail/unknown rendition", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://cloud.api/album1/thumbnail/test.jpg?rendition=huge", nil)
+		api.ServeHTTP(w, req)
+
+		resp := w.Result()
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
 	t.Run("getImageThumbnail/with share", func(t *testing.T) {
 		w := httptest.NewRecorder()
 		req := httptest.NewRequest("GET", "http://cloud.api/album1/thumbnail/test.jpg", nil)
@@ -165,6 +344,49 @@ func TestGalleryAPI(t *testing.T) {
 		require.Equal(t, http.StatusNotFound, resp.StatusCode)
 	})
 
+	t.Run("getArchive", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://cloud.api/album1/archive", nil)
+		api.ServeHTTP(w, req)
+
+		resp := w.Result()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "application/zip", resp.Header.Get("Content-Type"))
+		assert.Equal(t, `attachment; filename=album1.zip`, resp.Header.Get("Content-Disposition"))
+
+		data, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		require.NoError(t, err)
+		require.Len(t, zr.File, 1)
+		assert.Equal(t, "test.jpg", zr.File[0].Name)
+
+		image, err := ioutil.ReadFile("./fixtures/album1/test.jpg")
+		require.NoError(t, err)
+		assert.Equal(t, uint64(len(image)), zr.File[0].UncompressedSize64)
+	})
+
+	t.Run("getArchive/with share", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://cloud.api/album1/archive", nil)
+		ctx := context.WithValue(req.Context(), contextkey.ShareCtxKey, s)
+		api.ServeHTTP(w, req.WithContext(ctx))
+
+		resp := w.Result()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "application/zip", resp.Header.Get("Content-Type"))
+	})
+
+	t.Run("getArchive/with unmatched share", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://cloud.api/album2/archive", nil)
+		ctx := context.WithValue(req.Context(), contextkey.ShareCtxKey, s)
+		api.ServeHTTP(w, req.WithContext(ctx))
+
+		resp := w.Result()
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
 	t.Run("getImageEXIF", func(t *testing.T) {
 		w := httptest.NewRecorder()
 		req := httptest.NewRequest("GET", "http://cloud.api/album1/exif/test.jpg", nil)
@@ -174,4 +396,97 @@ func TestGalleryAPI(t *testing.T) {
 		require.Equal(t, http.StatusOK, resp.StatusCode)
 		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
 	})
+
+	t.Run("getImageEXIF/with share", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://cloud.api/album1/exif/test.jpg", nil)
+		ctx := context.WithValue(req.Context(), contextkey.ShareCtxKey, s)
+		api.ServeHTTP(w, req.WithContext(ctx))
+
+		resp := w.Result()
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestGalleryAPINested(t *testing.T) {
+	srcDir := nestedFixtures(t)
+	defer os.RemoveAll(srcDir)
+
+	src, err := NewDiskSource(srcDir, []string{".jpg"})
+	require.NoError(t, err)
+
+	dir, err := ioutil.TempDir("", "cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cache, err := NewDiskCache(dir, 0, 0)
+	require.NoError(t, err)
+
+	thumbnailer, err := NewThumbnailer(src, cache, nil, 0)
+	require.NoError(t, err)
+	api := NewGalleryAPI(src, cache, thumbnailer, NewIndexer(src, thumbnailer))
+
+	shared := &share.Share{Type: module.Gallery, Name: "2023/japan", Items: []string{"test.jpg"}}
+	nested := &share.Share{Type: module.Gallery, Name: "2023/japan", Items: []string{"test.jpg"}, Nested: true}
+
+	tcs := []struct {
+		name   string
+		path   string
+		share  *share.Share
+		status int
+	}{
+		{"album", "/2023/album", nil, http.StatusOK},
+		{"images", "/2023/japan/tokyo/images", nil, http.StatusOK},
+		{"image", "/2023/japan/tokyo/image/test.jpg", nil, http.StatusOK},
+		{"thumbnail", "/2023/japan/thumbnail/test.jpg", nil, http.StatusOK},
+		{"exif", "/2023/japan/exif/test.jpg", nil, http.StatusOK},
+		{"archive", "/2023/japan/archive", nil, http.StatusOK},
+		{"unknown action", "/2023/japan/foo", nil, http.StatusNotFound},
+		{"missing album", "/images", nil, http.StatusNotFound},
+		{"share", "/2023/japan/image/test.jpg", shared, http.StatusOK},
+		{"share/parent", "/2023/album", shared, http.StatusNotFound},
+		{"share/sub-album", "/2023/japan/tokyo/image/test.jpg", shared, http.StatusNotFound},
+		{"nested share/sub-album", "/2023/japan/tokyo/image/test.jpg", nested, http.StatusOK},
+		{"nested share/sibling", "/2023/korea/images", nested, http.StatusNotFound},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "http://cloud.api"+tc.path, nil)
+			if tc.share != nil {
+				req = req.WithContext(context.WithValue(req.Context(), contextkey.ShareCtxKey, tc.share))
+			}
+			api.ServeHTTP(w, req)
+
+			require.Equal(t, tc.status, w.Result().StatusCode)
+		})
+	}
+
+	t.Run("getAlbum", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://cloud.api/2023/japan/album", nil)
+		req = req.WithContext(context.WithValue(req.Context(), contextkey.ShareCtxKey, shared))
+		api.ServeHTTP(w, req)
+
+		resp := w.Result()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		album := &Album{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(album))
+		assert.Equal(t, "2023/japan", album.Name)
+		assert.Equal(t, "2023/japan/test.jpg", album.Cover)
+		assert.Empty(t, album.Children)
+	})
+
+	t.Run("listAlbumImages/renditions", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://cloud.api/2023/japan/images", nil)
+		api.ServeHTTP(w, req)
+
+		images := make([]*Image, 0)
+		require.NoError(t, json.NewDecoder(w.Result().Body).Decode(&images))
+		require.Len(t, images, 1)
+		assert.Equal(t, "/2023/japan/thumbnail/test.jpg?rendition=thumbnail", images[0].Renditions["thumbnail"])
+	})
 }
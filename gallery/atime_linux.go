@@ -0,0 +1,17 @@
+package gallery
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// accessTime returns last access time of a file.
+func accessTime(fi os.FileInfo) time.Time {
+	stat, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fi.ModTime()
+	}
+
+	return time.Unix(stat.Atim.Sec, stat.Atim.Nsec)
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package gallery
+
+import (
+	"os"
+	"time"
+)
+
+// accessTime returns modification time of a file on platforms
+// without a linux stat structure.
+func accessTime(fi os.FileInfo) time.Time {
+	return fi.ModTime()
+}
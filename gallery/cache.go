@@ -1,12 +1,17 @@
 package gallery
 
 import (
+	"container/list"
 	"crypto/md5"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/ap4y/cloud/internal/pathutil"
@@ -14,20 +19,75 @@ import (
 
 // Cache caches gallery metadata.
 type Cache interface {
-	// Returns thumbnail and modtime for a given image path if it exists, otherwise returns nil.
-	Thumbnail(gallery, image string) (io.ReadSeeker, time.Time)
-	// Stores thumbnail for a given image path and returns reader for a stored thumbnail.
-	StoreThumbnail(gallery, image string, r io.Reader) (io.ReadSeeker, error)
+	// Returns thumbnail rendition and modtime for a given image
+	// path if it exists and was generated from a source image with
+	// the same size and modtime, otherwise returns nil.
+	Thumbnail(gallery, image, rendition string, src os.FileInfo) (*os.File, time.Time)
+	// Stores thumbnail rendition generated from a source image for
+	// a given image path and returns a stored thumbnail. Renditions
+	// of previous source versions are removed.
+	StoreThumbnail(gallery, image, rendition string, src os.FileInfo, r io.Reader) (*os.File, error)
+	// RemoveOrphans removes thumbnails of images that are no longer
+	// present in a source and returns number of removed thumbnails.
+	RemoveOrphans(source Source) (int, error)
+	// Stats returns cache usage statistics.
+	Stats() CacheStats
 }
 
-// DiskCache implements cache over filesystem.
+// CacheStats stores cache usage statistics.
+type CacheStats struct {
+	Hits       int64 `json:"hits"`
+	Misses     int64 `json:"misses"`
+	Entries    int   `json:"entries"`
+	Size       int64 `json:"size"`
+	MaxEntries int   `json:"max_entries"`
+	MaxSize    int64 `json:"max_size"`
+}
+
+var (
+	// cacheKeyPattern matches thumbnail file names, see diskCache.cacheKey.
+	cacheKeyPattern = regexp.MustCompile(`^([0-9a-f]{32})-([a-z0-9]+)-\d+-\d+$`)
+	// stalePattern matches leftover temporary files and thumbnails
+	// stored without source version or rendition.
+	stalePattern = regexp.MustCompile(`^(\.[0-9a-f]{32}(-[a-z0-9]+)?-\d+-\d+\.\d+|[0-9a-f]{32}(-\d+-\d+)?)$`)
+	// renditionPattern matches valid rendition names.
+	renditionPattern = regexp.MustCompile(`^[a-z0-9]+$`)
+)
+
+type cacheEntry struct {
+	key        string
+	imageKey   string
+	rendition  string
+	size       int64
+	accessedAt time.Time
+}
+
+// variant identifies image rendition regardless of source version.
+func (ce *cacheEntry) variant() string {
+	return ce.imageKey + "-" + ce.rendition
+}
+
+// DiskCache implements cache over filesystem. Cache size is bounded
+// by maxSize bytes and maxEntries thumbnails, least recently
+// accessed thumbnails are evicted first.
 type diskCache struct {
-	dir string
+	dir        string
+	maxSize    int64
+	maxEntries int
+
+	mu       sync.Mutex
+	lru      *list.List
+	entries  map[string]*list.Element
+	variants map[string]*list.Element
+	size     int64
+	hits     int64
+	misses   int64
 }
 
 // NewDiskCache returns a new Cache instance that uses filesystem.
-// dir will be created if necessary.
-func NewDiskCache(dir string) (Cache, error) {
+// dir will be created if necessary. Zero maxSize or maxEntries
+// disable corresponding limit.
+func NewDiskCache(dir string, maxSize int64, maxEntries int) (Cache, error) {
 	if dir == "" {
 		return nil, errors.New("dir can't be empty")
 	}
@@ -38,41 +98,256 @@ func NewDiskCache(dir string) (Cache, error) {
 		}
 	}
 
-	return &diskCache{dir}, nil
+	dc := &diskCache{
+		dir:        dir,
+		maxSize:    maxSize,
+		maxEntries: maxEntries,
+		lru:        list.New(),
+		entries:    map[string]*list.Element{},
+		variants:   map[string]*list.Element{},
+	}
+
+	if err := dc.scan(); err != nil {
+		return nil, fmt.Errorf("failed to scan cache dir: %s", err)
+	}
+
+	return dc, nil
 }
 
-func (dc *diskCache) cacheKey(gallery, image string) string {
+func (dc *diskCache) imageKey(gallery, image string) string {
 	imagePath := pathutil.Join(gallery, image)
 	return fmt.Sprintf("%x", md5.Sum([]byte(imagePath)))
 }
 
-func (dc *diskCache) Thumbnail(gallery, image string) (io.ReadSeeker, time.Time) {
-	filename := dc.cacheKey(gallery, image)
+// cacheKey returns file name of a thumbnail rendition, source image
+// size and modtime are part of the key so thumbnails of the modified
+// images are never served.
+func (dc *diskCache) cacheKey(gallery, image, rendition string, src os.FileInfo) string {
+	return fmt.Sprintf("%s-%s-%d-%d", dc.imageKey(gallery, image), rendition, src.Size(), src.ModTime().UnixNano())
+}
+
+func (dc *diskCache) Thumbnail(gallery, image, rendition string, src os.FileInfo) (*os.File, time.Time) {
+	if !renditionPattern.MatchString(rendition) {
+		return nil, time.Time{}
+	}
+
+	filename := dc.cacheKey(gallery, image, rendition, src)
 	path := filepath.Join(dc.dir, filename)
+
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	el := dc.entries[filename]
+	if el == nil {
+		// Thumbnails stored by other processes are picked up.
+		fi, err := os.Stat(path)
+		if err != nil {
+			dc.misses++
+			return nil, time.Time{}
+		}
+
+		el = dc.add(&cacheEntry{filename, dc.imageKey(gallery, image), rendition, fi.Size(), time.Now()})
+		dc.evict()
+	}
+
 	file, err := os.OpenFile(path, os.O_RDONLY, 0600)
 	if err != nil {
+		dc.misses++
+		dc.remove(el)
 		return nil, time.Time{}
 	}
 
+	dc.hits++
+	entry := el.Value.(*cacheEntry)
+	entry.accessedAt = time.Now()
+	dc.lru.MoveToFront(el)
+
 	fi, err := file.Stat()
 	if err != nil {
 		return file, time.Now()
 	}
 
+	// Access time is persisted for mounts without atime updates.
+	os.Chtimes(path, entry.accessedAt, fi.ModTime()) // nolint: errcheck
+
 	return file, fi.ModTime()
 }
 
-func (dc *diskCache) StoreThumbnail(gallery, image string, r io.Reader) (io.ReadSeeker, error) {
-	filename := dc.cacheKey(gallery, image)
+func (dc *diskCache) StoreThumbnail(gallery, image, rendition string, src os.FileInfo, r io.Reader) (*os.File, error) {
+	if !renditionPattern.MatchString(rendition) {
+		return nil, fmt.Errorf("invalid rendition: %s", rendition)
+	}
+
+	filename := dc.cacheKey(gallery, image, rendition, src)
 	path := filepath.Join(dc.dir, filename)
-	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+
+	// Thumbnail is written into a temporary file first so
+	// concurrent readers never observe partially written
+	// thumbnails.
+	tmp, err := ioutil.TempFile(dc.dir, "."+filename+".")
 	if err != nil {
 		return nil, fmt.Errorf("file: %s", err)
 	}
+	defer os.Remove(tmp.Name()) // nolint: errcheck
 
-	if _, err := io.Copy(file, r); err != nil {
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
 		return nil, fmt.Errorf("copy: %s", err)
 	}
 
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("file: %s", err)
+	}
+
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, fmt.Errorf("rename: %s", err)
+	}
+
+	dc.add(&cacheEntry{filename, dc.imageKey(gallery, image), rendition, size, time.Now()})
+	dc.evict()
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("file: %s", err)
+	}
+
 	return file, nil
 }
+
+func (dc *diskCache) RemoveOrphans(source Source) (int, error) {
+	albums, err := source.Albums()
+	if err != nil {
+		return 0, fmt.Errorf("albums: %s", err)
+	}
+
+	imageKeys := map[string]bool{}
+	for _, album := range albums {
+		images, err := source.Images(album.Name)
+		if err != nil {
+			return 0, fmt.Errorf("images: %s", err)
+		}
+
+		for _, image := range images {
+			imageKeys[dc.imageKey(album.Name, image.Path)] = true
+		}
+	}
+
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	removed := 0
+	for _, el := range dc.variants {
+		if !imageKeys[el.Value.(*cacheEntry).imageKey] {
+			dc.remove(el)
+			removed++
+		}
+	}
+
+	return removed, nil
+}
+
+func (dc *diskCache) Stats() CacheStats {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	return CacheStats{
+		Hits:       dc.hits,
+		Misses:     dc.misses,
+		Entries:    dc.lru.Len(),
+		Size:       dc.size,
+		MaxEntries: dc.maxEntries,
+		MaxSize:    dc.maxSize,
+	}
+}
+
+// scan rebuilds cache index from a cache dir, leftover temporary
+// and legacy thumbnails are removed.
+func (dc *diskCache) scan() error {
+	fis, err := ioutil.ReadDir(dc.dir)
+	if err != nil {
+		return err
+	}
+
+	entries := make([]*cacheEntry, 0, len(fis))
+	for _, fi := range fis {
+		if fi.IsDir() {
+			continue
+		}
+
+		if stalePattern.MatchString(fi.Name()) {
+			os.Remove(filepath.Join(dc.dir, fi.Name())) // nolint: errcheck
+			continue
+		}
+
+		matches := cacheKeyPattern.FindStringSubmatch(fi.Name())
+		if matches == nil {
+			continue
+		}
+
+		entries = append(entries, &cacheEntry{fi.Name(), matches[1], matches[2], fi.Size(), accessTime(fi)})
+	}
+
+	// Entries are added from the least recently accessed so the
+	// most recent one ends up at the front.
+	sort.Slice(entries, func(i, j int) bool { return entries[i].accessedAt.Before(entries[j].accessedAt) })
+
+	for _, entry := range entries {
+		dc.add(entry)
+	}
+
+	dc.evict()
+	return nil
+}
+
+// add inserts entry at the front, drops previous version of the
+// same rendition and returns inserted element. Callers must hold mu.
+func (dc *diskCache) add(entry *cacheEntry) *list.Element {
+	if el := dc.entries[entry.key]; el != nil {
+		dc.size += entry.size - el.Value.(*cacheEntry).size
+		el.Value = entry
+		dc.lru.MoveToFront(el)
+		return el
+	}
+
+	if el := dc.variants[entry.variant()]; el != nil {
+		dc.remove(el)
+	}
+
+	el := dc.lru.PushFront(entry)
+	dc.entries[entry.key] = el
+	dc.variants[entry.variant()] = el
+	dc.size += entry.size
+	return el
+}
+
+// remove drops entry from the index and removes thumbnail
+// file. Callers must hold mu.
+func (dc *diskCache) remove(el *list.Element) {
+	entry := el.Value.(*cacheEntry)
+	dc.lru.Remove(el)
+	delete(dc.entries, entry.key)
+	if dc.variants[entry.variant()] == el {
+		delete(dc.variants, entry.variant())
+	}
+	dc.size -= entry.size
+
+	os.Remove(filepath.Join(dc.dir, entry.key)) // nolint: errcheck
+}
+
+// evict removes least recently accessed entries until cache fits
+// limits, the most recent entry is always kept. Callers must hold mu.
+func (dc *diskCache) evict() {
+	for dc.lru.Len() > 1 {
+		overEntries := dc.maxEntries > 0 && dc.lru.Len() > dc.maxEntries
+		overSize := dc.maxSize > 0 && dc.size > dc.maxSize
+		if !overEntries && !overSize {
+			return
+		}
+
+		dc.remove(dc.lru.Back())
+	}
+}
@@ -3,6 +3,8 @@ package gallery
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -15,20 +17,226 @@ func TestDiskCache(t *testing.T) {
 	require.NoError(t, err)
 	defer os.RemoveAll(dir)
 
-	cache, err := NewDiskCache(dir)
+	cache, err := NewDiskCache(dir, 0, 0)
 	require.NoError(t, err)
 
-	img, _ := cache.Thumbnail("", "test.jpg")
+	src, err := os.Stat("fixtures/album1/test.jpg")
+	require.NoError(t, err)
+
+	img, _ := cache.Thumbnail("", "test.jpg", "thumbnail", src)
 	require.Nil(t, img)
 
 	file, err := os.Open("fixtures/album1/test.jpg")
 	require.NoError(t, err)
+	defer file.Close()
 
 	ts := time.Now()
-	_, err = cache.StoreThumbnail("", "test.jpg", file)
+	thumb, err := cache.StoreThumbnail("", "test.jpg", "thumbnail", src, file)
 	require.NoError(t, err)
+	thumb.Close()
 
-	img, modtime := cache.Thumbnail("", "test.jpg")
+	img, modtime := cache.Thumbnail("", "test.jpg", "thumbnail", src)
 	require.NotNil(t, img)
+	img.Close()
 	assert.Equal(t, ts.Unix(), modtime.Unix())
+
+	t.Run("invalidation", func(t *testing.T) {
+		imgPath := filepath.Join(dir, "image.jpg")
+		require.NoError(t, ioutil.WriteFile(imgPath, []byte("foo"), 0600))
+		src, err := os.Stat(imgPath)
+		require.NoError(t, err)
+
+		thumb, err := cache.StoreThumbnail("album", "image.jpg", "thumbnail", src, strings.NewReader("thumb1"))
+		require.NoError(t, err)
+		thumb.Close()
+
+		modTime := src.ModTime().Add(time.Second)
+		require.NoError(t, os.Chtimes(imgPath, modTime, modTime))
+		updated, err := os.Stat(imgPath)
+		require.NoError(t, err)
+
+		img, _ := cache.Thumbnail("album", "image.jpg", "thumbnail", updated)
+		require.Nil(t, img)
+
+		thumb, err = cache.StoreThumbnail("album", "image.jpg", "thumbnail", updated, strings.NewReader("thumb2"))
+		require.NoError(t, err)
+		thumb.Close()
+
+		img, _ = cache.Thumbnail("album", "image.jpg", "thumbnail", src)
+		require.Nil(t, img)
+
+		img, _ = cache.Thumbnail("album", "image.jpg", "thumbnail", updated)
+		require.NotNil(t, img)
+		defer img.Close()
+
+		data, err := ioutil.ReadAll(img)
+		require.NoError(t, err)
+		assert.Equal(t, "thumb2", string(data))
+
+		matches, err := filepath.Glob(filepath.Join(dir, cache.(*diskCache).imageKey("album", "image.jpg")+"-*"))
+		require.NoError(t, err)
+		assert.Len(t, matches, 1)
+	})
+
+	t.Run("overwrite", func(t *testing.T) {
+		thumb, err := cache.StoreThumbnail("", "test.jpg", "thumbnail", src, strings.NewReader("thumb"))
+		require.NoError(t, err)
+		defer thumb.Close()
+
+		data, err := ioutil.ReadAll(thumb)
+		require.NoError(t, err)
+		assert.Equal(t, "thumb", string(data))
+
+		matches, err := filepath.Glob(filepath.Join(dir, ".*"))
+		require.NoError(t, err)
+		assert.Len(t, matches, 0)
+	})
+
+	t.Run("renditions", func(t *testing.T) {
+		thumb, err := cache.StoreThumbnail("album1", "test.jpg", "preview", src, strings.NewReader("preview"))
+		require.NoError(t, err)
+		thumb.Close()
+
+		thumb, err = cache.StoreThumbnail("album1", "test.jpg", "large", src, strings.NewReader("large"))
+		require.NoError(t, err)
+		thumb.Close()
+
+		img, _ := cache.Thumbnail("album1", "test.jpg", "preview", src)
+		require.NotNil(t, img)
+		defer img.Close()
+
+		data, err := ioutil.ReadAll(img)
+		require.NoError(t, err)
+		assert.Equal(t, "preview", string(data))
+
+		_, err = cache.StoreThumbnail("album1", "test.jpg", "../large", src, strings.NewReader("large"))
+		require.Error(t, err)
+	})
+
+	t.Run("external", func(t *testing.T) {
+		external, err := NewDiskCache(dir, 0, 0)
+		require.NoError(t, err)
+
+		thumb, err := external.StoreThumbnail("album1", "test.jpg", "thumbnail", src, strings.NewReader("external"))
+		require.NoError(t, err)
+		thumb.Close()
+
+		img, _ := cache.Thumbnail("album1", "test.jpg", "thumbnail", src)
+		require.NotNil(t, img)
+		defer img.Close()
+
+		data, err := ioutil.ReadAll(img)
+		require.NoError(t, err)
+		assert.Equal(t, "external", string(data))
+	})
+}
+
+func TestDiskCacheEviction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	src, err := os.Stat("fixtures/album1/test.jpg")
+	require.NoError(t, err)
+
+	store := func(cache Cache, image string) {
+		thumb, err := cache.StoreThumbnail("album1", image, "thumbnail", src, strings.NewReader("thumb"))
+		require.NoError(t, err)
+		thumb.Close()
+	}
+
+	exists := func(cache Cache, image string) bool {
+		thumb, _ := cache.Thumbnail("album1", image, "thumbnail", src)
+		if thumb != nil {
+			thumb.Close()
+		}
+		return thumb != nil
+	}
+
+	t.Run("max entries", func(t *testing.T) {
+		cache, err := NewDiskCache(dir, 0, 2)
+		require.NoError(t, err)
+
+		store(cache, "1.jpg")
+		store(cache, "2.jpg")
+		require.True(t, exists(cache, "1.jpg"))
+		store(cache, "3.jpg")
+
+		assert.True(t, exists(cache, "1.jpg"))
+		assert.False(t, exists(cache, "2.jpg"))
+		assert.True(t, exists(cache, "3.jpg"))
+
+		stats := cache.Stats()
+		assert.Equal(t, 2, stats.Entries)
+		assert.Equal(t, int64(10), stats.Size)
+		assert.Equal(t, int64(3), stats.Hits)
+		assert.Equal(t, int64(1), stats.Misses)
+		assert.Equal(t, 2, stats.MaxEntries)
+	})
+
+	t.Run("max size", func(t *testing.T) {
+		cache, err := NewDiskCache(dir, 12, 0)
+		require.NoError(t, err)
+
+		stats := cache.Stats()
+		assert.Equal(t, 2, stats.Entries)
+		assert.Equal(t, int64(0), stats.Hits)
+
+		store(cache, "4.jpg")
+		stats = cache.Stats()
+		assert.Equal(t, 2, stats.Entries)
+		assert.Equal(t, int64(10), stats.Size)
+		assert.True(t, exists(cache, "4.jpg"))
+	})
+
+	t.Run("scan", func(t *testing.T) {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "d41d8cd98f00b204e9800998ecf8427e"), []byte("legacy"), 0600))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "d41d8cd98f00b204e9800998ecf8427e-1-1"), []byte("legacy"), 0600))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, ".d41d8cd98f00b204e9800998ecf8427e-thumbnail-1-1.123"), []byte("tmp"), 0600))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "unknown"), []byte("unknown"), 0600))
+
+		cache, err := NewDiskCache(dir, 0, 0)
+		require.NoError(t, err)
+		assert.Equal(t, 2, cache.Stats().Entries)
+
+		fis, err := ioutil.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Len(t, fis, 3)
+	})
+}
+
+func TestDiskCacheRemoveOrphans(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	pwd, err := os.Getwd()
+	require.NoError(t, err)
+	source, err := NewDiskSource(filepath.Join(pwd, "fixtures"), []string{".jpg"})
+	require.NoError(t, err)
+
+	cache, err := NewDiskCache(dir, 0, 0)
+	require.NoError(t, err)
+
+	src, err := os.Stat("fixtures/album1/test.jpg")
+	require.NoError(t, err)
+
+	for _, image := range []string{"test.jpg", "removed.jpg"} {
+		thumb, err := cache.StoreThumbnail("album1", image, "thumbnail", src, strings.NewReader("thumb"))
+		require.NoError(t, err)
+		thumb.Close()
+	}
+
+	removed, err := cache.RemoveOrphans(source)
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	assert.Equal(t, 1, cache.Stats().Entries)
+
+	thumb, _ := cache.Thumbnail("album1", "test.jpg", "thumbnail", src)
+	require.NotNil(t, thumb)
+	thumb.Close()
+
+	fis, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, fis, 1)
 }
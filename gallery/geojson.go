@@ -0,0 +1,54 @@
+package gallery
+
+import "time"
+
+// FeatureCollection implements GeoJSON collection of image locations.
+type FeatureCollection struct {
+	Type     string    `json:"type"`
+	Features []Feature `json:"features"`
+}
+
+// Feature implements GeoJSON point feature of a single image.
+type Feature struct {
+	Type       string            `json:"type"`
+	Geometry   Geometry          `json:"geometry"`
+	Properties FeatureProperties `json:"properties"`
+}
+
+// Geometry implements GeoJSON point geometry, coordinates are stored
+// as longitude and latitude.
+type Geometry struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+// FeatureProperties stores image metadata of a feature.
+type FeatureProperties struct {
+	Album     string    `json:"album"`
+	Name      string    `json:"name"`
+	Path      string    `json:"path"`
+	TakenAt   time.Time `json:"taken_at"`
+	Thumbnail string    `json:"thumbnail"`
+}
+
+// NewFeatureCollection returns an empty FeatureCollection.
+func NewFeatureCollection() *FeatureCollection {
+	return &FeatureCollection{Type: "FeatureCollection", Features: make([]Feature, 0)}
+}
+
+// Add appends image of an album to a collection if image has a
+// location.
+func (fc *FeatureCollection) Add(album string, image Image, thumbnail string) {
+	if image.Location == nil {
+		return
+	}
+
+	fc.Features = append(fc.Features, Feature{
+		Type: "Feature",
+		Geometry: Geometry{
+			Type:        "Point",
+			Coordinates: [2]float64{image.Location.Longitude, image.Location.Latitude},
+		},
+		Properties: FeatureProperties{album, image.Name, image.Path, image.TakenAt, thumbnail},
+	})
+}
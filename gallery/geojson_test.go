@@ -0,0 +1,204 @@
+package gallery
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"image"
+	"image/jpeg"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ap4y/cloud/contextkey"
+	"github.com/ap4y/cloud/module"
+	"github.com/ap4y/cloud/share"
+)
+
+func TestGPSLocation(t *testing.T) {
+	x, err := EXIF(bytes.NewReader(gpsJPEG(t, -36.8485, 174.7633)))
+	require.NoError(t, err)
+
+	loc := GPSLocation(x)
+	require.NotNil(t, loc)
+	assert.InDelta(t, -36.8485, loc.Latitude, 0.0001)
+	assert.InDelta(t, 174.7633, loc.Longitude, 0.0001)
+
+	file, err := os.Open("fixtures/album1/test.jpg")
+	require.NoError(t, err)
+	defer file.Close()
+
+	x, err = EXIF(file)
+	require.NoError(t, err)
+	assert.Nil(t, GPSLocation(x))
+}
+
+func TestGalleryAPILocations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gallery")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	images := map[string][]byte{
+		"2023/auckland.jpg":      gpsJPEG(t, -36.8485, 174.7633),
+		"2023/japan/tokyo.jpg":   gpsJPEG(t, 35.6762, 139.6503),
+		"2023/japan/unknown.jpg": gpsJPEG(t, math.NaN(), 0),
+	}
+	for name, data := range images {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0755))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), data, 0644))
+	}
+
+	src, err := NewDiskSource(dir, []string{".jpg"})
+	require.NoError(t, err)
+
+	cacheDir, err := ioutil.TempDir("", "cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+
+	cache, err := NewDiskCache(cacheDir, 0, 0)
+	require.NoError(t, err)
+
+	thumbnailer, err := NewThumbnailer(src, cache, nil, 0)
+	require.NoError(t, err)
+	api := NewGalleryAPI(src, cache, thumbnailer, NewIndexer(src, thumbnailer))
+
+	fetch := func(t *testing.T, path string, s *share.Share) *FeatureCollection {
+		t.Helper()
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://cloud.api"+path, nil)
+		if s != nil {
+			req = req.WithContext(context.WithValue(req.Context(), contextkey.ShareCtxKey, s))
+		}
+		api.ServeHTTP(w, req)
+
+		resp := w.Result()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		fc := &FeatureCollection{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(fc))
+		assert.Equal(t, "FeatureCollection", fc.Type)
+		return fc
+	}
+
+	t.Run("listLocations", func(t *testing.T) {
+		fc := fetch(t, "/locations", nil)
+		require.Len(t, fc.Features, 2)
+
+		feature := fc.Features[0]
+		assert.Equal(t, "Point", feature.Geometry.Type)
+		assert.InDelta(t, 174.7633, feature.Geometry.Coordinates[0], 0.0001)
+		assert.InDelta(t, -36.8485, feature.Geometry.Coordinates[1], 0.0001)
+		assert.Equal(t, "2023", feature.Properties.Album)
+		assert.Equal(t, "auckland.jpg", feature.Properties.Path)
+		assert.Equal(t, "/2023/thumbnail/auckland.jpg?rendition=thumbnail", feature.Properties.Thumbnail)
+
+		assert.Equal(t, "2023/japan", fc.Features[1].Properties.Album)
+	})
+
+	t.Run("listLocations/with share", func(t *testing.T) {
+		s := &share.Share{Type: module.Gallery, Name: "2023/japan", Items: []string{"tokyo.jpg"}, KeepMetadata: true}
+		fc := fetch(t, "/locations", s)
+		require.Len(t, fc.Features, 1)
+		assert.Equal(t, "tokyo.jpg", fc.Features[0].Properties.Path)
+
+		s = &share.Share{Type: module.Gallery, Name: "2023", Items: []string{"foo.jpg"}, KeepMetadata: true}
+		fc = fetch(t, "/locations", s)
+		require.Len(t, fc.Features, 0)
+
+		s.Nested = true
+		fc = fetch(t, "/locations", s)
+		require.Len(t, fc.Features, 1)
+	})
+
+	t.Run("listAlbumLocations", func(t *testing.T) {
+		fc := fetch(t, "/2023/japan/locations", nil)
+		require.Len(t, fc.Features, 1)
+		assert.Equal(t, "/2023/japan/thumbnail/tokyo.jpg?rendition=thumbnail", fc.Features[0].Properties.Thumbnail)
+	})
+
+	t.Run("listAlbumLocations/with share", func(t *testing.T) {
+		s := &share.Share{Type: module.Gallery, Name: "2023", Items: []string{"auckland.jpg"}, KeepMetadata: true}
+		fc := fetch(t, "/2023/locations", s)
+		require.Len(t, fc.Features, 1)
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://cloud.api/2023/japan/locations", nil)
+		api.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), contextkey.ShareCtxKey, s)))
+		require.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+	})
+
+	t.Run("private share", func(t *testing.T) {
+		s := &share.Share{Type: module.Gallery, Name: "2023", Items: []string{"auckland.jpg"}}
+		for _, path := range []string{"/locations", "/2023/locations"} {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "http://cloud.api"+path, nil)
+			api.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), contextkey.ShareCtxKey, s)))
+			assert.Equal(t, http.StatusNotFound, w.Result().StatusCode, path)
+		}
+	})
+}
+
+// gpsJPEG returns JPEG image with EXIF GPS coordinates, NaN latitude
+// omits coordinates.
+func gpsJPEG(t *testing.T, lat, long float64) []byte {
+	t.Helper()
+
+	buf := bytes.NewBuffer([]byte{})
+	require.NoError(t, jpeg.Encode(buf, image.NewGray(image.Rect(0, 0, 4, 4)), nil))
+	if math.IsNaN(lat) {
+		return buf.Bytes()
+	}
+
+	latRef, longRef := "N", "E"
+	if lat < 0 {
+		latRef, lat = "S", -lat
+	}
+	if long < 0 {
+		longRef, long = "W", -long
+	}
+
+	tiff := bytes.NewBuffer([]byte{})
+	write := func(v interface{}) { binary.Write(tiff, binary.LittleEndian, v) } // nolint: errcheck
+	entry := func(tag, typ uint16, count, value uint32) { write(tag); write(typ); write(count); write(value) }
+	ref := func(s string) uint32 { return uint32(s[0]) }
+	rationals := func(v float64) {
+		deg, min := math.Floor(v), math.Floor(math.Mod(v*60, 60))
+		sec := (v - deg - min/60) * 3600
+		write([]uint32{uint32(deg), 1, uint32(min), 1, uint32(sec * 10000), 10000})
+	}
+
+	tiff.WriteString("II")
+	write(uint16(0x2a))
+	write(uint32(8))
+	// IFD0 with GPS IFD pointer.
+	write(uint16(1))
+	entry(0x8825, 4, 1, 26)
+	write(uint32(0))
+	// GPS IFD.
+	write(uint16(4))
+	entry(0x0001, 2, 2, ref(latRef))
+	entry(0x0002, 5, 3, 80)
+	entry(0x0003, 2, 2, ref(longRef))
+	entry(0x0004, 5, 3, 104)
+	write(uint32(0))
+	rationals(lat)
+	rationals(long)
+
+	app1 := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	size := len(app1) + 2
+
+	data := buf.Bytes()
+	out := append([]byte{}, data[:2]...)
+	out = append(out, 0xff, 0xe1, byte(size>>8), byte(size))
+	out = append(out, app1...)
+	return append(out, data[2:]...)
+}
@@ -4,29 +4,159 @@ import (
 	"bytes"
 	"fmt"
 	"image"
+	"image/draw"
 	"image/jpeg"
 	"io"
+	"io/ioutil"
 
 	"github.com/nfnt/resize"
 	"github.com/rwcarlsen/goexif/exif"
 )
 
-// Thumbnail returns thubmnail from a reader constrained by maxHeight.
+// Thumbnail returns thubmnail from a reader constrained by
+// maxHeight. EXIF orientation is applied, smaller images are not
+// upscaled.
 func Thumbnail(r io.Reader, maxHeight uint) (io.Reader, error) {
-	img, _, err := image.Decode(r)
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read: %s", err)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
 	if err != nil {
 		return nil, fmt.Errorf("decode: %s", err)
 	}
 
-	thumb := resize.Resize(0, maxHeight, img, resize.Lanczos3)
+	// Displayed height is constrained, so transposing orientations
+	// are constrained by the stored width.
+	o := orientation(data)
+	width, height, size := uint(0), maxHeight, img.Bounds().Dy()
+	if o >= 5 {
+		width, height, size = maxHeight, 0, img.Bounds().Dx()
+	}
+
+	thumb := img
+	if uint(size) > maxHeight {
+		thumb = resize.Resize(width, height, img, resize.Lanczos3)
+	}
+
 	out := bytes.NewBuffer([]byte{})
-	if err := jpeg.Encode(out, thumb, nil); err != nil {
+	if err := jpeg.Encode(out, orient(thumb, o), nil); err != nil {
 		return nil, fmt.Errorf("encode: %s", err)
 	}
 
 	return out, nil
 }
 
+// Display returns image from a reader with applied EXIF
+// orientation. Reader itself is returned if no transform is
+// necessary, otherwise image is re-encoded as JPEG.
+func Display(r io.ReadSeeker) (io.ReadSeeker, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read: %s", err)
+	}
+
+	o := orientation(data)
+	if o < 2 || o > 8 {
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("seek: %s", err)
+		}
+
+		return r, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode: %s", err)
+	}
+
+	out := bytes.NewBuffer([]byte{})
+	if err := jpeg.Encode(out, orient(img, o), &jpeg.Options{Quality: 95}); err != nil {
+		return nil, fmt.Errorf("encode: %s", err)
+	}
+
+	return bytes.NewReader(out.Bytes()), nil
+}
+
+// GPSLocation returns GPS coordinates from exif metadata, nil is
+// returned if coordinates are missing.
+func GPSLocation(x *exif.Exif) *Location {
+	lat, long, err := x.LatLong()
+	if err != nil {
+		return nil
+	}
+
+	return &Location{lat, long}
+}
+
+// orientation returns EXIF orientation of an image, 1 is returned
+// for images without orientation tag.
+func orientation(data []byte) int {
+	x, err := exif.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 1
+	}
+
+	tag, err := x.Get(exif.Orientation)
+	if err != nil {
+		return 1
+	}
+
+	o, err := tag.Int(0)
+	if err != nil {
+		return 1
+	}
+
+	return o
+}
+
+// orient applies one of the eight EXIF orientation transforms to an
+// image so it's displayed upright.
+func orient(img image.Image, o int) image.Image {
+	if o < 2 || o > 8 {
+		return img
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	src := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+
+	dstRect := image.Rect(0, 0, w, h)
+	if o >= 5 {
+		dstRect = image.Rect(0, 0, h, w)
+	}
+	dst := image.NewNRGBA(dstRect)
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch o {
+			case 2: // flip horizontal
+				dx, dy = w-1-x, y
+			case 3: // rotate 180
+				dx, dy = w-1-x, h-1-y
+			case 4: // flip vertical
+				dx, dy = x, h-1-y
+			case 5: // transpose
+				dx, dy = y, x
+			case 6: // rotate 90 clockwise
+				dx, dy = h-1-y, x
+			case 7: // transverse
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotate 90 counter-clockwise
+				dx, dy = y, w-1-x
+			}
+
+			si, di := src.PixOffset(x, y), dst.PixOffset(dx, dy)
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+
+	return dst
+}
+
 // EXIF returns exif metadata from a reader.
 func EXIF(r io.Reader) (*exif.Exif, error) {
 	x, err := exif.Decode(r)
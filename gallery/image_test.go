@@ -1,7 +1,11 @@
 package gallery
 
 import (
+	"bytes"
+	"fmt"
 	"image"
+	"image/color"
+	"image/jpeg"
 	"os"
 	"testing"
 
@@ -35,3 +39,96 @@ func TestEXIF(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, "2000", tag.String())
 }
+
+func TestOrient(t *testing.T) {
+	// 3x2 image with a marked top-left pixel.
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	img.Set(0, 0, color.NRGBA{255, 0, 0, 255})
+
+	tcs := []struct {
+		orientation   int
+		width, height int
+		x, y          int
+	}{
+		{1, 3, 2, 0, 0},
+		{2, 3, 2, 2, 0},
+		{3, 3, 2, 2, 1},
+		{4, 3, 2, 0, 1},
+		{5, 2, 3, 0, 0},
+		{6, 2, 3, 1, 0},
+		{7, 2, 3, 1, 2},
+		{8, 2, 3, 0, 2},
+	}
+
+	for _, tc := range tcs {
+		t.Run(fmt.Sprint(tc.orientation), func(t *testing.T) {
+			res := orient(img, tc.orientation)
+			assert.Equal(t, tc.width, res.Bounds().Dx())
+			assert.Equal(t, tc.height, res.Bounds().Dy())
+
+			r, _, _, a := res.At(tc.x, tc.y).RGBA()
+			assert.Equal(t, uint32(0xffff), r)
+			assert.Equal(t, uint32(0xffff), a)
+		})
+	}
+}
+
+func TestThumbnailOrientation(t *testing.T) {
+	for o := 1; o <= 8; o++ {
+		t.Run(fmt.Sprint(o), func(t *testing.T) {
+			thumb, err := Thumbnail(bytes.NewReader(orientedJPEG(t, 400, 200, o)), 100)
+			require.NoError(t, err)
+
+			cfg, _, err := image.DecodeConfig(thumb)
+			require.NoError(t, err)
+			assert.Equal(t, 100, cfg.Height)
+			if o >= 5 {
+				assert.Equal(t, 50, cfg.Width)
+			} else {
+				assert.Equal(t, 200, cfg.Width)
+			}
+		})
+	}
+}
+
+func TestDisplay(t *testing.T) {
+	t.Run("upright", func(t *testing.T) {
+		src := bytes.NewReader(orientedJPEG(t, 40, 30, 1))
+		res, err := Display(src)
+		require.NoError(t, err)
+		assert.Equal(t, src, res)
+	})
+
+	t.Run("rotated", func(t *testing.T) {
+		res, err := Display(bytes.NewReader(orientedJPEG(t, 40, 30, 6)))
+		require.NoError(t, err)
+
+		cfg, _, err := image.DecodeConfig(res)
+		require.NoError(t, err)
+		assert.Equal(t, 30, cfg.Width)
+		assert.Equal(t, 40, cfg.Height)
+	})
+}
+
+// orientedJPEG returns JPEG image with EXIF orientation tag.
+func orientedJPEG(t *testing.T, width, height, orientation int) []byte {
+	t.Helper()
+
+	buf := bytes.NewBuffer([]byte{})
+	require.NoError(t, jpeg.Encode(buf, image.NewGray(image.Rect(0, 0, width, height)), nil))
+
+	tiff := []byte{
+		'I', 'I', 0x2a, 0x00, 0x08, 0x00, 0x00, 0x00, // header
+		0x01, 0x00, // entries count
+		0x12, 0x01, 0x03, 0x00, 0x01, 0x00, 0x00, 0x00, byte(orientation), 0x00, 0x00, 0x00, // orientation
+		0x00, 0x00, 0x00, 0x00, // next IFD
+	}
+	app1 := append([]byte("Exif\x00\x00"), tiff...)
+	size := len(app1) + 2
+
+	data := buf.Bytes()
+	out := append([]byte{}, data[:2]...)
+	out = append(out, 0xff, 0xe1, byte(size>>8), byte(size))
+	out = append(out, app1...)
+	return append(out, data[2:]...)
+}
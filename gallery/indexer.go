@@ -0,0 +1,146 @@
+package gallery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ap4y/cloud/niltime"
+)
+
+// ErrIndexRunning is returned when index is requested while previous
+// one is still running.
+var ErrIndexRunning = errors.New("index is already running")
+
+// IndexProgress stores progress of the last thumbnails
+// pre-generation.
+type IndexProgress struct {
+	Running    bool         `json:"running"`
+	Album      string       `json:"album"`
+	Total      int          `json:"total"`
+	Done       int          `json:"done"`
+	Failed     int          `json:"failed"`
+	StartedAt  niltime.Time `json:"started_at"`
+	FinishedAt niltime.Time `json:"finished_at"`
+}
+
+// Indexer pre-generates thumbnail renditions for source images in
+// background. Images are processed one at a time using workers of the
+// thumbnailer, so index occupies at most one worker and on-demand
+// thumbnails wait for it when thumbnailer has a single worker.
+type Indexer struct {
+	source      Source
+	thumbnailer *Thumbnailer
+
+	mu       sync.Mutex
+	progress IndexProgress
+}
+
+// NewIndexer returns a new Indexer that generates thumbnails using
+// thumbnailer.
+func NewIndexer(source Source, thumbnailer *Thumbnailer) *Indexer {
+	return &Indexer{source: source, thumbnailer: thumbnailer}
+}
+
+// Index pre-generates thumbnails for images of provided albums, all
+// albums are indexed if none provided. Failed images are skipped,
+// index is interrupted when ctx is cancelled.
+func (idx *Indexer) Index(ctx context.Context, albums ...string) error {
+	idx.mu.Lock()
+	if idx.progress.Running {
+		idx.mu.Unlock()
+		return ErrIndexRunning
+	}
+	idx.progress = IndexProgress{Running: true, StartedAt: niltime.Time{Time: time.Now()}}
+	idx.mu.Unlock()
+
+	defer func() {
+		idx.mu.Lock()
+		idx.progress.Running = false
+		idx.progress.Album = ""
+		idx.progress.FinishedAt = niltime.Time{Time: time.Now()}
+		idx.mu.Unlock()
+	}()
+
+	if len(albums) == 0 {
+		all, err := idx.source.Albums()
+		if err != nil {
+			return fmt.Errorf("albums: %s", err)
+		}
+
+		for _, album := range all {
+			albums = append(albums, album.Name)
+		}
+	}
+
+	images := make(map[string][]Image, len(albums))
+	total := 0
+	for _, album := range albums {
+		albumImages, err := idx.source.Images(album)
+		if err != nil {
+			return fmt.Errorf("images: %s", err)
+		}
+
+		images[album] = albumImages
+		total += len(albumImages)
+	}
+
+	idx.update(func(p *IndexProgress) { p.Total = total })
+
+	for _, album := range albums {
+		idx.update(func(p *IndexProgress) { p.Album = album })
+
+		for _, image := range images[album] {
+			err := idx.generate(ctx, album, image.Path)
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			if err != nil {
+				log.Printf("failed to index %s/%s: %s", album, image.Path, err)
+			}
+
+			idx.update(func(p *IndexProgress) {
+				p.Done++
+				if err != nil {
+					p.Failed++
+				}
+			})
+		}
+	}
+
+	return nil
+}
+
+// Progress returns progress of the running or the last finished
+// index.
+func (idx *Indexer) Progress() IndexProgress {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	return idx.progress
+}
+
+func (idx *Indexer) generate(ctx context.Context, album, image string) error {
+	for _, rendition := range idx.thumbnailer.Renditions() {
+		thumb, _, err := idx.thumbnailer.Thumbnail(ctx, album, image, rendition)
+		if err != nil {
+			return err
+		}
+
+		if err := thumb.Close(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (idx *Indexer) update(fn func(p *IndexProgress)) {
+	idx.mu.Lock()
+	fn(&idx.progress)
+	idx.mu.Unlock()
+}
@@ -0,0 +1,64 @@
+package gallery
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndexer(t *testing.T) {
+	pwd, err := os.Getwd()
+	require.NoError(t, err)
+
+	src, err := NewDiskSource(filepath.Join(pwd, "fixtures"), []string{".jpg"})
+	require.NoError(t, err)
+
+	dir, err := ioutil.TempDir("", "cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cache, err := NewDiskCache(dir, 0, 0)
+	require.NoError(t, err)
+
+	thumbnailer, err := NewThumbnailer(src, cache, nil, 1)
+	require.NoError(t, err)
+	indexer := NewIndexer(src, thumbnailer)
+
+	t.Run("album", func(t *testing.T) {
+		require.NoError(t, indexer.Index(context.Background(), "album1"))
+
+		progress := indexer.Progress()
+		assert.False(t, progress.Running)
+		assert.Equal(t, 1, progress.Total)
+		assert.Equal(t, 1, progress.Done)
+		assert.Equal(t, 0, progress.Failed)
+		assert.False(t, progress.FinishedAt.IsZero())
+		assert.Equal(t, 1, cache.Stats().Entries)
+	})
+
+	t.Run("all albums", func(t *testing.T) {
+		require.NoError(t, indexer.Index(context.Background()))
+
+		progress := indexer.Progress()
+		assert.Equal(t, 2, progress.Total)
+		assert.Equal(t, 2, progress.Done)
+		assert.Equal(t, 2, cache.Stats().Entries)
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		assert.Equal(t, context.Canceled, indexer.Index(ctx))
+		assert.Equal(t, 0, indexer.Progress().Done)
+	})
+
+	t.Run("missing album", func(t *testing.T) {
+		require.Error(t, indexer.Index(context.Background(), "missing"))
+	})
+}
@@ -0,0 +1,39 @@
+package gallery
+
+import (
+	"os"
+	"time"
+)
+
+// maxMetadataCacheEntries defines how many image metadata entries
+// are kept in memory.
+const maxMetadataCacheEntries = 100000
+
+// imageMetadata stores metadata parsed from the image EXIF.
+type imageMetadata struct {
+	takenAt  time.Time
+	location *Location
+}
+
+// metadata returns EXIF capture time and location of an image,
+// modification time is used for images without capture time.
+func (ds *diskSource) metadata(diskPath string, fi os.FileInfo) imageMetadata {
+	if meta, ok := ds.metadataCache.Get(diskPath, fi); ok {
+		return meta.(imageMetadata)
+	}
+
+	meta := imageMetadata{takenAt: fi.ModTime()}
+	if file, err := os.Open(diskPath); err == nil {
+		if x, err := EXIF(file); err == nil {
+			if dt, err := x.DateTime(); err == nil {
+				meta.takenAt = dt
+			}
+
+			meta.location = GPSLocation(x)
+		}
+		file.Close()
+	}
+
+	ds.metadataCache.Set(diskPath, fi, meta)
+	return meta
+}
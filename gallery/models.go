@@ -2,16 +2,34 @@ package gallery
 
 import "time"
 
-// Album stores album metadata.
+// Album stores album metadata. Albums are identified by a path
+// relative to the source, Parent and Children refer to the albums
+// one level up and down in the hierarchy. Cover is a path of the
+// first image in an album or it's nested albums.
 type Album struct {
 	Name       string    `json:"name"`
 	ModTime    time.Time `json:"updated_at"`
 	ItemsCount int       `json:"items_count"`
+	Parent     string    `json:"parent,omitempty"`
+	Children   []string  `json:"children"`
+	Cover      string    `json:"cover,omitempty"`
 }
 
-// Image stores image metadata.
+// Image stores image metadata. TakenAt is EXIF capture time or
+// modification time for images without one, Location is set only
+// for images with GPS coordinates. Renditions maps available
+// thumbnail renditions to their URLs.
 type Image struct {
-	Name    string    `json:"name"`
-	Path    string    `json:"path"`
-	ModTime time.Time `json:"updated_at"`
+	Name       string            `json:"name"`
+	Path       string            `json:"path"`
+	ModTime    time.Time         `json:"updated_at"`
+	TakenAt    time.Time         `json:"taken_at"`
+	Location   *Location         `json:"location,omitempty"`
+	Renditions map[string]string `json:"renditions,omitempty"`
+}
+
+// Location stores GPS coordinates of an image.
+type Location struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
 }
@@ -0,0 +1,171 @@
+package gallery
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+var (
+	jpegSOI      = []byte{0xff, 0xd8}
+	jpegMPF      = []byte("MPF\x00")
+	pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+	// strippedJPEGMarkers defines JPEG segments with EXIF, XMP,
+	// IPTC metadata and comments.
+	strippedJPEGMarkers = map[byte]bool{0xe1: true, 0xed: true, 0xfe: true}
+	// strippedPNGChunks defines PNG chunks with EXIF and text
+	// metadata.
+	strippedPNGChunks = map[string]bool{"eXIf": true, "tEXt": true, "zTXt": true, "iTXt": true}
+)
+
+// errUnsupportedFormat is returned for images that can't be
+// stripped.
+var errUnsupportedFormat = errors.New("unsupported image format")
+
+// Sanitize returns image from a reader without EXIF and other
+// metadata. EXIF orientation is applied to image pixels since it's
+// lost after stripping.
+func Sanitize(r io.ReadSeeker) (io.ReadSeeker, error) {
+	img, err := Display(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Re-encoded images have no metadata.
+	if img != r {
+		return img, nil
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read: %s", err)
+	}
+
+	stripped, err := StripMetadata(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.NewReader(stripped), nil
+}
+
+// StripMetadata removes metadata segments from JPEG and metadata
+// chunks from PNG images without re-encoding.
+func StripMetadata(data []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, jpegSOI):
+		return stripJPEG(data)
+	case bytes.HasPrefix(data, pngSignature):
+		return stripPNG(data)
+	}
+
+	return nil, errUnsupportedFormat
+}
+
+func stripJPEG(data []byte) ([]byte, error) {
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(jpegSOI)
+
+	pos := len(jpegSOI)
+	for {
+		if pos+2 > len(data) || data[pos] != 0xff {
+			return nil, errors.New("malformed jpeg segment")
+		}
+
+		marker := data[pos+1]
+		if marker == 0xff {
+			// Fill byte before a marker.
+			pos++
+			continue
+		}
+
+		// Data after the end of image (e.g. MPF secondary images
+		// or vendor metadata) is dropped.
+		if marker == 0xd9 {
+			out.Write(data[pos : pos+2])
+			return out.Bytes(), nil
+		}
+
+		if pos+4 > len(data) {
+			return nil, errors.New("malformed jpeg segment")
+		}
+
+		end := pos + 2 + int(binary.BigEndian.Uint16(data[pos+2:pos+4]))
+		if end > len(data) {
+			return nil, errors.New("malformed jpeg segment")
+		}
+
+		// Entropy coded data follows start of scan and is copied
+		// along with the segment.
+		if marker == 0xda {
+			end = jpegScanEnd(data, end)
+		}
+
+		if !isStrippedJPEGSegment(marker, data[pos+4:end]) {
+			out.Write(data[pos:end])
+		}
+		pos = end
+
+		// Truncated images without end of image are kept as is.
+		if pos == len(data) && marker == 0xda {
+			return out.Bytes(), nil
+		}
+	}
+}
+
+// jpegScanEnd returns position of the first marker after entropy
+// coded data starting at pos. Stuffed zero bytes and restart markers
+// are part of the data.
+func jpegScanEnd(data []byte, pos int) int {
+	for ; pos+1 < len(data); pos++ {
+		if data[pos] != 0xff {
+			continue
+		}
+
+		if next := data[pos+1]; next != 0x00 && (next < 0xd0 || next > 0xd7) {
+			return pos
+		}
+	}
+
+	return len(data)
+}
+
+// isStrippedJPEGSegment returns true for segments with metadata,
+// APP2 segments are only stripped for multi-picture format since
+// they also store colour profiles.
+func isStrippedJPEGSegment(marker byte, payload []byte) bool {
+	if marker == 0xe2 {
+		return bytes.HasPrefix(payload, jpegMPF)
+	}
+
+	return strippedJPEGMarkers[marker]
+}
+
+func stripPNG(data []byte) ([]byte, error) {
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(pngSignature)
+
+	pos := len(pngSignature)
+	for pos < len(data) {
+		if pos+8 > len(data) {
+			return nil, errors.New("malformed png chunk")
+		}
+
+		// Chunk consists of length, type, data and crc.
+		end := pos + 12 + int(binary.BigEndian.Uint32(data[pos:pos+4]))
+		if end > len(data) || end < pos {
+			return nil, errors.New("malformed png chunk")
+		}
+
+		if !strippedPNGChunks[string(data[pos+4:pos+8])] {
+			out.Write(data[pos:end])
+		}
+		pos = end
+	}
+
+	return out.Bytes(), nil
+}
@@ -0,0 +1,98 @@
+package gallery
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSanitize(t *testing.T) {
+	t.Run("jpeg", func(t *testing.T) {
+		src := gpsJPEG(t, -36.8485, 174.7633)
+		x, err := EXIF(bytes.NewReader(src))
+		require.NoError(t, err)
+		require.NotNil(t, GPSLocation(x))
+
+		res, err := Sanitize(bytes.NewReader(src))
+		require.NoError(t, err)
+
+		data, err := ioutil.ReadAll(res)
+		require.NoError(t, err)
+		_, err = EXIF(bytes.NewReader(data))
+		assert.Error(t, err)
+
+		_, _, err = image.Decode(bytes.NewReader(data))
+		require.NoError(t, err)
+	})
+
+	t.Run("rotated jpeg", func(t *testing.T) {
+		res, err := Sanitize(bytes.NewReader(orientedJPEG(t, 40, 30, 6)))
+		require.NoError(t, err)
+
+		data, err := ioutil.ReadAll(res)
+		require.NoError(t, err)
+		_, err = EXIF(bytes.NewReader(data))
+		assert.Error(t, err)
+
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+		require.NoError(t, err)
+		assert.Equal(t, 30, cfg.Width)
+		assert.Equal(t, 40, cfg.Height)
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		_, err := Sanitize(bytes.NewReader([]byte("GIF89a")))
+		assert.Error(t, err)
+	})
+}
+
+func TestStripMetadata(t *testing.T) {
+	t.Run("png", func(t *testing.T) {
+		buf := bytes.NewBuffer([]byte{})
+		require.NoError(t, png.Encode(buf, image.NewGray(image.Rect(0, 0, 4, 4))))
+		src := buf.Bytes()
+
+		// Insert text chunk after IHDR, crc is not validated.
+		ihdrEnd := len(pngSignature) + 12 + 13
+		text := append([]byte{0, 0, 0, 7}, []byte("tEXtfoo\x00bar0000")...)
+		data := append(append(append([]byte{}, src[:ihdrEnd]...), text...), src[ihdrEnd:]...)
+
+		stripped, err := StripMetadata(data)
+		require.NoError(t, err)
+		assert.Equal(t, src, stripped)
+		assert.NotContains(t, string(stripped), "tEXt")
+	})
+
+	t.Run("jpeg/trailing data", func(t *testing.T) {
+		buf := bytes.NewBuffer([]byte{})
+		require.NoError(t, jpeg.Encode(buf, image.NewGray(image.Rect(0, 0, 4, 4)), nil))
+		src := buf.Bytes()
+
+		// Insert MPF segment after SOI and a secondary image with
+		// GPS EXIF after EOI.
+		mpf := append([]byte{0xff, 0xe2, 0, 8}, []byte("MPF\x00II")...)
+		icc := append([]byte{0xff, 0xe2, 0, 8}, []byte("ICC_\x00\x00")...)
+		data := append(append(append([]byte{}, src[:2]...), mpf...), icc...)
+		data = append(append(data, src[2:]...), gpsJPEG(t, -36.8485, 174.7633)...)
+
+		stripped, err := StripMetadata(data)
+		require.NoError(t, err)
+		assert.Equal(t, append(append(append([]byte{}, src[:2]...), icc...), src[2:]...), stripped)
+
+		_, err = EXIF(bytes.NewReader(stripped))
+		assert.Error(t, err)
+		_, _, err = image.Decode(bytes.NewReader(stripped))
+		require.NoError(t, err)
+	})
+
+	t.Run("malformed jpeg", func(t *testing.T) {
+		_, err := StripMetadata([]byte{0xff, 0xd8, 0xff, 0xe1, 0xff, 0xff})
+		assert.Error(t, err)
+	})
+}
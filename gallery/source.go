@@ -5,17 +5,24 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 
+	"github.com/ap4y/cloud/internal/filecache"
 	"github.com/ap4y/cloud/internal/pathutil"
 )
 
 // Source provides album and images metadata.
 type Source interface {
-	// Albums returns list of all albums in a Source.
+	// Albums returns list of all albums in a Source, parent
+	// albums precede nested ones.
 	Albums() ([]Album, error)
-	// Images returns images metadata for a given album.
+	// Album returns metadata of a given album.
+	Album(name string) (Album, error)
+	// Images returns images metadata for a given album sorted by
+	// capture time.
 	Images(album string) ([]Image, error)
 	// Image returns image file for a given image path.
 	Image(ablum, image string) (*os.File, error)
@@ -24,6 +31,7 @@ type Source interface {
 type diskSource struct {
 	basePath      string
 	imgExtensions map[string]bool
+	metadataCache *filecache.Cache
 }
 
 // NewDiskSource returns disk based source for a provided base dir
@@ -47,34 +55,159 @@ func NewDiskSource(basePath string, imgExtensions []string) (Source, error) {
 		exts[strings.ToLower(ext)] = true
 	}
 
-	return &diskSource{basePath, exts}, nil
+	return &diskSource{basePath, exts, filecache.New(maxMetadataCacheEntries)}, nil
 }
 
 func (ds *diskSource) Albums() ([]Album, error) {
-	fis, err := ioutil.ReadDir(ds.basePath)
+	albums := make([]Album, 0)
+	index := map[string]int{}
+
+	err := filepath.Walk(ds.basePath, func(diskPath string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if diskPath == ds.basePath {
+				return err
+			}
+
+			return nil
+		}
+
+		if !fi.IsDir() || diskPath == ds.basePath {
+			return nil
+		}
+
+		if strings.HasPrefix(fi.Name(), ".") {
+			return filepath.SkipDir
+		}
+
+		rel, err := filepath.Rel(ds.basePath, diskPath)
+		if err != nil {
+			return filepath.SkipDir
+		}
+
+		album, err := ds.album(filepath.ToSlash(rel), fi)
+		if err != nil {
+			return filepath.SkipDir
+		}
+
+		if parent, ok := index[album.Parent]; ok {
+			albums[parent].Children = append(albums[parent].Children, album.Name)
+		}
+
+		index[album.Name] = len(albums)
+		albums = append(albums, album)
+		return nil
+	})
+
 	if err != nil {
 		return nil, fmt.Errorf("scan: %s", err)
 	}
 
-	albums := make([]Album, 0, len(fis))
-	for _, fi := range fis {
-		images, err := ds.images(fi.Name())
-		if err != nil {
+	// Children are walked after parents, so covers are propagated
+	// from the deepest albums.
+	for i := len(albums) - 1; i >= 0; i-- {
+		if albums[i].Cover != "" {
 			continue
 		}
 
-		albums = append(albums, Album{fi.Name(), fi.ModTime(), len(images)})
+		for _, child := range albums[i].Children {
+			if cover := albums[index[child]].Cover; cover != "" {
+				albums[i].Cover = cover
+				break
+			}
+		}
 	}
 
 	return albums, nil
 }
 
+func (ds *diskSource) Album(name string) (Album, error) {
+	diskPath := pathutil.Join(ds.basePath, name)
+	fi, err := os.Stat(diskPath)
+	if err != nil {
+		return Album{}, fmt.Errorf("stat %s: %s", diskPath, err)
+	}
+
+	if !fi.IsDir() || diskPath == filepath.Clean(ds.basePath) {
+		return Album{}, fmt.Errorf("not an album: %s", name)
+	}
+
+	album, err := ds.album(strings.Trim(filepath.ToSlash(pathutil.Join(name)), "/"), fi)
+	if err != nil {
+		return Album{}, err
+	}
+
+	fis, err := ioutil.ReadDir(diskPath)
+	if err != nil {
+		return Album{}, fmt.Errorf("scan %s: %s", diskPath, err)
+	}
+
+	for _, child := range fis {
+		if child.IsDir() && !strings.HasPrefix(child.Name(), ".") {
+			album.Children = append(album.Children, path.Join(album.Name, child.Name()))
+		}
+	}
+
+	if album.Cover == "" {
+		album.Cover = ds.cover(album.Children)
+	}
+
+	return album, nil
+}
+
+// cover returns path of the first image in provided albums or their
+// nested albums.
+func (ds *diskSource) cover(albums []string) string {
+	for _, name := range albums {
+		child, err := ds.Album(name)
+		if err != nil {
+			continue
+		}
+
+		if child.Cover != "" {
+			return child.Cover
+		}
+	}
+
+	return ""
+}
+
+func (ds *diskSource) album(name string, fi os.FileInfo) (Album, error) {
+	images, err := ds.images(name)
+	if err != nil {
+		return Album{}, err
+	}
+
+	album := Album{Name: name, ModTime: fi.ModTime(), ItemsCount: len(images), Children: []string{}}
+	if parent := path.Dir(name); parent != "." {
+		album.Parent = parent
+	}
+
+	if len(images) > 0 {
+		album.Cover = path.Join(name, images[0].Path)
+	}
+
+	return album, nil
+}
+
 func (ds *diskSource) Images(album string) ([]Image, error) {
 	images, err := ds.images(album)
 	if err != nil {
 		return nil, err
 	}
 
+	for idx := range images {
+		diskPath := pathutil.Join(ds.basePath, album, images[idx].Path)
+		fi, err := os.Stat(diskPath)
+		if err != nil {
+			return nil, fmt.Errorf("stat %s: %s", diskPath, err)
+		}
+
+		meta := ds.metadata(diskPath, fi)
+		images[idx].TakenAt = meta.takenAt
+		images[idx].Location = meta.location
+	}
+
+	sort.SliceStable(images, func(i, j int) bool { return images[i].TakenAt.Before(images[j].TakenAt) })
 	return images, nil
 }
 
@@ -1,6 +1,7 @@
 package gallery
 
 import (
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
@@ -74,3 +75,80 @@ func TestSourceIgnoreExts(t *testing.T) {
 		require.Error(t, err)
 	})
 }
+
+func TestSourceNested(t *testing.T) {
+	dir := nestedFixtures(t)
+	defer os.RemoveAll(dir)
+
+	src, err := NewDiskSource(dir, []string{".jpg"})
+	require.NoError(t, err)
+
+	t.Run("Albums", func(t *testing.T) {
+		albums, err := src.Albums()
+		require.NoError(t, err)
+		require.Len(t, albums, 4)
+
+		assert.Equal(t, "2023", albums[0].Name)
+		assert.Equal(t, "", albums[0].Parent)
+		assert.Equal(t, []string{"2023/japan", "2023/korea"}, albums[0].Children)
+		assert.Equal(t, 0, albums[0].ItemsCount)
+		assert.Equal(t, "2023/japan/test.jpg", albums[0].Cover)
+
+		assert.Equal(t, "2023/japan", albums[1].Name)
+		assert.Equal(t, "2023", albums[1].Parent)
+		assert.Equal(t, []string{"2023/japan/tokyo"}, albums[1].Children)
+		assert.Equal(t, 1, albums[1].ItemsCount)
+
+		assert.Equal(t, "2023/japan/tokyo", albums[2].Name)
+		assert.Equal(t, "2023/japan", albums[2].Parent)
+		assert.Equal(t, "2023/korea", albums[3].Name)
+		assert.Equal(t, "", albums[3].Cover)
+	})
+
+	t.Run("Album", func(t *testing.T) {
+		album, err := src.Album("2023")
+		require.NoError(t, err)
+		assert.Equal(t, "2023", album.Name)
+		assert.Equal(t, []string{"2023/japan", "2023/korea"}, album.Children)
+		assert.Equal(t, "2023/japan/test.jpg", album.Cover)
+
+		album, err = src.Album("2023/japan/")
+		require.NoError(t, err)
+		assert.Equal(t, "2023/japan", album.Name)
+		assert.Equal(t, "2023", album.Parent)
+
+		_, err = src.Album("")
+		require.Error(t, err)
+
+		_, err = src.Album("2023/japan/test.jpg")
+		require.Error(t, err)
+	})
+
+	t.Run("Images", func(t *testing.T) {
+		imgs, err := src.Images("2023/japan/tokyo")
+		require.NoError(t, err)
+		require.Len(t, imgs, 1)
+		assert.Equal(t, "test.jpg", imgs[0].Path)
+	})
+}
+
+// nestedFixtures returns temporary source dir with nested albums.
+func nestedFixtures(t *testing.T) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "gallery")
+	require.NoError(t, err)
+
+	data, err := ioutil.ReadFile("fixtures/album1/test.jpg")
+	require.NoError(t, err)
+
+	for _, album := range []string{"2023/japan/tokyo", "2023/korea", ".hidden"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, album), 0755))
+	}
+
+	for _, image := range []string{"2023/japan/test.jpg", "2023/japan/tokyo/test.jpg", ".hidden/test.jpg"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, image), data, 0644))
+	}
+
+	return dir
+}
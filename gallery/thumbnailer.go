@@ -0,0 +1,207 @@
+package gallery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// ThumbnailHeight defines height of the default rendition.
+	ThumbnailHeight = 200
+	// DefaultRendition defines rendition used for the grid
+	// thumbnails.
+	DefaultRendition = "thumbnail"
+)
+
+// ErrUnknownRendition is returned for renditions that are not
+// configured.
+var ErrUnknownRendition = errors.New("unknown rendition")
+
+type thumbnailCall struct {
+	done chan struct{}
+	path string
+	err  error
+}
+
+// Thumbnailer generates and caches thumbnail renditions for source
+// images. Concurrent requests for the same rendition share a single
+// generation and number of parallel generations is limited, pending
+// generations are queued.
+type Thumbnailer struct {
+	source     Source
+	cache      Cache
+	renditions map[string]uint
+	workers    chan struct{}
+
+	mu    sync.Mutex
+	calls map[string]*thumbnailCall
+}
+
+// NewThumbnailer returns a new Thumbnailer that generates renditions
+// constrained by the mapped max height and runs at most workers
+// generations in parallel. DefaultRendition is added if missing,
+// non-positive workers defaults to number of CPUs.
+func NewThumbnailer(source Source, cache Cache, renditions map[string]uint, workers int) (*Thumbnailer, error) {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	heights := map[string]uint{DefaultRendition: ThumbnailHeight}
+	for name, height := range renditions {
+		if !renditionPattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid rendition name: %s", name)
+		}
+
+		if height == 0 {
+			return nil, fmt.Errorf("invalid rendition height: %s", name)
+		}
+
+		heights[name] = height
+	}
+
+	return &Thumbnailer{
+		source:     source,
+		cache:      cache,
+		renditions: heights,
+		workers:    make(chan struct{}, workers),
+		calls:      map[string]*thumbnailCall{},
+	}, nil
+}
+
+// Renditions returns sorted names of the available renditions.
+func (t *Thumbnailer) Renditions() []string {
+	names := make([]string, 0, len(t.renditions))
+	for name := range t.renditions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Thumbnail returns cached rendition of an image and it's modtime,
+// missing and stale renditions are generated. Queued generation is
+// abandoned when ctx is cancelled.
+func (t *Thumbnailer) Thumbnail(ctx context.Context, gallery, image, rendition string) (*os.File, time.Time, error) {
+	height, ok := t.renditions[rendition]
+	if !ok {
+		return nil, time.Time{}, ErrUnknownRendition
+	}
+
+	file, err := t.source.Image(gallery, image)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer file.Close()
+
+	src, err := file.Stat()
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("stat: %s", err)
+	}
+
+	key := fmt.Sprintf("%s/%s/%s/%d/%d", gallery, image, rendition, src.Size(), src.ModTime().UnixNano())
+	for {
+		if thumb, modTime := t.cache.Thumbnail(gallery, image, rendition, src); thumb != nil {
+			return thumb, modTime, nil
+		}
+
+		call, leader := t.begin(key)
+		if leader {
+			thumb, err := t.generate(ctx, gallery, image, rendition, height, src, file)
+			if thumb != nil {
+				call.path = thumb.Name()
+			}
+			call.err = err
+			t.end(key, call)
+
+			if err == nil {
+				return thumb, thumbModTime(thumb), nil
+			}
+		} else {
+			select {
+			case <-call.done:
+			case <-ctx.Done():
+				return nil, time.Time{}, ctx.Err()
+			}
+		}
+
+		// Generation abandoned by another request is retried.
+		if !leader && isContextErr(call.err) {
+			continue
+		}
+
+		if call.err != nil {
+			return nil, time.Time{}, call.err
+		}
+
+		// Generated thumbnail is opened directly, so cache stats
+		// count it only as a miss.
+		thumb, err := os.Open(call.path)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("thumbnail was evicted: %s/%s@%s", gallery, image, rendition)
+		}
+
+		return thumb, thumbModTime(thumb), nil
+	}
+}
+
+func thumbModTime(thumb *os.File) time.Time {
+	fi, err := thumb.Stat()
+	if err != nil {
+		return time.Now()
+	}
+
+	return fi.ModTime()
+}
+
+func (t *Thumbnailer) begin(key string) (*thumbnailCall, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if call, ok := t.calls[key]; ok {
+		return call, false
+	}
+
+	call := &thumbnailCall{done: make(chan struct{})}
+	t.calls[key] = call
+	return call, true
+}
+
+func (t *Thumbnailer) end(key string, call *thumbnailCall) {
+	t.mu.Lock()
+	delete(t.calls, key)
+	t.mu.Unlock()
+
+	close(call.done)
+}
+
+func (t *Thumbnailer) generate(ctx context.Context, gallery, image, rendition string, height uint, src os.FileInfo, file *os.File) (*os.File, error) {
+	select {
+	case t.workers <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-t.workers }()
+
+	thumbData, err := Thumbnail(file, height)
+	if err != nil {
+		return nil, fmt.Errorf("generate: %s", err)
+	}
+
+	thumb, err := t.cache.StoreThumbnail(gallery, image, rendition, src, thumbData)
+	if err != nil {
+		return nil, fmt.Errorf("store: %s", err)
+	}
+
+	return thumb, nil
+}
+
+func isContextErr(err error) bool {
+	return err == context.Canceled || err == context.DeadlineExceeded
+}
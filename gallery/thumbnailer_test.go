@@ -0,0 +1,122 @@
+package gallery
+
+import (
+	"context"
+	"image"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type countingCache struct {
+	Cache
+	stores int32
+}
+
+func (cc *countingCache) StoreThumbnail(gallery, image, rendition string, src os.FileInfo, r io.Reader) (*os.File, error) {
+	atomic.AddInt32(&cc.stores, 1)
+	return cc.Cache.StoreThumbnail(gallery, image, rendition, src, r)
+}
+
+func TestThumbnailer(t *testing.T) {
+	pwd, err := os.Getwd()
+	require.NoError(t, err)
+
+	src, err := NewDiskSource(filepath.Join(pwd, "fixtures"), []string{".jpg"})
+	require.NoError(t, err)
+
+	dir, err := ioutil.TempDir("", "cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	dc, err := NewDiskCache(dir, 0, 0)
+	require.NoError(t, err)
+	cache := &countingCache{Cache: dc}
+
+	thumbnailer, err := NewThumbnailer(src, cache, map[string]uint{"preview": 1080}, 1)
+	require.NoError(t, err)
+
+	t.Run("concurrent requests", func(t *testing.T) {
+		var wg sync.WaitGroup
+		errs := make(chan error, 10)
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				thumb, _, err := thumbnailer.Thumbnail(context.Background(), "album1", "test.jpg", DefaultRendition)
+				if err != nil {
+					errs <- err
+					return
+				}
+				defer thumb.Close()
+
+				cfg, _, err := image.DecodeConfig(thumb)
+				if err == nil && cfg.Height != ThumbnailHeight {
+					t.Errorf("unexpected thumbnail height %d", cfg.Height)
+				}
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			require.NoError(t, err)
+		}
+		assert.Equal(t, int32(1), atomic.LoadInt32(&cache.stores))
+		assert.Equal(t, []string{"preview", "thumbnail"}, thumbnailer.Renditions())
+	})
+
+	t.Run("cache stats", func(t *testing.T) {
+		before := dc.Stats()
+		thumb, _, err := thumbnailer.Thumbnail(context.Background(), "album1", "test.jpg", "preview")
+		require.NoError(t, err)
+		require.NoError(t, thumb.Close())
+
+		stats := dc.Stats()
+		assert.Equal(t, before.Hits, stats.Hits)
+		assert.Equal(t, before.Misses+1, stats.Misses)
+
+		thumb, _, err = thumbnailer.Thumbnail(context.Background(), "album1", "test.jpg", "preview")
+		require.NoError(t, err)
+		require.NoError(t, thumb.Close())
+		assert.Equal(t, before.Hits+1, dc.Stats().Hits)
+	})
+
+	t.Run("cancelled request", func(t *testing.T) {
+		thumbnailer.workers <- struct{}{}
+		defer func() { <-thumbnailer.workers }()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, _, err := thumbnailer.Thumbnail(ctx, "album2", "test.jpg", DefaultRendition)
+		assert.Equal(t, context.Canceled, err)
+	})
+
+	t.Run("unknown rendition", func(t *testing.T) {
+		_, _, err := thumbnailer.Thumbnail(context.Background(), "album1", "test.jpg", "large")
+		assert.Equal(t, ErrUnknownRendition, err)
+	})
+
+	t.Run("invalid rendition", func(t *testing.T) {
+		_, err := NewThumbnailer(src, cache, map[string]uint{"Large": 2560}, 1)
+		require.Error(t, err)
+
+		_, err = NewThumbnailer(src, cache, map[string]uint{"large": 0}, 1)
+		require.Error(t, err)
+	})
+
+	t.Run("missing image", func(t *testing.T) {
+		_, _, err := thumbnailer.Thumbnail(context.Background(), "album1", "missing.jpg", DefaultRendition)
+		require.Error(t, err)
+	})
+}
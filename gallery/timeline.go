@@ -0,0 +1,152 @@
+package gallery
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ap4y/cloud/internal/paging"
+)
+
+// TimelineGroup defines period used for grouping of the timeline
+// images.
+type TimelineGroup string
+
+const (
+	// TimelineYear groups images by capture year.
+	TimelineYear TimelineGroup = "year"
+	// TimelineMonth groups images by capture month.
+	TimelineMonth TimelineGroup = "month"
+	// TimelineDay groups images by capture day.
+	TimelineDay TimelineGroup = "day"
+)
+
+const (
+	// DefaultTimelineLimit defines page size used when limit is not provided.
+	DefaultTimelineLimit = 100
+	// MaxTimelineLimit defines maximum page size.
+	MaxTimelineLimit = 1000
+)
+
+// ErrInvalidCursor returned for malformed cursors.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+var timelineLayouts = map[TimelineGroup]string{
+	TimelineYear:  "2006",
+	TimelineMonth: "2006-01",
+	TimelineDay:   "2006-01-02",
+}
+
+// TimelineImage stores image metadata along with it's album.
+type TimelineImage struct {
+	Album string `json:"album"`
+	Image
+}
+
+// TimelineEntry stores images captured within the same period.
+type TimelineEntry struct {
+	Date   string          `json:"date"`
+	Images []TimelineImage `json:"images"`
+}
+
+// Timeline represents a single page of images across all albums
+// grouped by capture date, newest images first. Group split between
+// pages is returned with the same date on both pages.
+type Timeline struct {
+	Groups     []TimelineEntry `json:"groups"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// timelineCursor stores sorting keys of the last returned image.
+type timelineCursor struct {
+	TakenAt int64  `json:"t"`
+	Album   string `json:"a"`
+	Path    string `json:"p"`
+}
+
+// NewTimeline returns a page of images from albums of a source
+// starting after cursor. Only albums accepted by optional include are
+// listed. Zero group defaults to TimelineDay.
+func NewTimeline(source Source, include func(album string) bool, group TimelineGroup, cursor string, limit int) (*Timeline, error) {
+	if group == "" {
+		group = TimelineDay
+	}
+
+	layout, ok := timelineLayouts[group]
+	if !ok {
+		return nil, fmt.Errorf("unknown group: %s", group)
+	}
+
+	if limit <= 0 {
+		limit = DefaultTimelineLimit
+	} else if limit > MaxTimelineLimit {
+		limit = MaxTimelineLimit
+	}
+
+	albums, err := source.Albums()
+	if err != nil {
+		return nil, fmt.Errorf("albums: %s", err)
+	}
+
+	images := make([]TimelineImage, 0)
+	for _, album := range albums {
+		if include != nil && !include(album.Name) {
+			continue
+		}
+
+		albumImages, err := source.Images(album.Name)
+		if err != nil {
+			return nil, fmt.Errorf("images: %s", err)
+		}
+
+		for _, image := range albumImages {
+			images = append(images, TimelineImage{album.Name, image})
+		}
+	}
+
+	sort.Slice(images, func(i, j int) bool { return timelineLess(images[i], images[j]) })
+
+	if cursor != "" {
+		c := &timelineCursor{}
+		if err := paging.DecodeCursor(cursor, c); err != nil {
+			return nil, ErrInvalidCursor
+		}
+
+		last := TimelineImage{c.Album, Image{Path: c.Path, TakenAt: time.Unix(0, c.TakenAt)}}
+
+		images = images[sort.Search(len(images), func(i int) bool { return timelineLess(last, images[i]) }):]
+	}
+
+	timeline := &Timeline{Groups: make([]TimelineEntry, 0)}
+	if len(images) > limit {
+		images = images[:limit]
+		last := images[limit-1]
+		timeline.NextCursor = paging.EncodeCursor(timelineCursor{last.TakenAt.UnixNano(), last.Album, last.Path})
+	}
+
+	for _, image := range images {
+		date := image.TakenAt.Format(layout)
+		if last := len(timeline.Groups) - 1; last >= 0 && timeline.Groups[last].Date == date {
+			timeline.Groups[last].Images = append(timeline.Groups[last].Images, image)
+			continue
+		}
+
+		timeline.Groups = append(timeline.Groups, TimelineEntry{date, []TimelineImage{image}})
+	}
+
+	return timeline, nil
+}
+
+// timelineLess orders images by capture time in descending order,
+// ties are resolved by album and path.
+func timelineLess(a, b TimelineImage) bool {
+	switch {
+	case !a.TakenAt.Equal(b.TakenAt):
+		return a.TakenAt.After(b.TakenAt)
+	case a.Album != b.Album:
+		return a.Album < b.Album
+	}
+
+	return a.Path < b.Path
+}
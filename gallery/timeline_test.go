@@ -0,0 +1,101 @@
+package gallery
+
+import (
+	"image"
+	"image/jpeg"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeline(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gallery")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, album := range []string{"a", "b"} {
+		require.NoError(t, os.Mkdir(filepath.Join(dir, album), 0755))
+	}
+
+	images := map[string]time.Time{
+		"a/1.jpg": time.Date(2021, 1, 1, 10, 0, 0, 0, time.Local),
+		"a/2.jpg": time.Date(2021, 1, 1, 12, 0, 0, 0, time.Local),
+		"b/3.jpg": time.Date(2021, 2, 10, 12, 0, 0, 0, time.Local),
+	}
+	for name, modTime := range images {
+		file, err := os.Create(filepath.Join(dir, name))
+		require.NoError(t, err)
+		require.NoError(t, jpeg.Encode(file, image.NewGray(image.Rect(0, 0, 4, 4)), nil))
+		require.NoError(t, file.Close())
+		require.NoError(t, os.Chtimes(filepath.Join(dir, name), modTime, modTime))
+	}
+
+	data, err := ioutil.ReadFile("fixtures/album1/test.jpg")
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "b", "exif.jpg"), data, 0644))
+
+	src, err := NewDiskSource(dir, []string{".jpg"})
+	require.NoError(t, err)
+
+	t.Run("day", func(t *testing.T) {
+		timeline, err := NewTimeline(src, nil, "", "", 2)
+		require.NoError(t, err)
+		require.Len(t, timeline.Groups, 2)
+		require.NotEmpty(t, timeline.NextCursor)
+
+		assert.Equal(t, "2021-02-10", timeline.Groups[0].Date)
+		assert.Equal(t, "b", timeline.Groups[0].Images[0].Album)
+		assert.Equal(t, "3.jpg", timeline.Groups[0].Images[0].Path)
+		assert.Equal(t, "2021-01-01", timeline.Groups[1].Date)
+		assert.Equal(t, "2.jpg", timeline.Groups[1].Images[0].Path)
+
+		timeline, err = NewTimeline(src, nil, TimelineDay, timeline.NextCursor, 2)
+		require.NoError(t, err)
+		require.Len(t, timeline.Groups, 2)
+		assert.Empty(t, timeline.NextCursor)
+
+		assert.Equal(t, "2021-01-01", timeline.Groups[0].Date)
+		assert.Equal(t, "1.jpg", timeline.Groups[0].Images[0].Path)
+		assert.Equal(t, "2018-08-11", timeline.Groups[1].Date)
+		assert.Equal(t, "exif.jpg", timeline.Groups[1].Images[0].Path)
+	})
+
+	t.Run("month", func(t *testing.T) {
+		timeline, err := NewTimeline(src, nil, TimelineMonth, "", 0)
+		require.NoError(t, err)
+		require.Len(t, timeline.Groups, 3)
+		assert.Equal(t, "2021-02", timeline.Groups[0].Date)
+		assert.Equal(t, "2021-01", timeline.Groups[1].Date)
+		assert.Len(t, timeline.Groups[1].Images, 2)
+		assert.Equal(t, "2018-08", timeline.Groups[2].Date)
+	})
+
+	t.Run("year", func(t *testing.T) {
+		timeline, err := NewTimeline(src, nil, TimelineYear, "", 0)
+		require.NoError(t, err)
+		require.Len(t, timeline.Groups, 2)
+		assert.Len(t, timeline.Groups[0].Images, 3)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := NewTimeline(src, nil, "week", "", 0)
+		require.Error(t, err)
+
+		_, err = NewTimeline(src, nil, TimelineDay, "foo", 0)
+		assert.Equal(t, ErrInvalidCursor, err)
+	})
+
+	t.Run("Images", func(t *testing.T) {
+		imgs, err := src.Images("b")
+		require.NoError(t, err)
+		require.Len(t, imgs, 2)
+		assert.Equal(t, "exif.jpg", imgs[0].Path)
+		assert.Equal(t, "2018-08-11 13:41:39", imgs[0].TakenAt.Format("2006-01-02 15:04:05"))
+		assert.Equal(t, "3.jpg", imgs[1].Path)
+	})
+}
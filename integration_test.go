@@ -2,6 +2,7 @@ package integration
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -12,12 +13,14 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/ap4y/cloud/api"
+	"github.com/ap4y/cloud/events"
 	"github.com/ap4y/cloud/files"
 	"github.com/ap4y/cloud/gallery"
 	"github.com/ap4y/cloud/module"
@@ -39,12 +42,19 @@ var privateRoutes = []struct {
 	{"GET", "/gallery/album1/image/test.jpg", "", false},
 	{"GET", "/gallery/album1/thumbnail/test.jpg", "", false},
 	{"GET", "/gallery/album1/exif/test.jpg", "", false},
+	{"GET", "/gallery/album1/archive", "", false},
 	{"GET", "/files", "", false},
 	{"POST", "/files/mkdir/testfoo", "", false},
 	{"POST", "/files/rmdir/testfoo", "", false},
 	{"POST", "/files/upload/test1", "bar", true},
 	{"DELETE", "/files/file/test1/test", "", false},
 	{"GET", "/files/file/foo", "", false},
+	{"GET", "/files/list/test1", "", false},
+	{"GET", "/files/stat/foo", "", false},
+	{"GET", "/files/archive/test1", "", false},
+	{"POST", "/files/copy", "{\"src\":\"/foo\",\"dst\":\"/testcopy\"}", false},
+	{"POST", "/files/move", "{\"src\":\"/testcopy\",\"dst\":\"/test1/testcopy\"}", false},
+	{"DELETE", "/files/file/test1/testcopy", "", false},
 }
 
 var publicRoutes = []struct {
@@ -57,9 +67,24 @@ var publicRoutes = []struct {
 	{"GET", "/share/bar/gallery/album1/images", ""},
 	{"GET", "/share/bar/gallery/album1/image/test.jpg", ""},
 	{"GET", "/share/bar/gallery/album1/thumbnail/test.jpg", ""},
-	{"GET", "/share/bar/gallery/album1/exif/test.jpg", ""},
 	{"GET", "/share/baz/files", ""},
 	{"GET", "/share/baz/files/file/test1/inner/foo", ""},
+	{"GET", "/share/baz/files/archive", ""},
+	{"GET", "/share/baz/files/list", ""},
+	{"GET", "/share/bar/gallery/album1/archive", ""},
+	{"POST", "/share/qux/unlock", "{\"password\":\"changeme\"}"},
+}
+
+var lockedRoutes = []struct {
+	method string
+	url    string
+	body   string
+}{
+	{"GET", "/share/qux", ""},
+	{"GET", "/share/qux/gallery/album1/images", ""},
+	{"GET", "/share/qux/gallery/album1/image/test.jpg", ""},
+	{"GET", "/share/qux/gallery/album1/thumbnail/test.jpg", ""},
+	{"GET", "/share/qux/gallery/album1/archive", ""},
 }
 
 var prohibitedRoutes = []struct {
@@ -68,10 +93,15 @@ var prohibitedRoutes = []struct {
 	body   string
 }{
 	{"GET", "/share/bar/gallery", ""},
+	{"GET", "/share/bar/gallery/album2/archive", ""},
+	{"GET", "/share/bar/gallery/album1/exif/test.jpg", ""},
+	{"GET", "/share/baz/files/archive/foo", ""},
 	{"POST", "/share/baz/files/mkdir/testfoo", ""},
 	{"POST", "/share/baz/files/rmdir/testfoo", ""},
 	{"POST", "/share/baz/files/upload/foo", ""},
 	{"DELETE", "/share/baz/files/file/foo", ""},
+	{"POST", "/share/baz/files/move", "{\"src\":\"/foo\",\"dst\":\"/test1/foo\"}"},
+	{"POST", "/share/baz/files/copy", "{\"src\":\"/foo\",\"dst\":\"/test1/foo\"}"},
 }
 
 func TestAPIServer(t *testing.T) {
@@ -83,11 +113,11 @@ func TestAPIServer(t *testing.T) {
 		module.Gallery: galleryModule(t, cacheDir),
 		module.Files:   filesModule(t),
 	}
-	cs := api.NewMemoryCredentialsStorage(
+	cs, err := api.NewMemoryCredentialsStorage(
 		map[string]string{"test": "$2b$10$fEWhY87kzeaV3hUEB6phTuyWjpv73V5m.YcqTxHXnvqEGIou1tXGO"},
-		jwt.SigningMethodHS256,
-		[]byte("secret"),
+		api.TokenConfig{SigningMethod: jwt.SigningMethodHS256, SignKey: []byte("secret")},
 	)
+	require.NoError(t, err)
 
 	sharesDir, err := ioutil.TempDir("", "shares")
 	require.NoError(t, err)
@@ -101,7 +131,18 @@ func TestAPIServer(t *testing.T) {
 	err = ss.Save(&share.Share{Slug: "baz", Type: module.Files, Name: "/test1", Items: []string{"/test1/inner"}})
 	require.NoError(t, err)
 
-	handler, err := api.NewServer(modules, cs, ss)
+	protected := &share.Share{Slug: "qux", Type: module.Gallery, Name: "album1", Items: []string{"test.jpg"}}
+	require.NoError(t, protected.SetPassword("changeme"))
+	require.NoError(t, ss.Save(protected))
+
+	sl := share.NewLocker([]byte("secret"), time.Minute)
+	pwd, err := os.Getwd()
+	require.NoError(t, err)
+	filesSource, err := files.NewDiskSource(filepath.Join(pwd, "/files/fixtures"), "")
+	require.NoError(t, err)
+	dav := files.NewWebDAV(filesSource, api.WebDAVPrefix)
+
+	handler, err := api.NewServer(modules, cs, nil, ss, sl, nil, dav, events.NewBroker(), nil)
 	require.NoError(t, err)
 
 	ts := httptest.NewServer(handler)
@@ -127,7 +168,9 @@ func TestAPIServer(t *testing.T) {
 		})
 	}
 
-	jwtToken := jwtToken("test", "secret")
+	tokens, err := cs.Authenticate("test", "changeme")
+	require.NoError(t, err)
+	jwtToken := tokens.Token
 	for _, tc := range privateRoutes {
 		t.Run(fmt.Sprintf("%s%s", tc.method, tc.url), func(t *testing.T) {
 			var body io.Reader
@@ -157,6 +200,61 @@ func TestAPIServer(t *testing.T) {
 		})
 	}
 
+	t.Run("webdav", func(t *testing.T) {
+		req, err := http.NewRequest("PROPFIND", ts.URL+"/dav/", nil)
+		require.NoError(t, err)
+		req.Header.Set("Depth", "1")
+		res, err := client.Do(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+		req.SetBasicAuth("test", "changeme")
+		res, err = client.Do(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusMultiStatus, res.StatusCode)
+	})
+
+	t.Run("events", func(t *testing.T) {
+		res, err := client.Get(ts.URL + "/api/events")
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		req, err := http.NewRequest("GET", ts.URL+"/api/events", nil)
+		require.NoError(t, err)
+		req.Header.Set("Cookie", "token="+jwtToken+";")
+		res, err = client.Do(req.WithContext(ctx))
+		require.NoError(t, err)
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+	})
+
+	for _, tc := range lockedRoutes {
+		t.Run(fmt.Sprintf("locked/%s%s", tc.method, tc.url), func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, ts.URL+"/api"+tc.url, strings.NewReader(tc.body))
+			require.NoError(t, err)
+			res, err := client.Do(req)
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+		})
+	}
+
+	unlockToken, _, err := sl.Unlock(protected, "changeme")
+	require.NoError(t, err)
+	for _, tc := range lockedRoutes {
+		t.Run(fmt.Sprintf("unlocked/%s%s", tc.method, tc.url), func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, ts.URL+"/api"+tc.url, strings.NewReader(tc.body))
+			require.NoError(t, err)
+			req.AddCookie(&http.Cookie{Name: share.UnlockCookieKey, Value: unlockToken})
+			res, err := client.Do(req)
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+		})
+	}
+
 	for _, tc := range prohibitedRoutes {
 		t.Run(fmt.Sprintf("%s%s", tc.method, tc.url), func(t *testing.T) {
 			req, err := http.NewRequest(tc.method, ts.URL+"/api"+tc.url, strings.NewReader(tc.body))
@@ -176,10 +274,12 @@ func galleryModule(t *testing.T, cacheDir string) http.Handler {
 	source, err := gallery.NewDiskSource(filepath.Join(pwd, "/gallery/fixtures"), []string{".jpg"})
 	require.NoError(t, err)
 
-	cache, err := gallery.NewDiskCache(cacheDir)
+	cache, err := gallery.NewDiskCache(cacheDir, 0, 0)
 	require.NoError(t, err)
 
-	return gallery.NewGalleryAPI(source, cache)
+	thumbnailer, err := gallery.NewThumbnailer(source, cache, nil, 0)
+	require.NoError(t, err)
+	return gallery.NewGalleryAPI(source, cache, thumbnailer, gallery.NewIndexer(source, thumbnailer))
 }
 
 func filesModule(t *testing.T) http.Handler {
@@ -187,16 +287,15 @@ func filesModule(t *testing.T) http.Handler {
 
 	pwd, err := os.Getwd()
 	require.NoError(t, err)
-	source, err := files.NewDiskSource(filepath.Join(pwd, "/files/fixtures"))
+	source, err := files.NewDiskSource(filepath.Join(pwd, "/files/fixtures"), "")
 	require.NoError(t, err)
 
-	return files.NewFilesAPI(source)
-}
+	uploadsDir, err := ioutil.TempDir("", "uploads")
+	require.NoError(t, err)
+	uploads, err := files.NewDiskUploadStore(uploadsDir)
+	require.NoError(t, err)
 
-func jwtToken(username, secret string) string {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{api.UserAuthKey: username})
-	str, _ := token.SignedString([]byte(secret))
-	return str
+	return files.NewFilesAPI(source, uploads)
 }
 
 func formFile(t *testing.T, name, content string) (io.Reader, string) {
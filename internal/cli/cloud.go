@@ -1,6 +1,8 @@
 package cli
 
 import (
+	"context"
+	"crypto/rand"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -8,31 +10,30 @@ import (
 	"net/http/httputil"
 	"net/url"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/go-chi/chi"
 
+	"github.com/ap4y/cloud/acl"
 	"github.com/ap4y/cloud/api"
 	"github.com/ap4y/cloud/app"
+	"github.com/ap4y/cloud/events"
 	"github.com/ap4y/cloud/files"
 	"github.com/ap4y/cloud/gallery"
 	"github.com/ap4y/cloud/module"
 	"github.com/ap4y/cloud/share"
+	"github.com/ap4y/cloud/throttle"
 )
 
 // TODO: config validation
 
 // Run is an entry point for a CLI.
 func Run(configPath, devURL, addr string) error {
-	cfg := new(Config)
-	f, err := os.Open(configPath)
+	cfg, err := loadConfig(configPath)
 	if err != nil {
-		return fmt.Errorf("failed to open config file: %s", err)
-	}
-
-	if err := json.NewDecoder(f).Decode(cfg); err != nil {
-		return fmt.Errorf("failed to decode config file: %s", err)
+		return err
 	}
 
 	srv, err := setupServer(cfg)
@@ -53,10 +54,61 @@ func Run(configPath, devURL, addr string) error {
 	return nil
 }
 
+// Index pre-generates gallery thumbnails for provided albums, all
+// albums are indexed if none provided.
+func Index(configPath string, albums ...string) error {
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	if cfg.Gallery == nil {
+		return fmt.Errorf("gallery is not configured")
+	}
+
+	source, _, thumbnailer, err := galleryStorage(cfg.Gallery)
+	if err != nil {
+		return fmt.Errorf("failed to initialise gallery: %s", err)
+	}
+
+	indexer := gallery.NewIndexer(source, thumbnailer)
+	if err := indexer.Index(context.Background(), albums...); err != nil {
+		return fmt.Errorf("failed to index: %s", err)
+	}
+
+	progress := indexer.Progress()
+	log.Printf("Indexed %d images, %d failed", progress.Done, progress.Failed)
+	return nil
+}
+
+func loadConfig(configPath string) (*Config, error) {
+	cfg := new(Config)
+	f, err := os.Open(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open config file: %s", err)
+	}
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(cfg); err != nil {
+		return nil, fmt.Errorf("failed to decode config file: %s", err)
+	}
+
+	return cfg, nil
+}
+
 func setupServer(cfg *Config) (http.Handler, error) {
+	// Home folders are resolved by username of the authenticated user.
+	if cfg.Files != nil && cfg.Files.Homes && cfg.JWTSecret == "" {
+		return nil, fmt.Errorf("files homes require jwt_secret")
+	}
+
 	modules := map[module.Type]http.Handler{}
+	eb := events.NewBroker()
+	var homes *events.Homes
+	var dav http.Handler
 	for _, mod := range cfg.Modules {
 		var handler http.Handler
+		var watchPath string
 		var err error
 
 		if mod == module.Gallery {
@@ -64,27 +116,87 @@ func setupServer(cfg *Config) (http.Handler, error) {
 			if err != nil {
 				return nil, fmt.Errorf("failed to initialise gallery: %s", err)
 			}
+			watchPath = cfg.Gallery.Path
 		}
 
 		if mod == module.Files {
-			handler, err = filesModule(cfg.Files)
+			usernames := make([]string, 0, len(cfg.Users))
+			for username := range cfg.Users {
+				usernames = append(usernames, username)
+			}
+
+			handler, dav, err = filesModule(cfg.Files, usernames)
 			if err != nil {
-				return nil, fmt.Errorf("failed to initialise gallery: %s", err)
+				return nil, fmt.Errorf("failed to initialise files: %s", err)
+			}
+
+			watchPath = cfg.Files.Path
+			if cfg.Files.Homes {
+				homes = &events.Homes{Module: module.Files, Shared: cfg.Files.Shared}
+			}
+		}
+
+		if watchPath != "" {
+			if _, err := events.Watch(eb, mod, watchPath); err != nil {
+				log.Printf("failed to watch %s: %s", mod, err)
 			}
 		}
 
 		modules[mod] = handler
 	}
 
+	if err := cfg.Permissions.Validate(); err != nil {
+		return nil, err
+	}
+
 	var cs api.CredentialsStorage
+	var permissions acl.Provider
+	if cfg.Permissions != nil {
+		permissions = cfg.Permissions
+	}
+
 	if cfg.JWTSecret != "" {
-		cs = api.NewMemoryCredentialsStorage(cfg.Users, jwt.SigningMethodHS256, []byte(cfg.JWTSecret))
+		tokenCfg := api.TokenConfig{SigningMethod: jwt.SigningMethodHS256, SignKey: []byte(cfg.JWTSecret)}
+		if cfg.Session != nil {
+			tokenCfg.Lifetime = cfg.Session.TokenLifetime.Duration
+			tokenCfg.RefreshLifetime = cfg.Session.RefreshLifetime.Duration
+			tokenCfg.RevocationsPath = cfg.Session.Revocations
+		}
+
+		if cfg.UserStore != "" {
+			us, err := userStorage(cfg, tokenCfg)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create user store: %s", err)
+			}
+			cs, permissions = us, us
+		} else {
+			mcs, err := api.NewMemoryCredentialsStorage(cfg.Users, tokenCfg)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create credentials store: %s", err)
+			}
+			cs = mcs
+		}
 	}
+
 	ss, err := share.NewDiskStore(cfg.Share.Path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create share store: %s", err)
 	}
 
+	lockerKey := []byte(cfg.JWTSecret)
+	if len(lockerKey) == 0 {
+		lockerKey = make([]byte, 32)
+		if _, err := rand.Read(lockerKey); err != nil {
+			return nil, fmt.Errorf("failed to generate share key: %s", err)
+		}
+	}
+	sl := share.NewLocker(lockerKey, cfg.Share.UnlockLifetime.Duration)
+
+	th, err := setupThrottle(cfg.Throttle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create throttle: %s", err)
+	}
+
 	expireTicker := time.NewTicker(time.Hour)
 	go func() {
 		for range expireTicker.C {
@@ -94,7 +206,55 @@ func setupServer(cfg *Config) (http.Handler, error) {
 		}
 	}()
 
-	return api.NewServer(modules, cs, ss)
+	return api.NewServer(modules, cs, permissions, ss, sl, th, dav, eb, homes)
+}
+
+func setupThrottle(cfg *ThrottleConfig) (*throttle.Throttle, error) {
+	if cfg == nil {
+		return throttle.New(throttle.Config{}), nil
+	}
+
+	proxies, err := throttle.ParseNetworks(cfg.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	return throttle.New(throttle.Config{
+		Attempts:       cfg.Attempts,
+		Backoff:        cfg.Backoff.Duration,
+		Lockout:        cfg.Lockout.Duration,
+		Reset:          cfg.Reset.Duration,
+		TrustedProxies: proxies,
+	}), nil
+}
+
+// userStorage returns disk user storage with imported config users,
+// users without configured permissions are imported as admins when
+// permissions are not configured and skipped otherwise.
+func userStorage(cfg *Config, tokenCfg api.TokenConfig) (api.UserStorage, error) {
+	us, err := api.NewDiskUserStorage(cfg.UserStore, tokenCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	for username, hash := range cfg.Users {
+		permissions := cfg.Permissions[username]
+		if cfg.Permissions == nil {
+			permissions = &acl.User{Role: acl.RoleAdmin}
+		}
+
+		if permissions == nil {
+			log.Printf("skipping import of user %s without permissions", username)
+			continue
+		}
+
+		user := api.User{Username: username, Permissions: permissions}
+		if err := us.Import(user, hash); err != nil && err != api.ErrUserExists {
+			return nil, fmt.Errorf("%s: %s", username, err)
+		}
+	}
+
+	return us, nil
 }
 
 func setupAssets(devURL string, handler http.Handler) error {
@@ -124,25 +284,130 @@ func setupAssets(devURL string, handler http.Handler) error {
 	return nil
 }
 
-func galleryModule(cfg *GalleryConfig) (http.Handler, error) {
+func galleryStorage(cfg *GalleryConfig) (gallery.Source, gallery.Cache, *gallery.Thumbnailer, error) {
 	source, err := gallery.NewDiskSource(cfg.Path, []string{".jpg", ".jpeg", ".png"})
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 
-	cache, err := gallery.NewDiskCache(cfg.Cache)
+	cache, err := gallery.NewDiskCache(cfg.Cache, cfg.CacheMaxSize, cfg.CacheMaxEntries)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
+	}
+
+	thumbnailer, err := gallery.NewThumbnailer(source, cache, cfg.Renditions, cfg.ThumbnailWorkers)
+	if err != nil {
+		return nil, nil, nil, err
 	}
 
-	return gallery.NewGalleryAPI(source, cache), nil
+	return source, cache, thumbnailer, nil
 }
 
-func filesModule(cfg *FilesConfig) (http.Handler, error) {
-	source, err := files.NewDiskSource(cfg.Path)
+func galleryModule(cfg *GalleryConfig) (http.Handler, error) {
+	source, cache, thumbnailer, err := galleryStorage(cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	return files.NewFilesAPI(source), nil
+	orphansTicker := time.NewTicker(24 * time.Hour)
+	go func() {
+		for {
+			if _, err := cache.RemoveOrphans(source); err != nil {
+				log.Println("failed to remove orphaned thumbnails:", err)
+			}
+
+			<-orphansTicker.C
+		}
+	}()
+
+	indexer := gallery.NewIndexer(source, thumbnailer)
+	if cfg.IndexInterval.Duration > 0 {
+		indexTicker := time.NewTicker(cfg.IndexInterval.Duration)
+		go func() {
+			for {
+				if err := indexer.Index(context.Background()); err != nil {
+					log.Println("failed to index gallery:", err)
+				}
+
+				<-indexTicker.C
+			}
+		}()
+	}
+
+	return gallery.NewGalleryAPI(source, cache, thumbnailer, indexer), nil
+}
+
+func filesModule(cfg *FilesConfig, usernames []string) (http.Handler, http.Handler, error) {
+	var source files.Source
+	var homes *files.Homes
+	var err error
+	if cfg.Homes {
+		homes, err = files.NewHomes(cfg.Path, cfg.Trash, cfg.Shared, usernames)
+	} else {
+		source, err = files.NewDiskSource(cfg.Path, cfg.Trash)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var trash interface{ ExpireTrash(time.Duration) error } = source
+	if homes != nil {
+		trash = homes
+	}
+
+	if cfg.Trash != "" {
+		retention := cfg.TrashRetention.Duration
+		if retention == 0 {
+			retention = files.DefaultTrashRetention
+		}
+
+		expireTicker := time.NewTicker(time.Hour)
+		go func() {
+			for range expireTicker.C {
+				if err := trash.ExpireTrash(retention); err != nil {
+					log.Println("failed to expire trash:", err)
+				}
+			}
+		}()
+	}
+
+	uploadsDir := cfg.Uploads
+	if uploadsDir == "" {
+		uploadsDir = filepath.Join(os.TempDir(), "cloud-uploads")
+	}
+
+	uploads, err := files.NewDiskUploadStore(uploadsDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	uploadsRetention := cfg.UploadsRetention.Duration
+	if uploadsRetention == 0 {
+		uploadsRetention = files.DefaultUploadRetention
+	}
+
+	uploadsTicker := time.NewTicker(time.Hour)
+	go func() {
+		for range uploadsTicker.C {
+			if err := uploads.Expire(uploadsRetention); err != nil {
+				log.Println("failed to expire uploads:", err)
+			}
+		}
+	}()
+
+	if homes != nil {
+		var dav http.Handler
+		if cfg.WebDAV {
+			dav = files.NewHomesWebDAV(homes, api.WebDAVPrefix)
+		}
+
+		return files.NewHomesAPI(homes, uploads), dav, nil
+	}
+
+	var dav http.Handler
+	if cfg.WebDAV {
+		dav = files.NewWebDAV(source, api.WebDAVPrefix)
+	}
+
+	return files.NewFilesAPI(source, uploads), dav, nil
 }
@@ -1,21 +1,85 @@
 package cli
 
-import "github.com/ap4y/cloud/module"
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ap4y/cloud/acl"
+	"github.com/ap4y/cloud/module"
+)
+
+// Duration implements json string encoded time.Duration.
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalJSON parses duration strings like "1h30m".
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return fmt.Errorf("invalid duration: %s", err)
+	}
+
+	duration, err := time.ParseDuration(str)
+	if err != nil {
+		return fmt.Errorf("invalid duration: %s", err)
+	}
+
+	d.Duration = duration
+	return nil
+}
 
 // GalleryConfig defines gallery related configuration variables for CLI.
 type GalleryConfig struct {
-	Path  string `json:"path"`
-	Cache string `json:"cache"`
+	Path             string          `json:"path"`
+	Cache            string          `json:"cache"`
+	CacheMaxSize     int64           `json:"cache_max_size"`
+	CacheMaxEntries  int             `json:"cache_max_entries"`
+	ThumbnailWorkers int             `json:"thumbnail_workers"`
+	Renditions       map[string]uint `json:"renditions"`
+	IndexInterval    Duration        `json:"index_interval"`
 }
 
 // FilesConfig defines files module related configuration variables for CLI.
 type FilesConfig struct {
-	Path string `json:"path"`
+	Path             string   `json:"path"`
+	Uploads          string   `json:"uploads"`
+	UploadsRetention Duration `json:"uploads_retention"`
+	WebDAV           bool     `json:"webdav"`
+	Trash            string   `json:"trash"`
+	TrashRetention   Duration `json:"trash_retention"`
+	// Homes enables isolated per-user folders of the Path.
+	Homes bool `json:"homes"`
+	// Shared defines folder of the Path visible to all users in
+	// homes mode.
+	Shared string `json:"shared"`
 }
 
 // ShareConfig defines share related configuration variables for CLI.
 type ShareConfig struct {
-	Path string `json:"path"`
+	Path           string   `json:"path"`
+	UnlockLifetime Duration `json:"unlock_lifetime"`
+}
+
+// SessionConfig defines lifetimes of the issued authentication tokens
+// and location of the revoked tokens.
+type SessionConfig struct {
+	TokenLifetime   Duration `json:"token_lifetime"`
+	RefreshLifetime Duration `json:"refresh_lifetime"`
+	Revocations     string   `json:"revocations"`
+}
+
+// ThrottleConfig defines limits of the failed sign in attempts and
+// share lookups.
+type ThrottleConfig struct {
+	Attempts int      `json:"attempts"`
+	Backoff  Duration `json:"backoff"`
+	Lockout  Duration `json:"lockout"`
+	Reset    Duration `json:"reset"`
+	// TrustedProxies defines addresses and networks of proxies that
+	// are allowed to set X-Forwarded-For header.
+	TrustedProxies []string `json:"trusted_proxies"`
 }
 
 // Config defines configuration variables for CLI.
@@ -23,7 +87,15 @@ type Config struct {
 	JWTSecret string            `json:"jwt_secret"`
 	Modules   []module.Type     `json:"modules"`
 	Users     map[string]string `json:"users"`
-	Share     *ShareConfig      `json:"share"`
-	Gallery   *GalleryConfig    `json:"gallery"`
-	Files     *FilesConfig      `json:"files"`
+	// UserStore defines path of the file with users managed at
+	// runtime, config users are imported into it on startup.
+	UserStore string `json:"user_store"`
+	// Permissions restricts access of users, all users have full
+	// access if not provided.
+	Permissions acl.Permissions `json:"permissions"`
+	Session     *SessionConfig  `json:"session"`
+	Throttle    *ThrottleConfig `json:"throttle"`
+	Share       *ShareConfig    `json:"share"`
+	Gallery     *GalleryConfig  `json:"gallery"`
+	Files       *FilesConfig    `json:"files"`
 }
@@ -0,0 +1,73 @@
+// Package filecache implements LRU cache of values derived from file
+// content.
+package filecache
+
+import (
+	"container/list"
+	"os"
+	"sync"
+	"time"
+)
+
+type entry struct {
+	path    string
+	size    int64
+	modTime time.Time
+	value   interface{}
+}
+
+// Cache stores values per file path, values are invalidated when
+// file size or modification time changes. Least recently used
+// entries are evicted when cache is full.
+type Cache struct {
+	mu      sync.Mutex
+	max     int
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+// New returns a new Cache that holds up to max entries.
+func New(max int) *Cache {
+	return &Cache{max: max, entries: map[string]*list.Element{}, order: list.New()}
+}
+
+// Get returns cached value of a file, false is returned for missing
+// or stale entries.
+func (c *Cache) Get(path string, fi os.FileInfo) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[path]
+	if !ok {
+		return nil, false
+	}
+
+	e := el.Value.(*entry)
+	if e.size != fi.Size() || !e.modTime.Equal(fi.ModTime()) {
+		return nil, false
+	}
+
+	c.order.MoveToFront(el)
+	return e.value, true
+}
+
+// Set stores value of a file.
+func (c *Cache) Set(path string, fi os.FileInfo, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e := &entry{path, fi.Size(), fi.ModTime(), value}
+	if el, ok := c.entries[path]; ok {
+		el.Value = e
+		c.order.MoveToFront(el)
+		return
+	}
+
+	if c.order.Len() >= c.max {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*entry).path)
+	}
+
+	c.entries[path] = c.order.PushFront(e)
+}
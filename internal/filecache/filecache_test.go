@@ -0,0 +1,57 @@
+package filecache
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fileInfo struct {
+	os.FileInfo
+	size    int64
+	modTime time.Time
+}
+
+func (fi fileInfo) Size() int64        { return fi.size }
+func (fi fileInfo) ModTime() time.Time { return fi.modTime }
+
+func TestCache(t *testing.T) {
+	now := time.Now()
+	fi := fileInfo{size: 1, modTime: now}
+	cache := New(2)
+
+	t.Run("Get/Set", func(t *testing.T) {
+		_, ok := cache.Get("/foo", fi)
+		assert.False(t, ok)
+
+		cache.Set("/foo", fi, "foo")
+		value, ok := cache.Get("/foo", fi)
+		assert.True(t, ok)
+		assert.Equal(t, "foo", value)
+	})
+
+	t.Run("stale", func(t *testing.T) {
+		_, ok := cache.Get("/foo", fileInfo{size: 2, modTime: now})
+		assert.False(t, ok)
+
+		_, ok = cache.Get("/foo", fileInfo{size: 1, modTime: now.Add(time.Second)})
+		assert.False(t, ok)
+	})
+
+	t.Run("eviction", func(t *testing.T) {
+		cache.Set("/bar", fi, "bar")
+		_, ok := cache.Get("/foo", fi)
+		assert.True(t, ok)
+
+		cache.Set("/baz", fi, "baz")
+		_, ok = cache.Get("/bar", fi)
+		assert.False(t, ok)
+
+		for _, path := range []string{"/foo", "/baz"} {
+			_, ok = cache.Get(path, fi)
+			assert.True(t, ok, path)
+		}
+	})
+}
@@ -0,0 +1,55 @@
+package httputil
+
+import (
+	"archive/zip"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Archive streams zip archive into ResponseWriter. Entries are
+// written as they are added, archive has to be closed to write
+// central directory. Archives that failed mid-stream shouldn't be
+// closed, handler has to be aborted with http.ErrAbortHandler
+// instead so clients don't receive valid truncated archive.
+type Archive struct {
+	zw *zip.Writer
+}
+
+// NewArchive sets attachment headers for a provided archive file
+// name and returns a new Archive that writes into ResponseWriter.
+func NewArchive(w http.ResponseWriter, name string) *Archive {
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	w.WriteHeader(http.StatusOK)
+
+	return &Archive{zip.NewWriter(w)}
+}
+
+// AddDir adds directory entry into archive.
+func (a *Archive) AddDir(name string, modTime time.Time) error {
+	header := &zip.FileHeader{Name: strings.TrimSuffix(name, "/") + "/", Method: zip.Store, Modified: modTime}
+
+	_, err := a.zw.CreateHeader(header)
+	return err
+}
+
+// AddFile adds file entry with content from reader into archive.
+func (a *Archive) AddFile(name string, modTime time.Time, r io.Reader) error {
+	header := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modTime}
+
+	fw, err := a.zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(fw, r)
+	return err
+}
+
+// Close finishes archive by writing central directory.
+func (a *Archive) Close() error {
+	return a.zw.Close()
+}
@@ -0,0 +1,24 @@
+// Package paging implements opaque cursors of paginated listings.
+package paging
+
+import (
+	"encoding/base64"
+	"encoding/json"
+)
+
+// EncodeCursor returns cursor that stores sorting keys of the last returned
+// entry, keys are json encoded.
+func EncodeCursor(keys interface{}) string {
+	data, _ := json.Marshal(keys)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor decodes sorting keys of the cursor into keys.
+func DecodeCursor(cursor string, keys interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, keys)
+}
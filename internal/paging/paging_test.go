@@ -0,0 +1,25 @@
+package paging
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCursor(t *testing.T) {
+	type keys struct {
+		Name string `json:"n"`
+		Size int64  `json:"z"`
+	}
+
+	cursor := EncodeCursor(keys{"foo", 10})
+	assert.NotContains(t, cursor, "foo")
+
+	res := keys{}
+	require.NoError(t, DecodeCursor(cursor, &res))
+	assert.Equal(t, keys{"foo", 10}, res)
+
+	assert.Error(t, DecodeCursor("foo!", &res))
+	assert.Error(t, DecodeCursor(EncodeCursor("foo"), &res))
+}
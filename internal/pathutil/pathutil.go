@@ -5,6 +5,12 @@ import (
 	"strings"
 )
 
+// IsFolderName returns true if name is a single non hidden path
+// component.
+func IsFolderName(name string) bool {
+	return name != "" && !strings.HasPrefix(name, ".") && !strings.ContainsAny(name, "/\\")
+}
+
 // Join returns combined path for provided elements. Each element will
 // be cleaned before joining by doing:
 // - Removing all ".."
@@ -16,3 +22,9 @@ func Join(elem ...string) string {
 
 	return filepath.Join(cleaned...)
 }
+
+// Clean returns absolute path p cleaned the same way as by Join, it
+// matches paths resolved by Join against a base path.
+func Clean(p string) string {
+	return Join("/", p)
+}
@@ -33,3 +33,29 @@ func TestJoin(t *testing.T) {
 		})
 	}
 }
+
+func TestClean(t *testing.T) {
+	for p, out := range map[string]string{
+		"":                  "/",
+		"foo/bar":           "/foo/bar",
+		"/foo/bar/":         "/foo/bar",
+		"/foo/../../bar":    "/foo/bar",
+		"foo/./bar/../baz/": "/foo/bar/baz",
+	} {
+		assert.Equal(t, out, Clean(p), p)
+	}
+}
+
+func TestIsFolderName(t *testing.T) {
+	for name, valid := range map[string]bool{
+		"foo":     true,
+		"foo.bar": true,
+		"":        false,
+		".foo":    false,
+		"..":      false,
+		"foo/bar": false,
+		"foo\\b":  false,
+	} {
+		assert.Equal(t, valid, IsFolderName(name), name)
+	}
+}
@@ -7,10 +7,19 @@ import (
 	"github.com/go-chi/chi"
 
 	"github.com/ap4y/cloud/contextkey"
+	"github.com/ap4y/cloud/throttle"
 )
 
-// Authenticator returns new share authentication middleware.
-func Authenticator(store Store) func(next http.Handler) http.Handler {
+// LookupThrottleKey returns throttle key of the share lookups from a
+// client ip.
+func LookupThrottleKey(ip string) string {
+	return "share:" + ip
+}
+
+// Authenticator returns new share authentication middleware. Requests
+// to password protected shares require unlock token issued by locker.
+// Lookups of unknown shares are throttled per client IP by optional th.
+func Authenticator(store Store, locker *Locker, th *throttle.Throttle) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 			slug := chi.URLParam(req, "slug")
@@ -19,12 +28,28 @@ func Authenticator(store Store) func(next http.Handler) http.Handler {
 				return
 			}
 
+			key := LookupThrottleKey(th.ClientIP(req))
+			wait, done := th.Attempt(key)
+			if wait > 0 {
+				throttle.Reject(w, wait)
+				return
+			}
+
 			share, err := store.Get(slug)
+			done(err == nil)
 			if err != nil {
 				http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 				return
 			}
 
+			if share.IsProtected() {
+				token, err := req.Cookie(UnlockCookieKey)
+				if err != nil || locker == nil || locker.Verify(share, token.Value) != nil {
+					http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+					return
+				}
+			}
+
 			ctx := context.WithValue(req.Context(), contextkey.ShareCtxKey, share)
 			next.ServeHTTP(w, req.WithContext(ctx))
 		})
@@ -7,6 +7,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/stretchr/testify/assert"
@@ -14,6 +15,7 @@ import (
 
 	"github.com/ap4y/cloud/contextkey"
 	"github.com/ap4y/cloud/module"
+	"github.com/ap4y/cloud/throttle"
 )
 
 func TestShareAuthenticator(t *testing.T) {
@@ -26,6 +28,16 @@ func TestShareAuthenticator(t *testing.T) {
 	share := &Share{Slug: "bar", Type: module.Gallery, Name: "foo", Items: []string{"test.jpg"}}
 	require.NoError(t, store.Save(share))
 
+	protected := &Share{Slug: "baz", Type: module.Gallery, Name: "foo", Items: []string{"test.jpg"}}
+	require.NoError(t, protected.SetPassword("changeme"))
+	require.NoError(t, store.Save(protected))
+
+	locker := NewLocker([]byte("secret"), time.Minute)
+	token, _, err := locker.Unlock(protected, "changeme")
+	require.NoError(t, err)
+	otherToken, _, err := locker.Unlock(&Share{Slug: "qux", PasswordHash: protected.PasswordHash}, "changeme")
+	require.NoError(t, err)
+
 	var ctxShare *Share
 	handler := func(w http.ResponseWriter, r *http.Request) {
 		ctxShare, _ = r.Context().Value(contextkey.ShareCtxKey).(*Share)
@@ -37,7 +49,7 @@ func TestShareAuthenticator(t *testing.T) {
 		r.Get("/root", handler)
 
 		r.Group(func(r chi.Router) {
-			r.Use(Authenticator(store))
+			r.Use(Authenticator(store, locker, nil))
 			r.Get("/folder", handler)
 		})
 	})
@@ -46,12 +58,17 @@ func TestShareAuthenticator(t *testing.T) {
 		name   string
 		path   string
 		status int
+		token  string
 		share  *Share
 		body   string
 	}{
-		{"root", "/bar/root", http.StatusOK, nil, "Hello World!"},
-		{"with path param", "/bar/folder", http.StatusOK, share, "Hello World!"},
-		{"unknown share", "/baz/folder", http.StatusNotFound, nil, "Not Found\n"},
+		{"root", "/bar/root", http.StatusOK, "", nil, "Hello World!"},
+		{"with path param", "/bar/folder", http.StatusOK, "", share, "Hello World!"},
+		{"unknown share", "/qux/folder", http.StatusNotFound, "", nil, "Not Found\n"},
+		{"protected", "/baz/folder", http.StatusUnauthorized, "", nil, "Unauthorized\n"},
+		{"protected with invalid token", "/baz/folder", http.StatusUnauthorized, "foo", nil, "Unauthorized\n"},
+		{"protected with other share token", "/baz/folder", http.StatusUnauthorized, otherToken, nil, "Unauthorized\n"},
+		{"protected with token", "/baz/folder", http.StatusOK, token, protected, "Hello World!"},
 	}
 
 	for _, tc := range tcs {
@@ -59,6 +76,9 @@ func TestShareAuthenticator(t *testing.T) {
 			ctxShare = nil
 			w := httptest.NewRecorder()
 			req := httptest.NewRequest("GET", "http://cloud.api"+tc.path, nil)
+			if tc.token != "" {
+				req.AddCookie(&http.Cookie{Name: UnlockCookieKey, Value: tc.token})
+			}
 
 			mux.ServeHTTP(w, req)
 			resp := w.Result()
@@ -69,4 +89,30 @@ func TestShareAuthenticator(t *testing.T) {
 			assert.Equal(t, tc.body, string(body))
 		})
 	}
+
+	t.Run("throttled", func(t *testing.T) {
+		mux := chi.NewRouter()
+		mux.With(Authenticator(store, locker, throttle.New(throttle.Config{Attempts: 2}))).Get("/{slug}", handler)
+
+		tcs := []struct {
+			remoteAddr string
+			path       string
+			status     int
+		}{
+			{"1.2.3.4:1234", "/bar", http.StatusOK},
+			{"1.2.3.4:1234", "/qux", http.StatusNotFound},
+			{"1.2.3.4:1234", "/quux", http.StatusNotFound},
+			{"1.2.3.4:1234", "/bar", http.StatusTooManyRequests},
+			{"5.6.7.8:1234", "/bar", http.StatusOK},
+		}
+
+		for _, tc := range tcs {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "http://cloud.api"+tc.path, nil)
+			req.RemoteAddr = tc.remoteAddr
+
+			mux.ServeHTTP(w, req)
+			require.Equal(t, tc.status, w.Result().StatusCode, tc.path)
+		}
+	})
 }
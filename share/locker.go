@@ -0,0 +1,80 @@
+package share
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// UnlockCookieKey defines cookie name for share unlock tokens.
+const UnlockCookieKey = "share_token"
+
+// DefaultUnlockLifetime defines lifetime of the unlock tokens when it's not configured.
+const DefaultUnlockLifetime = time.Hour
+
+// Locker issues and verifies unlock tokens for password protected shares.
+type Locker struct {
+	signKey  []byte
+	lifetime time.Duration
+}
+
+type unlockClaims struct {
+	Slug string `json:"slug"`
+	jwt.StandardClaims
+}
+
+// NewLocker returns a new Locker that signs unlock tokens with a
+// provided key. Tokens expire after lifetime.
+func NewLocker(signKey []byte, lifetime time.Duration) *Locker {
+	if lifetime == 0 {
+		lifetime = DefaultUnlockLifetime
+	}
+
+	return &Locker{signKey, lifetime}
+}
+
+// Unlock returns share scoped unlock token if password matches to a
+// share password hash, error returned otherwise.
+func (l *Locker) Unlock(share *Share, password string) (string, time.Time, error) {
+	if !share.IsProtected() {
+		return "", time.Time{}, errors.New("share is not protected")
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(share.PasswordHash), []byte(password)); err != nil {
+		return "", time.Time{}, errors.New("invalid password")
+	}
+
+	expiresAt := time.Now().Add(l.lifetime)
+	claims := unlockClaims{share.Slug, jwt.StandardClaims{ExpiresAt: expiresAt.Unix()}}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(l.signKey)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to sign token: %s", err)
+	}
+
+	return token, time.Unix(expiresAt.Unix(), 0), nil
+}
+
+// Verify validates unlock token for a provided share.
+func (l *Locker) Verify(share *Share, tokenString string) error {
+	claims := &unlockClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+
+		return l.signKey, nil
+	})
+
+	if err != nil || !token.Valid {
+		return errors.New("invalid token")
+	}
+
+	if claims.ExpiresAt == 0 || claims.Slug != share.Slug {
+		return errors.New("invalid token claims")
+	}
+
+	return nil
+}
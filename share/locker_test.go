@@ -0,0 +1,44 @@
+package share
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocker(t *testing.T) {
+	locker := NewLocker([]byte("secret"), time.Minute)
+	share := &Share{Slug: "foo", Name: "foo", Items: []string{"test.jpg"}}
+	require.NoError(t, share.SetPassword("changeme"))
+
+	t.Run("Unlock", func(t *testing.T) {
+		_, _, err := locker.Unlock(share, "foo")
+		require.Error(t, err)
+
+		_, _, err = locker.Unlock(&Share{Slug: "bar"}, "")
+		require.Error(t, err)
+
+		token, expiresAt, err := locker.Unlock(share, "changeme")
+		require.NoError(t, err)
+		assert.NotEmpty(t, token)
+		assert.WithinDuration(t, time.Now().Add(time.Minute), expiresAt, time.Second)
+	})
+
+	t.Run("Verify", func(t *testing.T) {
+		token, _, err := locker.Unlock(share, "changeme")
+		require.NoError(t, err)
+
+		require.NoError(t, locker.Verify(share, token))
+		require.Error(t, locker.Verify(&Share{Slug: "bar"}, token))
+		require.Error(t, locker.Verify(share, "foo"))
+		require.Error(t, NewLocker([]byte("other"), 0).Verify(share, token))
+	})
+
+	t.Run("Verify/expired", func(t *testing.T) {
+		token, _, err := NewLocker([]byte("secret"), -time.Minute).Unlock(share, "changeme")
+		require.NoError(t, err)
+		require.Error(t, locker.Verify(share, token))
+	})
+}
@@ -35,24 +35,17 @@ func VerifyHandler(shareType module.Type, nameParam, itemParam string, next http
 			return
 		}
 
-		if chi.URLParam(req, nameParam) != share.Name {
+		name := chi.URLParam(req, nameParam)
+		if !share.IncludesName(name) {
 			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 			return
 		}
 
-		if itemParam == "" {
+		if itemParam == "" || share.Includes(name, chi.URLParam(req, itemParam)) {
 			next.ServeHTTP(w, req)
 			return
 		}
 
-		file := chi.URLParam(req, itemParam)
-		for _, item := range share.Items {
-			if item == file {
-				next.ServeHTTP(w, req)
-				return
-			}
-		}
-
 		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 	})
 }
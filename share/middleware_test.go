@@ -47,6 +47,7 @@ func TestBlockHandler(t *testing.T) {
 func TestVerifyHandler(t *testing.T) {
 	share := &Share{Slug: "bar", Type: module.Gallery, Name: "foo", Items: []string{"test.jpg"}}
 	filesShare := &Share{Slug: "baz", Type: module.Files, Name: "foo", Items: []string{"test.jpg"}}
+	nestedShare := &Share{Slug: "bar", Type: module.Gallery, Name: "foo", Items: []string{"test.jpg"}, Nested: true}
 
 	handler := func(w http.ResponseWriter, r *http.Request) {
 		io.WriteString(w, "Hello World!") // nolint: errcheck
@@ -55,6 +56,10 @@ func TestVerifyHandler(t *testing.T) {
 	mux := chi.NewRouter()
 	mux.Get("/{path}", VerifyHandler(module.Gallery, "path", "", handler))
 	mux.Get("/{path}/file/{file}", VerifyHandler(module.Gallery, "path", "file", handler))
+	mux.Get("/{path}/{nested}/file/{file}", func(w http.ResponseWriter, r *http.Request) {
+		chi.RouteContext(r.Context()).URLParams.Add("path", chi.URLParam(r, "path")+"/"+chi.URLParam(r, "nested"))
+		VerifyHandler(module.Gallery, "path", "file", handler)(w, r)
+	})
 
 	tcs := []struct {
 		name   string
@@ -69,6 +74,9 @@ func TestVerifyHandler(t *testing.T) {
 		{"with file param", "/foo/file/test.jpg", http.StatusOK, share, "Hello World!"},
 		{"unknown file", "/foo/file/baz.jpg", http.StatusNotFound, share, "Not Found\n"},
 		{"invalid type", "/foo", http.StatusNotFound, filesShare, "Not Found\n"},
+		{"nested name", "/foo/bar/file/baz.jpg", http.StatusNotFound, share, "Not Found\n"},
+		{"nested share", "/foo/bar/file/baz.jpg", http.StatusOK, nestedShare, "Hello World!"},
+		{"nested share file", "/foo/file/baz.jpg", http.StatusNotFound, nestedShare, "Not Found\n"},
 	}
 
 	for _, tc := range tcs {
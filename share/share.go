@@ -1,6 +1,11 @@
 package share
 
 import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+
 	"github.com/ap4y/cloud/module"
 	"github.com/ap4y/cloud/niltime"
 )
@@ -12,6 +17,18 @@ type Share struct {
 	Name      string       `json:"name"`
 	Items     []string     `json:"items"`
 	ExpiresAt niltime.Time `json:"expires_at"`
+	// PasswordHash stores bcrypt hash of the share password, empty
+	// for unprotected shares.
+	PasswordHash string `json:"password_hash,omitempty"`
+	// Nested grants access to all items of names nested into Name,
+	// e.g. sub-albums of a gallery album.
+	Nested bool `json:"nested,omitempty"`
+	// KeepMetadata disables removal of EXIF and location metadata
+	// from shared images.
+	KeepMetadata bool `json:"keep_metadata,omitempty"`
+	// Owner stores username of the share creator, shared items of
+	// the files module are resolved against owner's home folder.
+	Owner string `json:"owner,omitempty"`
 }
 
 // IsValid returns true if share is valid.
@@ -34,7 +51,7 @@ func (s Share) IsValid() bool {
 // Includes returns true if share includes provided item.
 func (s Share) Includes(name, item string) bool {
 	if s.Name != name {
-		return false
+		return s.IncludesName(name)
 	}
 
 	for _, i := range s.Items {
@@ -45,3 +62,47 @@ func (s Share) Includes(name, item string) bool {
 
 	return false
 }
+
+// IncludesName returns true if share grants access to provided
+// name, nested names are included only for nested shares.
+func (s Share) IncludesName(name string) bool {
+	if s.Name == name {
+		return true
+	}
+
+	return s.Nested && strings.HasPrefix(name, strings.TrimSuffix(s.Name, "/")+"/")
+}
+
+// IncludesPath returns true if path p is one of the share items or
+// is inside of one of them.
+func (s Share) IncludesPath(p string) bool {
+	for _, item := range s.Items {
+		if p == item || strings.HasPrefix(p, strings.TrimSuffix(item, "/")+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsProtected returns true if share requires password to access.
+func (s Share) IsProtected() bool {
+	return s.PasswordHash != ""
+}
+
+// SetPassword stores bcrypt hash of a provided password, empty
+// password removes protection.
+func (s *Share) SetPassword(password string) error {
+	if password == "" {
+		s.PasswordHash = ""
+		return nil
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("bcrypt: %s", err)
+	}
+
+	s.PasswordHash = string(hash)
+	return nil
+}
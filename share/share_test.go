@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/ap4y/cloud/module"
 )
@@ -23,5 +24,38 @@ func TestShare(t *testing.T) {
 		assert.False(t, share.Includes("bar", "test.jpg"))
 		assert.False(t, share.Includes("foo", "test2.jpg"))
 		assert.True(t, share.Includes("foo", "test.jpg"))
+		assert.False(t, share.Includes("foo/bar", "test.jpg"))
+	})
+
+	t.Run("Includes/nested", func(t *testing.T) {
+		nested := &Share{Slug: "bar", Type: module.Gallery, Name: "foo", Items: []string{"test.jpg"}, Nested: true}
+		assert.True(t, nested.IncludesName("foo"))
+		assert.True(t, nested.IncludesName("foo/bar"))
+		assert.False(t, nested.IncludesName("foobar"))
+		assert.False(t, share.IncludesName("foo/bar"))
+
+		assert.True(t, nested.Includes("foo/bar", "other.jpg"))
+		assert.False(t, nested.Includes("foo", "other.jpg"))
+		assert.False(t, nested.Includes("foobar", "test.jpg"))
+	})
+
+	t.Run("IncludesPath", func(t *testing.T) {
+		s := &Share{Slug: "bar", Type: module.Files, Name: "/foo", Items: []string{"/foo/bar"}}
+		assert.True(t, s.IncludesPath("/foo/bar"))
+		assert.True(t, s.IncludesPath("/foo/bar/baz"))
+		assert.False(t, s.IncludesPath("/foo/barbaz"))
+		assert.False(t, s.IncludesPath("/foo"))
+	})
+
+	t.Run("SetPassword", func(t *testing.T) {
+		s := &Share{Slug: "bar", Name: "foo", Items: []string{"test.jpg"}}
+		assert.False(t, s.IsProtected())
+
+		require.NoError(t, s.SetPassword("changeme"))
+		assert.True(t, s.IsProtected())
+		assert.NotEqual(t, "changeme", s.PasswordHash)
+
+		require.NoError(t, s.SetPassword(""))
+		assert.False(t, s.IsProtected())
 	})
 }
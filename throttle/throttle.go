@@ -0,0 +1,302 @@
+package throttle
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ap4y/cloud/internal/httputil"
+)
+
+const (
+	// DefaultAttempts defines number of failed attempts allowed
+	// without delay when it's not configured.
+	DefaultAttempts = 5
+	// DefaultBackoff defines delay after the first throttled failure
+	// when it's not configured.
+	DefaultBackoff = time.Second
+	// DefaultLockout defines maximum delay when it's not configured.
+	DefaultLockout = 15 * time.Minute
+	// DefaultReset defines how long failures are remembered when it's
+	// not configured.
+	DefaultReset = time.Hour
+)
+
+// Config defines limits of the failed attempts.
+type Config struct {
+	// Attempts defines number of failed attempts allowed without delay.
+	Attempts int
+	// Backoff defines delay after the first throttled failure, delay
+	// is doubled for each subsequent failure.
+	Backoff time.Duration
+	// Lockout defines maximum delay.
+	Lockout time.Duration
+	// Reset defines how long failures are remembered after the last one.
+	Reset time.Duration
+	// TrustedProxies defines networks of proxies that are allowed to
+	// set X-Forwarded-For header.
+	TrustedProxies []*net.IPNet
+}
+
+type entry struct {
+	failures int
+	last     time.Time
+	until    time.Time
+}
+
+// Throttle tracks failed attempts per key (e.g. client IP or
+// username) and delays further attempts with exponential backoff up
+// to a temporary lockout. Nil Throttle never delays attempts.
+type Throttle struct {
+	sync.Mutex
+	cfg     Config
+	entries map[string]*entry
+	now     func() time.Time
+}
+
+// New returns a new Throttle, zero config values are replaced with
+// defaults.
+func New(cfg Config) *Throttle {
+	if cfg.Attempts == 0 {
+		cfg.Attempts = DefaultAttempts
+	}
+
+	if cfg.Backoff == 0 {
+		cfg.Backoff = DefaultBackoff
+	}
+
+	if cfg.Lockout == 0 {
+		cfg.Lockout = DefaultLockout
+	}
+
+	if cfg.Reset == 0 {
+		cfg.Reset = DefaultReset
+	}
+
+	return &Throttle{cfg: cfg, entries: map[string]*entry{}, now: time.Now}
+}
+
+// Attempt atomically verifies that attempt is allowed for all keys and
+// reserves it. Reserved attempt is counted as failed until returned
+// done is called with true, so concurrent attempts can't exceed the
+// limit. Duration until the next attempt is allowed is returned for
+// throttled keys, done is a no-op in such case.
+func (t *Throttle) Attempt(keys ...string) (wait time.Duration, done func(ok bool)) {
+	done = func(bool) {}
+	if t == nil {
+		return 0, done
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	now := t.now()
+	if wait := t.wait(now, keys); wait > 0 {
+		return wait, done
+	}
+
+	t.fail(now, keys)
+	var once sync.Once
+	return 0, func(ok bool) {
+		if ok {
+			once.Do(func() { t.rollback(keys) })
+		}
+	}
+}
+
+// Wait returns duration until the next attempt is allowed for all
+// keys, zero is returned if attempt is allowed. Use Attempt to verify
+// and record attempts atomically.
+func (t *Throttle) Wait(keys ...string) time.Duration {
+	if t == nil {
+		return 0
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	return t.wait(t.now(), keys)
+}
+
+func (t *Throttle) wait(now time.Time, keys []string) time.Duration {
+	var wait time.Duration
+	for _, key := range keys {
+		e, ok := t.entries[key]
+		if !ok {
+			continue
+		}
+
+		if delay := e.until.Sub(now); delay > wait {
+			wait = delay
+		}
+	}
+
+	return wait
+}
+
+// Fail records failed attempt for all keys, expired entries are
+// pruned.
+func (t *Throttle) Fail(keys ...string) {
+	if t == nil {
+		return
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	t.fail(t.now(), keys)
+}
+
+// fail records failed attempt for all keys, caller has to hold the
+// lock.
+func (t *Throttle) fail(now time.Time, keys []string) {
+	for key, e := range t.entries {
+		if now.Sub(e.last) > t.cfg.Reset && now.After(e.until) {
+			delete(t.entries, key)
+		}
+	}
+
+	for _, key := range keys {
+		e, ok := t.entries[key]
+		if !ok {
+			e = &entry{}
+			t.entries[key] = e
+		}
+
+		e.failures++
+		e.last = now
+		if e.failures >= t.cfg.Attempts {
+			e.until = now.Add(t.backoff(e.failures - t.cfg.Attempts))
+		}
+	}
+}
+
+// rollback removes reserved attempt of all keys, delay is kept if
+// remaining failures exceed the limit.
+func (t *Throttle) rollback(keys []string) {
+	t.Lock()
+	defer t.Unlock()
+
+	for _, key := range keys {
+		e, ok := t.entries[key]
+		if !ok {
+			continue
+		}
+
+		e.failures--
+		if e.failures <= 0 {
+			delete(t.entries, key)
+		} else if e.failures < t.cfg.Attempts {
+			e.until = time.Time{}
+		}
+	}
+}
+
+// Reset forgets failed attempts of all keys.
+func (t *Throttle) Reset(keys ...string) {
+	if t == nil {
+		return
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	for _, key := range keys {
+		delete(t.entries, key)
+	}
+}
+
+func (t *Throttle) backoff(exp int) time.Duration {
+	delay := float64(t.cfg.Backoff) * math.Pow(2, float64(exp))
+	if delay > float64(t.cfg.Lockout) {
+		return t.cfg.Lockout
+	}
+
+	return time.Duration(delay)
+}
+
+// ClientIP returns IP address of the request client. X-Forwarded-For
+// header is used only for requests from trusted proxies, addresses
+// are consumed from the right until untrusted one is found.
+func (t *Throttle) ClientIP(req *http.Request) string {
+	ip, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		ip = req.RemoteAddr
+	}
+
+	if t == nil || !t.isTrusted(ip) {
+		return ip
+	}
+
+	hops := strings.Split(strings.Join(req.Header["X-Forwarded-For"], ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+
+		ip = hop
+		if !t.isTrusted(ip) {
+			break
+		}
+	}
+
+	return ip
+}
+
+func (t *Throttle) isTrusted(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	for _, network := range t.cfg.TrustedProxies {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Reject responds with Too Many Requests and sets Retry-After header
+// to a provided wait duration.
+func Reject(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", fmt.Sprint(int64(math.Ceil(wait.Seconds()))))
+	httputil.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+}
+
+// ParseNetworks parses IP addresses and CIDR networks, addresses are
+// converted into single address networks.
+func ParseNetworks(values []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(values))
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address: %s", value)
+			}
+
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network: %s", value)
+		}
+
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
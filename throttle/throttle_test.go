@@ -0,0 +1,183 @@
+package throttle
+
+import (
+	"net"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThrottle(t *testing.T) {
+	now := time.Now()
+	th := New(Config{Attempts: 3, Backoff: time.Second, Lockout: 5 * time.Second, Reset: time.Minute})
+	th.now = func() time.Time { return now }
+
+	t.Run("Backoff", func(t *testing.T) {
+		th.Fail("foo")
+		th.Fail("foo")
+		assert.Equal(t, time.Duration(0), th.Wait("foo"))
+
+		th.Fail("foo")
+		assert.Equal(t, time.Second, th.Wait("foo"))
+		assert.Equal(t, time.Second, th.Wait("bar", "foo"))
+		assert.Equal(t, time.Duration(0), th.Wait("bar"))
+
+		th.Fail("foo")
+		assert.Equal(t, 2*time.Second, th.Wait("foo"))
+		th.Fail("foo")
+		assert.Equal(t, 4*time.Second, th.Wait("foo"))
+
+		th.Fail("foo")
+		assert.Equal(t, 5*time.Second, th.Wait("foo"))
+		for i := 0; i < 100; i++ {
+			th.Fail("foo")
+		}
+		assert.Equal(t, 5*time.Second, th.Wait("foo"))
+
+		now = now.Add(3 * time.Second)
+		assert.Equal(t, 2*time.Second, th.Wait("foo"))
+		now = now.Add(2 * time.Second)
+		assert.Equal(t, time.Duration(0), th.Wait("foo"))
+	})
+
+	t.Run("Reset", func(t *testing.T) {
+		th.Fail("foo")
+		require.NotEqual(t, time.Duration(0), th.Wait("foo"))
+
+		th.Reset("foo")
+		assert.Equal(t, time.Duration(0), th.Wait("foo"))
+	})
+
+	t.Run("Expire", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			th.Fail("foo")
+		}
+		require.Len(t, th.entries, 1)
+
+		now = now.Add(2 * time.Minute)
+		th.Fail("bar")
+		assert.Len(t, th.entries, 1)
+		assert.Equal(t, time.Duration(0), th.Wait("foo"))
+	})
+
+	t.Run("Attempt", func(t *testing.T) {
+		th.Reset("foo", "bar")
+
+		wait, done := th.Attempt("foo", "bar")
+		require.Equal(t, time.Duration(0), wait)
+		done(true)
+		done(true)
+		assert.Len(t, th.entries, 0)
+
+		for i := 0; i < 3; i++ {
+			wait, done = th.Attempt("foo")
+			require.Equal(t, time.Duration(0), wait)
+			done(false)
+		}
+
+		wait, _ = th.Attempt("foo", "bar")
+		assert.Equal(t, time.Second, wait)
+		assert.Equal(t, time.Duration(0), th.Wait("bar"))
+		th.Reset("foo")
+	})
+
+	t.Run("Attempt/concurrent", func(t *testing.T) {
+		var mu sync.Mutex
+		var allowed []func(bool)
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if wait, done := th.Attempt("foo"); wait == 0 {
+					mu.Lock()
+					allowed = append(allowed, done)
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+
+		require.Len(t, allowed, 3)
+		for _, done := range allowed {
+			done(true)
+		}
+		assert.Equal(t, time.Duration(0), th.Wait("foo"))
+	})
+
+	t.Run("Nil", func(t *testing.T) {
+		var th *Throttle
+		th.Fail("foo")
+		th.Reset("foo")
+		assert.Equal(t, time.Duration(0), th.Wait("foo"))
+
+		wait, done := th.Attempt("foo")
+		assert.Equal(t, time.Duration(0), wait)
+		done(false)
+	})
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseNetworks([]string{"10.0.0.1", "192.168.0.0/16"})
+	require.NoError(t, err)
+	th := New(Config{TrustedProxies: proxies})
+
+	tcs := []struct {
+		name          string
+		remoteAddr    string
+		forwardedFor  []string
+		ip            string
+		withoutConfig string
+	}{
+		{"direct", "1.2.3.4:1234", nil, "1.2.3.4", "1.2.3.4"},
+		{"untrusted proxy", "1.2.3.4:1234", []string{"5.6.7.8"}, "1.2.3.4", "1.2.3.4"},
+		{"trusted proxy", "10.0.0.1:1234", []string{"5.6.7.8"}, "5.6.7.8", "10.0.0.1"},
+		{"spoofed header", "10.0.0.1:1234", []string{"9.9.9.9, 5.6.7.8"}, "5.6.7.8", "10.0.0.1"},
+		{"proxy chain", "10.0.0.1:1234", []string{"5.6.7.8, 192.168.1.1"}, "5.6.7.8", "10.0.0.1"},
+		{"multiple headers", "10.0.0.1:1234", []string{"5.6.7.8", "192.168.1.1"}, "5.6.7.8", "10.0.0.1"},
+		{"only proxies", "10.0.0.1:1234", []string{"192.168.1.1"}, "192.168.1.1", "10.0.0.1"},
+		{"invalid header", "10.0.0.1:1234", []string{"foo"}, "10.0.0.1", "10.0.0.1"},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://example.com/foo", nil)
+			req.RemoteAddr = tc.remoteAddr
+			for _, value := range tc.forwardedFor {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+
+			assert.Equal(t, tc.ip, th.ClientIP(req))
+			assert.Equal(t, tc.withoutConfig, New(Config{}).ClientIP(req))
+		})
+	}
+}
+
+func TestReject(t *testing.T) {
+	w := httptest.NewRecorder()
+	Reject(w, 1500*time.Millisecond)
+
+	res := w.Result()
+	assert.Equal(t, 429, res.StatusCode)
+	assert.Equal(t, "2", res.Header.Get("Retry-After"))
+}
+
+func TestParseNetworks(t *testing.T) {
+	networks, err := ParseNetworks([]string{"10.0.0.1", "::1", "192.168.0.0/16"})
+	require.NoError(t, err)
+	require.Len(t, networks, 3)
+
+	assert.True(t, networks[0].Contains(net.ParseIP("10.0.0.1")))
+	assert.False(t, networks[0].Contains(net.ParseIP("10.0.0.2")))
+	assert.True(t, networks[1].Contains(net.ParseIP("::1")))
+	assert.True(t, networks[2].Contains(net.ParseIP("192.168.10.1")))
+
+	_, err = ParseNetworks([]string{"foo"})
+	assert.Error(t, err)
+	_, err = ParseNetworks([]string{"10.0.0.1/33"})
+	assert.Error(t, err)
+}